@@ -2,6 +2,7 @@ package bird
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -14,29 +15,58 @@ import (
 	"os/exec"
 )
 
+// The version of the results serialized by the redis and
+// disk caches. Results in another format, e.g. written by
+// an older release, are ignored instead of being decoded.
+const cacheFormatVersion = 1
+
 type Cache interface {
-	Set(key string, val Parsed, ttl int) error
+	Set(key string, val Parsed, ttl time.Duration) error
 	Get(key string) (Parsed, error)
 	Expire() int
+	Purge(prefix string) int // Remove the keys with the prefix
+	Delete(key string) bool
+	Entries(prefix string) ([]CacheEntry, error)
+}
+
+// CacheEntry describes a cached result
+type CacheEntry struct {
+	Key      string    `json:"key"`
+	Size     int64     `json:"size"` // Approximate, in bytes
+	CachedAt time.Time `json:"cached_at"`
+	TTL      time.Time `json:"ttl"`
+	Hits     uint64    `json:"hits"`
 }
 
-var ClientConf BirdConfig
 var StatusConf StatusConfig
-var IPVersion = "4"
-var BirdVersion = 0
-var cache Cache // stores parsed birdc output
+var cache Cache      // stores parsed birdc output
+var cacheError error // set if the configured cache is not available
 var CacheConf CacheConfig
 var RateLimitConf struct {
 	sync.RWMutex
 	Conf RateLimitConfig
 }
-var RunQueue sync.Map // queue birdc commands before execution
 
 var NilParse Parsed = (Parsed)(nil) // special Parsed values
-var BirdError Parsed = Parsed{"error": "bird unreachable"}
 
 func IsSpecial(ret Parsed) bool { // test for special Parsed values
-	return reflect.DeepEqual(ret, NilParse) || reflect.DeepEqual(ret, BirdError)
+	if _, ok := ParsedError(ret); ok {
+		return true
+	}
+	return reflect.DeepEqual(ret, NilParse)
+}
+
+// AsParsed gets a parsed object from a value of a
+// result. Results decoded from JSON may hold generic
+// maps instead of Parsed values.
+func AsParsed(value interface{}) (Parsed, bool) {
+	switch v := value.(type) {
+	case Parsed:
+		return v, true
+	case map[string]interface{}:
+		return v, true
+	}
+	return nil, false
 }
 
 // intitialize the Cache once during setup with either a MemoryCache or
@@ -44,22 +74,57 @@ func IsSpecial(ret Parsed) bool { // test for special Parsed values
 // TODO implement singleton pattern
 func InitializeCache() {
 	var err error
+	cacheError = nil
 	if CacheConf.UseRedis {
 		cache, err = NewRedisCache(CacheConf)
-		if err != nil {
-			log.Println("Could not initialize redis cache, falling back to memory cache:", err)
+		if err == nil {
+			return
 		}
-	} else { // initialize the MemoryCache
-		maxKeys := CacheConf.MaxKeys
-		maxKeysDefault := 60
-		if maxKeys == 0 {
-			log.Println("MaxKeys not set, using default value:", maxKeysDefault)
-			maxKeys = maxKeysDefault
+		log.Println("Could not initialize redis cache, falling back to memory cache:", err)
+		cacheError = err // Reported by the readiness check
+	} else if CacheConf.UseDisk {
+		cache, err = NewDiskCache(CacheConf)
+		if err == nil {
+			log.Println("Initialized DiskCache in:", CacheConf.DiskPath)
+			return
 		}
+		log.Println("Could not initialize disk cache, falling back to memory cache:", err)
+		cacheError = err
+	}
 
-		cache = NewMemoryCache(maxKeys)
-		log.Println("Initialized MemoryCache with maxKeys:", maxKeys)
+	// initialize the MemoryCache
+	maxKeys := CacheConf.MaxKeys
+	maxKeysDefault := 60
+	maxBytes := int64(CacheConf.MaxMemory) << 20
+	if maxKeys == 0 && maxBytes == 0 {
+		log.Println("MaxKeys not set, using default value:", maxKeysDefault)
+		maxKeys = maxKeysDefault
 	}
+
+	cache = NewSizedMemoryCache(maxKeys, maxBytes)
+	log.Println("Initialized MemoryCache with maxKeys:", maxKeys,
+		"maxMemory:", CacheConf.MaxMemory, "MiB")
+}
+
+// MemoryCacheStatistics returns the statistics of the
+// cache, if the MemoryCache is used.
+func MemoryCacheStatistics() (MemoryCacheStats, bool) {
+	memory, ok := cache.(*MemoryCache)
+	if !ok {
+		return MemoryCacheStats{}, false
+	}
+	return memory.Stats(), true
+}
+
+// SocketPoolStats returns the statistics of the socket
+// pool of the instance. The second return value is false
+// if no pool is used.
+func SocketPoolStats(ctx context.Context) (PoolStats, bool) {
+	pool := InstanceFromContext(ctx).socketPool
+	if pool == nil {
+		return PoolStats{}, false
+	}
+	return pool.Stats(), true
 }
 
 // ExpireCache is a convenience method to expire the cache.
@@ -67,20 +132,80 @@ func ExpireCache() int {
 	return cache.Expire()
 }
 
-/* Convenience method to make new entries in the cache.
- * Abstracts over the specific caching implementation and the ability to set
- * individual TTL values for entries. Always use the default TTL value from the
- * config.
- */
-func toCache(key string, val Parsed) bool {
-	var ttl int
-	if ClientConf.CacheTtl >= 0 {
-		ttl = ClientConf.CacheTtl
-	} else {
-		ttl = 5 // five minutes
+type moduleKey struct{}
+
+// WithModule returns a context for queries of the
+// module, e.g. "routes_protocol". The TTL of the
+// module applies to the cached results.
+func WithModule(ctx context.Context, module string) context.Context {
+	return context.WithValue(ctx, moduleKey{}, module)
+}
+
+// ModuleFromContext gets the module of the queries
+// in the context, if any.
+func ModuleFromContext(ctx context.Context) string {
+	module, _ := ctx.Value(moduleKey{}).(string)
+	return module
+}
+
+type rateLimitKey struct{}
+
+// WithoutRateLimit returns a context for queries which do
+// not count against the rate limit, like the queries of
+// Prometheus scrapes.
+func WithoutRateLimit(ctx context.Context) context.Context {
+	return context.WithValue(ctx, rateLimitKey{}, true)
+}
+
+func isRateLimited(ctx context.Context) bool {
+	exempt, _ := ctx.Value(rateLimitKey{}).(bool)
+	return !exempt
+}
+
+type commandKey struct{}
+
+// WithCommandRecorder returns a context recording the
+// command of the queries, see RecordedCommand.
+func WithCommandRecorder(ctx context.Context) context.Context {
+	return context.WithValue(ctx, commandKey{}, new(string))
+}
+
+// RecordedCommand gets the command of the last query
+// with the context, if it was recorded.
+func RecordedCommand(ctx context.Context) string {
+	cmd, ok := ctx.Value(commandKey{}).(*string)
+	if !ok {
+		return ""
 	}
+	return *cmd
+}
+
+func recordCommand(ctx context.Context, cmd string) {
+	if recorded, ok := ctx.Value(commandKey{}).(*string); ok {
+		*recorded = cmd
+	}
+}
 
-	if err := cache.Set(key, val, ttl); err != nil {
+// Get the TTL of the results of the module. If no TTL
+// is configured for the module, the TTL of the instance
+// is used.
+func (i *Instance) cacheTTL(module string) time.Duration {
+	if ttl, ok := CacheConf.TTL[module]; ok {
+		return time.Duration(ttl) * time.Second
+	}
+	if i.Config.CacheTtl >= 0 {
+		return time.Duration(i.Config.CacheTtl) * time.Minute
+	}
+	return 5 * time.Minute
+}
+
+/* Convenience method to make new entries in the cache.
+ * Abstracts over the specific caching implementation. The TTL of the
+ * module of the query is used, see cacheTTL.
+ */
+func (i *Instance) toCache(ctx context.Context, key string, val Parsed) bool {
+	ttl := i.cacheTTL(ModuleFromContext(ctx))
+	if err := cache.Set(i.cacheKey(key), val, ttl); err != nil {
 		log.Println(err)
 		return false
 	}
@@ -95,8 +220,9 @@ func toCache(key string, val Parsed) bool {
  * Handling of specific error conditions e.g. ttl expired but entry present is
  * possible but currently not implemented.
  */
-func fromCache(key string) (Parsed, bool) {
-	val, err := cache.Get(key)
+func (i *Instance) fromCache(key string) (Parsed, bool) {
+	val, err := cache.Get(i.cacheKey(key))
+	i.metrics.countCacheResult(err == nil)
 	if err == nil {
 		return val, true
 	} else {
@@ -106,6 +232,33 @@ func fromCache(key string) (Parsed, bool) {
 
 }
 
+// StaleKey marks a result served from the cache after its
+// TTL expired. The result is refreshed in the background.
+const StaleKey = "stale"
+
+// Get a copy of an expired result marked as stale,
+// if serving stale results is enabled and the result
+// did not expire more than CacheConf.MaxStale ago.
+func staleResult(val Parsed) (Parsed, bool) {
+	if CacheConf.MaxStale <= 0 || IsSpecial(val) {
+		return nil, false
+	}
+	ttl, err := parseCacheTTL(val["ttl"])
+	if err != nil || ttl.IsZero() {
+		return nil, false
+	}
+	if time.Since(ttl) > time.Duration(CacheConf.MaxStale)*time.Second {
+		return nil, false
+	}
+
+	res := make(Parsed, len(val)+1)
+	for k, v := range val {
+		res[k] = v
+	}
+	res[StaleKey] = true
+	return res, true
+}
+
 // Determines the key in the cache, where the result of specific functions are stored.
 // Eliminates the need to know what command was executed by that function.
 func GetCacheKey(fname string, fargs ...interface{}) string {
@@ -121,12 +274,32 @@ func GetCacheKey(fname string, fargs ...interface{}) string {
 	return key
 }
 
-func Run(args string) (io.Reader, error) {
+// Run executes a show command on the instance of the
+// context, see Instance.Run.
+func Run(ctx context.Context, args string) (io.Reader, error) {
+	return InstanceFromContext(ctx).Run(ctx, args)
+}
+
+// Run executes a show command either through the BIRD
+// control socket, if configured, or by running birdc.
+// The command is aborted when the context is done.
+func (i *Instance) Run(ctx context.Context, args string) (io.Reader, error) {
+	if i.socketPool != nil {
+		return i.socketPool.Run(ctx, "show "+args)
+	}
+	if i.Config.Socket != "" {
+		return NewSocketClient(i.Config.Socket).Run(ctx, "show "+args)
+	}
+	return i.runBirdc(ctx, args)
+}
+
+// Make the birdc command running the show command
+func (i *Instance) birdcCommand(ctx context.Context, args string) *exec.Cmd {
 	args = "-r " + "show " + args // enforce birdc in restricted mode with "-r" argument
 	argsList := strings.Split(args, " ")
 
 	// Allow for arguments in the config
-	cmdArgs := strings.Split(ClientConf.BirdCmd, " ")
+	cmdArgs := strings.Split(i.Config.BirdCmd, " ")
 	birdc := cmdArgs[0]
 	cmdArgs = cmdArgs[1:]
 
@@ -134,9 +307,18 @@ func Run(args string) (io.Reader, error) {
 	cmd = append(cmd, cmdArgs...)
 	cmd = append(cmd, argsList...)
 
-	out, err := exec.Command(birdc, cmd...).Output()
+	return exec.CommandContext(ctx, birdc, cmd...)
+}
+
+func (i *Instance) runBirdc(ctx context.Context, args string) (io.Reader, error) {
+	out, err := i.birdcCommand(ctx, args).Output()
 	if err != nil {
-		return nil, err
+		return nil, contextError(ctx, err)
+	}
+
+	// birdc prints errors without the reply code
+	if replyErr := errorFromOutput(out); replyErr != nil {
+		return nil, replyErr
 	}
 
 	return bytes.NewReader(out), nil
@@ -176,76 +358,161 @@ func checkRateLimit() bool {
 	return true
 }
 
-func RunAndParse(useCache bool, key string, cmd string, parser func(io.Reader) Parsed, updateCache func(*Parsed)) (Parsed, bool) {
-	var wg sync.WaitGroup
-
+// RunAndParse runs the command and parses the output, unless
+// a cached result can be used. Concurrent requests for the
+// same command wait for a single execution.
+//
+// The execution is cancelled if all waiting requests are gone.
+func RunAndParse(ctx context.Context, useCache bool, key string, cmd string, parser func(io.Reader) Parsed, updateCache func(*Parsed)) (Parsed, bool) {
+	instance := InstanceFromContext(ctx)
+	recordCommand(ctx, cmd)
 	if useCache {
-		if val, ok := fromCache(cmd); ok {
+		val, ok := instance.fromCache(cmd)
+		if ok {
 			return val, true
 		}
+		if stale, ok := staleResult(val); ok {
+			instance.metrics.countStaleResult()
+			instance.revalidate(ctx, cmd, parser, updateCache)
+			return stale, true
+		}
 	}
 
-	wg.Add(1)
-	if queueGroup, queueLoaded := RunQueue.LoadOrStore(cmd, &wg); queueLoaded {
-		(*queueGroup.(*sync.WaitGroup)).Wait()
+	for {
+		runCtx, cancel := instance.runContext(ctx)
+		entry := newRunQueueEntry(cancel)
+
+		queued, queueLoaded := instance.runQueue.LoadOrStore(cmd, entry)
+		if !queueLoaded {
+			go func() {
+				entry.finish(instance.runAndParse(runCtx, cmd, parser, updateCache),
+					func() { instance.runQueue.Delete(cmd) })
+				cancel()
+			}()
+			return entry.wait(ctx, cmd), false
+		}
+		cancel()
 
-		if val, ok := fromCache(cmd); ok {
-			return val, true
-		} else {
-			// TODO BirdError should also be signaled somehow
-			return NilParse, false
+		entry = queued.(*runQueueEntry)
+		if entry.join() {
+			return entry.wait(ctx, cmd), false
+		}
+
+		// The queued command was abandoned. It is removed
+		// from the queue before it is done, so the command
+		// is queued again on the next attempt.
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return errorParsed(newError("show "+cmd, ctx.Err())), false
 		}
 	}
+}
+
+// The context of a queued command. The command
+// outlives the request, but keeps its module and
+// the exemption from the rate limit.
+func (i *Instance) runContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	runCtx := WithModule(WithInstance(context.Background(), i),
+		ModuleFromContext(ctx))
+	if !isRateLimited(ctx) {
+		runCtx = WithoutRateLimit(runCtx)
+	}
+	return context.WithCancel(runCtx)
+}
+
+// Refresh the cached result of the command in the
+// background, unless the command is already running.
+// No request waits for the refresh, so it is bounded
+// by the timeout of the module, or if there is none,
+// the query timeout of the instance. Requests joining
+// the refresh can not outlast it.
+func (i *Instance) revalidate(ctx context.Context, cmd string, parser func(io.Reader) Parsed, updateCache func(*Parsed)) {
+	timeout := i.queryTimeout()
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline) // The module timeout
+	}
+	runCtx, cancelRun := i.runContext(ctx)
+	runCtx, cancelTimeout := context.WithTimeout(runCtx, timeout)
+	cancel := func() {
+		cancelTimeout()
+		cancelRun()
+	}
+	entry := newRunQueueEntry(cancel)
+
+	if _, queueLoaded := i.runQueue.LoadOrStore(cmd, entry); queueLoaded {
+		cancel()
+		return
+	}
+	go func() {
+		entry.finish(i.runAndParse(runCtx, cmd, parser, updateCache),
+			func() { i.runQueue.Delete(cmd) })
+		cancel()
+	}()
+}
 
-	if !checkRateLimit() {
-		wg.Done()
-		RunQueue.Delete(cmd)
-		return NilParse, false
+func (i *Instance) runAndParse(ctx context.Context, cmd string, parser func(io.Reader) Parsed, updateCache func(*Parsed)) Parsed {
+	if isRateLimited(ctx) && !checkRateLimit() {
+		i.metrics.countRateLimited()
+		return errorParsed(errRateLimited("show " + cmd))
 	}
 
-	out, err := Run(cmd)
+	start := time.Now()
+	out, err := i.Run(ctx, cmd)
+	i.metrics.queryDuration.observe(metricCommand(cmd), time.Since(start))
 	if err != nil {
-		// ignore errors for now
-		wg.Done()
-		RunQueue.Delete(cmd)
-		return BirdError, false
+		return errorParsed(newError("show "+cmd, err))
 	}
 
-	parsed := parser(out)
+	start = time.Now()
+	parsed := parser(&contextReader{ctx: ctx, r: out})
+	i.metrics.parseDuration.observe(metricCommand(cmd), time.Since(start))
+
+	// The result is incomplete if parsing was aborted
+	if err := ctx.Err(); err != nil {
+		return errorParsed(newError("show "+cmd, err))
+	}
 
 	if updateCache != nil {
 		updateCache(&parsed)
 	}
 
-	toCache(cmd, parsed)
+	i.toCache(ctx, cmd, parsed)
 
-	wg.Done()
-	RunQueue.Delete(cmd)
-
-	return parsed, false
+	return parsed
 }
 
-func Status(useCache bool) (Parsed, bool) {
+// Status queries the status of BIRD. The status is
+// checked for a reconfiguration of BIRD.
+func Status(ctx context.Context, useCache bool) (Parsed, bool) {
+	config := InstanceFromContext(ctx).Config
 	updateParsedCache := func(p *Parsed) {
-		status := (*p)["status"].(Parsed)
+		status, ok := (*p)["status"].(Parsed)
+		if !ok {
+			return
+		}
 
 		// Last Reconfig Timestamp source:
 		var lastReconfig string
 		switch StatusConf.ReconfigTimestampSource {
 		case "bird":
-			lastReconfig = status["last_reconfig"].(string)
-			break
+			lastReconfig, _ = status["last_reconfig"].(string)
 		case "config_modified":
 			lastReconfig = lastReconfigTimestampFromFileStat(
-				ClientConf.ConfigFilename,
+				config.ConfigFilename,
 			)
 		case "config_regex":
 			lastReconfig = lastReconfigTimestampFromFileContent(
-				ClientConf.ConfigFilename,
+				config.ConfigFilename,
 				StatusConf.ReconfigTimestampMatch,
 			)
 		}
 
+		if lastReconfig == "" {
+			lastReconfig, _ = status["last_reconfig"].(string)
+		}
+		InstanceFromContext(ctx).checkReconfig(lastReconfig)
+
 		status["last_reconfig"] = lastReconfig
 
 		// Filter fields
@@ -254,74 +521,66 @@ func Status(useCache bool) (Parsed, bool) {
 		}
 	}
 
-	birdStatus, from_cache := RunAndParse(useCache, GetCacheKey("Status"), "status", parseStatus, updateParsedCache)
+	birdStatus, from_cache := RunAndParse(ctx, useCache, GetCacheKey("Status"), "status", parseStatus, updateParsedCache)
 	return birdStatus, from_cache
 }
 
-func ProtocolsShort(useCache bool) (Parsed, bool) {
-	res, from_cache := RunAndParse(useCache, GetCacheKey("ProtocolsShort"), "protocols", parseProtocolsShort, nil)
+func ProtocolsShort(ctx context.Context, useCache bool) (Parsed, bool) {
+	res, from_cache := RunAndParse(ctx, useCache, GetCacheKey("ProtocolsShort"), "protocols", parseProtocolsShort, nil)
 	return res, from_cache
 }
 
-func Protocols(useCache bool) (Parsed, bool) {
-	createMetaCache := func(p *Parsed) {
-		metaProtocol := Parsed{"protocols": Parsed{"bird_protocol": Parsed{}}}
-
-		for key, _ := range (*p)["protocols"].(Parsed) {
-			parsed := (*p)["protocols"].(Parsed)[key].(Parsed)
-			protocol := parsed["protocol"].(string)
-
-			birdProtocol := parsed["bird_protocol"].(string)
-			// Check if the structure for the current birdProtocol already exists inside the metaProtocol cache, if not create it (BGP|Pipe|etc)
-			if _, ok := metaProtocol["protocols"].(Parsed)["bird_protocol"].(Parsed)[birdProtocol]; !ok {
-				metaProtocol["protocols"].(Parsed)["bird_protocol"].(Parsed)[birdProtocol] = Parsed{}
-			}
-			metaProtocol["protocols"].(Parsed)["bird_protocol"].(Parsed)[birdProtocol].(Parsed)[protocol] = &parsed
-		}
-
-		toCache(GetCacheKey("metaProtocol"), metaProtocol)
-	}
-
-	res, from_cache := RunAndParse(useCache, GetCacheKey("Protocols"), "protocols all", parseProtocols, createMetaCache)
+func Protocols(ctx context.Context, useCache bool) (Parsed, bool) {
+	res, from_cache := RunAndParse(ctx, useCache, GetCacheKey("Protocols"), "protocols all", parseProtocols, nil)
 	return res, from_cache
 }
 
-func ProtocolsBgp(useCache bool) (Parsed, bool) {
-	protocols, from_cache := Protocols(useCache)
+// ProtocolsBgp selects the BGP protocols from the
+// result of Protocols. An index of the protocols kept
+// next to the result in the cache would hold pointers,
+// which do not survive the redis or disk cache, and
+// could expire before the result.
+func ProtocolsBgp(ctx context.Context, useCache bool) (Parsed, bool) {
+	protocols, from_cache := Protocols(ctx, useCache)
 	if IsSpecial(protocols) {
 		return protocols, from_cache
 	}
 
-	protocolsMeta, _ := fromCache(GetCacheKey("metaProtocol"))
-	metaProtocol := protocolsMeta["protocols"].(Parsed)
-
 	bgpProtocols := Parsed{}
-
-	for key, protocol := range metaProtocol["bird_protocol"].(Parsed)["BGP"].(Parsed) {
-		bgpProtocols[key] = *(protocol.(*Parsed))
+	all, _ := AsParsed(protocols["protocols"])
+	for key, p := range all {
+		protocol, ok := AsParsed(p)
+		if ok && protocol["bird_protocol"] == "BGP" {
+			bgpProtocols[key] = protocol
+		}
 	}
 
-	return Parsed{"protocols": bgpProtocols,
+	res := Parsed{"protocols": bgpProtocols,
 		"ttl":       protocols["ttl"],
-		"cached_at": protocols["cached_at"]}, from_cache
+		"cached_at": protocols["cached_at"]}
+	if stale, ok := protocols[StaleKey]; ok {
+		res[StaleKey] = stale
+	}
+	return res, from_cache
 }
 
-func Symbols(useCache bool) (Parsed, bool) {
-	return RunAndParse(useCache, GetCacheKey("Symbols"), "symbols", parseSymbols, nil)
+func Symbols(ctx context.Context, useCache bool) (Parsed, bool) {
+	return RunAndParse(ctx, useCache, GetCacheKey("Symbols"), "symbols", parseSymbols, nil)
 }
 
-func routesQuery(filter string) string {
+func routesQuery(ctx context.Context, filter string) string {
 	cmd := "route " + filter
 
-	if getBirdVersion() < 2 || ClientConf.Dualstack {
+	instance := InstanceFromContext(ctx)
+	if getBirdVersion(ctx) < 2 || instance.Config.Dualstack {
 		return cmd
 	}
 
-	return cmd + " where net.type = NET_IP" + IPVersion
+	return cmd + " where net.type = NET_IP" + instance.IPVersion
 }
 
-func remapTable(table string) string {
-	if v := getBirdVersion(); v < 2 {
+func remapTable(ctx context.Context, table string) string {
+	if v := getBirdVersion(ctx); v < 2 {
 		return table // Nothing to do for bird1
 	}
 
@@ -330,16 +589,17 @@ func remapTable(table string) string {
 	}
 
 	// Rewrite master table
-	if IPVersion == "4" {
+	if InstanceFromContext(ctx).IPVersion == "4" {
 		return "master4"
 	}
 
 	return "master6"
 }
 
-func RoutesPrefixed(useCache bool, prefix string) (Parsed, bool) {
-	cmd := routesQuery(prefix + " all")
+func RoutesPrefixed(ctx context.Context, useCache bool, prefix string) (Parsed, bool) {
+	cmd := routesQuery(ctx, prefix+" all")
 	return RunAndParse(
+		ctx,
 		useCache,
 		GetCacheKey("RoutesPrefixed", prefix),
 		cmd,
@@ -347,9 +607,10 @@ func RoutesPrefixed(useCache bool, prefix string) (Parsed, bool) {
 		nil)
 }
 
-func RoutesProto(useCache bool, protocol string) (Parsed, bool) {
-	cmd := routesQuery("all protocol '" + protocol + "'")
+func RoutesProto(ctx context.Context, useCache bool, protocol string) (Parsed, bool) {
+	cmd := routesQuery(ctx, "all protocol '"+protocol+"'")
 	return RunAndParse(
+		ctx,
 		useCache,
 		GetCacheKey("RoutesProto", protocol),
 		cmd,
@@ -357,9 +618,10 @@ func RoutesProto(useCache bool, protocol string) (Parsed, bool) {
 		nil)
 }
 
-func RoutesPeer(useCache bool, peer string) (Parsed, bool) {
+func RoutesPeer(ctx context.Context, useCache bool, peer string) (Parsed, bool) {
 	cmd := "route all where from=" + peer
 	return RunAndParse(
+		ctx,
 		useCache,
 		GetCacheKey("RoutesPeer", peer),
 		cmd,
@@ -367,10 +629,11 @@ func RoutesPeer(useCache bool, peer string) (Parsed, bool) {
 		nil)
 }
 
-func RoutesTableAndPeer(useCache bool, table string, peer string) (Parsed, bool) {
-	table = remapTable(table)
+func RoutesTableAndPeer(ctx context.Context, useCache bool, table string, peer string) (Parsed, bool) {
+	table = remapTable(ctx, table)
 	cmd := "route table '" + table + "' all where from=" + peer
 	return RunAndParse(
+		ctx,
 		useCache,
 		GetCacheKey("RoutesTableAndPeer", table, peer),
 		cmd,
@@ -378,9 +641,10 @@ func RoutesTableAndPeer(useCache bool, table string, peer string) (Parsed, bool)
 		nil)
 }
 
-func RoutesProtoCount(useCache bool, protocol string) (Parsed, bool) {
-	cmd := routesQuery("protocol '" + protocol + "' count")
+func RoutesProtoCount(ctx context.Context, useCache bool, protocol string) (Parsed, bool) {
+	cmd := routesQuery(ctx, "protocol '"+protocol+"' count")
 	return RunAndParse(
+		ctx,
 		useCache,
 		GetCacheKey("RoutesProtoCount", protocol),
 		cmd,
@@ -388,9 +652,10 @@ func RoutesProtoCount(useCache bool, protocol string) (Parsed, bool) {
 		nil)
 }
 
-func RoutesProtoPrimaryCount(useCache bool, protocol string) (Parsed, bool) {
-	cmd := routesQuery("primary protocol '" + protocol + "' count")
+func RoutesProtoPrimaryCount(ctx context.Context, useCache bool, protocol string) (Parsed, bool) {
+	cmd := routesQuery(ctx, "primary protocol '"+protocol+"' count")
 	return RunAndParse(
+		ctx,
 		useCache,
 		GetCacheKey("RoutesProtoPrimaryCount", protocol),
 		cmd,
@@ -398,12 +663,13 @@ func RoutesProtoPrimaryCount(useCache bool, protocol string) (Parsed, bool) {
 		nil)
 }
 
-func PipeRoutesFilteredCount(useCache bool, pipe string, table string, neighborAddress string) (Parsed, bool) {
-	table = remapTable(table)
+func PipeRoutesFilteredCount(ctx context.Context, useCache bool, pipe string, table string, neighborAddress string) (Parsed, bool) {
+	table = remapTable(ctx, table)
 	cmd := "route table '" + table +
 		"' noexport '" + pipe +
 		"' where from='" + neighborAddress + "' count"
 	return RunAndParse(
+		ctx,
 		useCache,
 		GetCacheKey("PipeRoutesFilteredCount", table, pipe, neighborAddress),
 		cmd,
@@ -411,10 +677,11 @@ func PipeRoutesFilteredCount(useCache bool, pipe string, table string, neighborA
 		nil)
 }
 
-func PipeRoutesFiltered(useCache bool, pipe string, table string) (Parsed, bool) {
-	table = remapTable(table)
+func PipeRoutesFiltered(ctx context.Context, useCache bool, pipe string, table string) (Parsed, bool) {
+	table = remapTable(ctx, table)
 	cmd := "route table '" + table + "' noexport '" + pipe + "' all"
 	return RunAndParse(
+		ctx,
 		useCache,
 		GetCacheKey("PipeRoutesFiltered", table, pipe),
 		cmd,
@@ -429,15 +696,17 @@ func PipeRoutesFiltered(useCache bool, pipe string, table string) (Parsed, bool)
 //
 // <r> is the id of the peer belonging to the table <t>
 func PipeRoutesFilteredProtocol(
+	ctx context.Context,
 	useCache bool,
 	pipe string,
 	table string,
 	protocol string,
 ) (Parsed, bool) {
-	table = remapTable(table)
+	table = remapTable(ctx, table)
 	cmd := "route table '" + table + "' noexport '" + pipe + "' protocol '" + protocol + "' all"
 	fmt.Println("CMD:", cmd)
 	return RunAndParse(
+		ctx,
 		useCache,
 		GetCacheKey("PipeRoutesFiltered", table, pipe),
 		cmd,
@@ -445,9 +714,10 @@ func PipeRoutesFilteredProtocol(
 		nil)
 }
 
-func RoutesFiltered(useCache bool, protocol string) (Parsed, bool) {
-	cmd := routesQuery("all filtered protocol '" + protocol + "'")
+func RoutesFiltered(ctx context.Context, useCache bool, protocol string) (Parsed, bool) {
+	cmd := routesQuery(ctx, "all filtered protocol '"+protocol+"'")
 	return RunAndParse(
+		ctx,
 		useCache,
 		GetCacheKey("RoutesFiltered", protocol),
 		cmd,
@@ -455,9 +725,10 @@ func RoutesFiltered(useCache bool, protocol string) (Parsed, bool) {
 		nil)
 }
 
-func RoutesExport(useCache bool, protocol string) (Parsed, bool) {
-	cmd := routesQuery("all export '" + protocol + "'")
+func RoutesExport(ctx context.Context, useCache bool, protocol string) (Parsed, bool) {
+	cmd := routesQuery(ctx, "all export '"+protocol+"'")
 	return RunAndParse(
+		ctx,
 		useCache,
 		GetCacheKey("RoutesExport", protocol),
 		cmd,
@@ -465,9 +736,10 @@ func RoutesExport(useCache bool, protocol string) (Parsed, bool) {
 		nil)
 }
 
-func RoutesNoExport(useCache bool, protocol string) (Parsed, bool) {
-	cmd := routesQuery("all noexport '" + protocol + "'")
+func RoutesNoExport(ctx context.Context, useCache bool, protocol string) (Parsed, bool) {
+	cmd := routesQuery(ctx, "all noexport '"+protocol+"'")
 	return RunAndParse(
+		ctx,
 		useCache,
 		GetCacheKey("RoutesNoExport", protocol),
 		cmd,
@@ -475,9 +747,10 @@ func RoutesNoExport(useCache bool, protocol string) (Parsed, bool) {
 		nil)
 }
 
-func RoutesExportCount(useCache bool, protocol string) (Parsed, bool) {
-	cmd := routesQuery("export '" + protocol + "' count")
+func RoutesExportCount(ctx context.Context, useCache bool, protocol string) (Parsed, bool) {
+	cmd := routesQuery(ctx, "export '"+protocol+"' count")
 	return RunAndParse(
+		ctx,
 		useCache,
 		GetCacheKey("RoutesExportCount", protocol),
 		cmd,
@@ -485,10 +758,11 @@ func RoutesExportCount(useCache bool, protocol string) (Parsed, bool) {
 		nil)
 }
 
-func RoutesTable(useCache bool, table string) (Parsed, bool) {
-	table = remapTable(table)
-	cmd := routesQuery("table '" + table + "' all")
+func RoutesTable(ctx context.Context, useCache bool, table string) (Parsed, bool) {
+	table = remapTable(ctx, table)
+	cmd := routesQuery(ctx, "table '"+table+"' all")
 	return RunAndParse(
+		ctx,
 		useCache,
 		GetCacheKey("RoutesTable", table),
 		cmd,
@@ -496,10 +770,11 @@ func RoutesTable(useCache bool, table string) (Parsed, bool) {
 		nil)
 }
 
-func RoutesTableFiltered(useCache bool, table string) (Parsed, bool) {
-	table = remapTable(table)
-	cmd := routesQuery("table '" + table + "' all filtered")
+func RoutesTableFiltered(ctx context.Context, useCache bool, table string) (Parsed, bool) {
+	table = remapTable(ctx, table)
+	cmd := routesQuery(ctx, "table '"+table+"' all filtered")
 	return RunAndParse(
+		ctx,
 		useCache,
 		GetCacheKey("RoutesTableFiltered", table),
 		cmd,
@@ -507,10 +782,11 @@ func RoutesTableFiltered(useCache bool, table string) (Parsed, bool) {
 		nil)
 }
 
-func RoutesTableCount(useCache bool, table string) (Parsed, bool) {
-	table = remapTable(table)
-	cmd := routesQuery("table '" + table + "' count")
+func RoutesTableCount(ctx context.Context, useCache bool, table string) (Parsed, bool) {
+	table = remapTable(ctx, table)
+	cmd := routesQuery(ctx, "table '"+table+"' count")
 	return RunAndParse(
+		ctx,
 		useCache,
 		GetCacheKey("RoutesTableCount", table),
 		cmd,
@@ -519,10 +795,11 @@ func RoutesTableCount(useCache bool, table string) (Parsed, bool) {
 	)
 }
 
-func RoutesLookupTable(useCache bool, net string, table string) (Parsed, bool) {
-	table = remapTable(table)
-	cmd := routesQuery("for " + net + " table '" + table + "' all")
+func RoutesLookupTable(ctx context.Context, useCache bool, net string, table string) (Parsed, bool) {
+	table = remapTable(ctx, table)
+	cmd := routesQuery(ctx, "for "+net+" table '"+table+"' all")
 	return RunAndParse(
+		ctx,
 		useCache,
 		GetCacheKey("RoutesLookupTable", net, table),
 		cmd,
@@ -530,9 +807,10 @@ func RoutesLookupTable(useCache bool, net string, table string) (Parsed, bool) {
 		nil)
 }
 
-func RoutesLookupProtocol(useCache bool, net string, protocol string) (Parsed, bool) {
-	cmd := routesQuery("for " + net + " protocol '" + protocol + "' all")
+func RoutesLookupProtocol(ctx context.Context, useCache bool, net string, protocol string) (Parsed, bool) {
+	cmd := routesQuery(ctx, "for "+net+" protocol '"+protocol+"' all")
 	return RunAndParse(
+		ctx,
 		useCache,
 		GetCacheKey("RoutesLookupProtocol", net, protocol),
 		cmd,
@@ -540,18 +818,29 @@ func RoutesLookupProtocol(useCache bool, net string, protocol string) (Parsed, b
 		nil)
 }
 
-func getBirdVersion() int {
+func getBirdVersion(ctx context.Context) int {
 	// We assume the bird major version does not change during
 	// the time the birdwatcher is running.
 	//
 	// However, this requires now a restart when going
 	// from bird1 to bird2.
-	if BirdVersion != 0 {
-		return BirdVersion
+	instance := InstanceFromContext(ctx)
+	if v := instance.BirdVersion(); v != 0 {
+		return v
 	}
 
-	// This method is a bit hacky.
-	status, _ := Status(false) // Get status without cache
+	// This method is a bit hacky. The status is cached
+	// with the TTL of the status, not of the caller.
+	status, _ := Status(WithModule(ctx, "status"), false) // Get status without cache
+	v := statusBirdVersion(status)
+	if v != 0 {
+		instance.setBirdVersion(v)
+	}
+	return v
+}
+
+// Get the major version from a result of Status
+func statusBirdVersion(status Parsed) int {
 	if IsSpecial(status) {
 		return 0
 	}
@@ -562,7 +851,7 @@ func getBirdVersion() int {
 	}
 
 	version, ok := birdStatus["version"].(string)
-	if !ok {
+	if !ok || version == "" {
 		return 0
 	}
 
@@ -570,7 +859,5 @@ func getBirdVersion() int {
 	if err != nil {
 		return 0
 	}
-
-	BirdVersion = v
 	return v
 }
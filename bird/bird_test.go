@@ -0,0 +1,182 @@
+package bird
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCacheTTL(t *testing.T) {
+	CacheConf = CacheConfig{TTL: map[string]int{"status": 10, "symbols": 0}}
+	defer func() { CacheConf = CacheConfig{} }()
+
+	instance := NewInstance("", BirdConfig{CacheTtl: 2}, "4")
+	for module, ttl := range map[string]time.Duration{
+		"status":    10 * time.Second,
+		"symbols":   0, // Not cached
+		"protocols": 2 * time.Minute,
+		"":          2 * time.Minute,
+	} {
+		if v := instance.cacheTTL(module); v != ttl {
+			t.Error("Unexpected TTL of", module, v)
+		}
+	}
+
+	instance.Config.CacheTtl = -1
+	if v := instance.cacheTTL("protocols"); v != 5*time.Minute {
+		t.Error("Unexpected default TTL:", v)
+	}
+}
+
+func TestRunAndParseModuleTTL(t *testing.T) {
+	path := startFakeBird(t, map[string]string{
+		"show status": "1000-BIRD 2.0.7\n" +
+			"0013 Daemon is up and running\n",
+	})
+	setupFakeBirdClient(t, path).Config.CacheTtl = 5
+	CacheConf = CacheConfig{TTL: map[string]int{"status": 10}}
+	defer func() { CacheConf = CacheConfig{} }()
+
+	ctx := WithModule(context.Background(), "status")
+	start := time.Now()
+	RunAndParse(ctx, true, "", "status", parseStatus, nil)
+
+	res, err := cache.Get(Default.cacheKey("status"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ttl := res["ttl"].(time.Time)
+	if ttl.Before(start.Add(10*time.Second)) || ttl.After(time.Now().Add(10*time.Second)) {
+		t.Error("Expected the TTL of the module, got:", ttl.Sub(start))
+	}
+}
+
+func TestRunAndParseStale(t *testing.T) {
+	path := startFakeBird(t, map[string]string{
+		"show status": "1000-BIRD 2.0.8\n" +
+			"0013 Daemon is up and running\n",
+	})
+	setupFakeBirdClient(t, path).Config.CacheTtl = 5
+	CacheConf = CacheConfig{MaxStale: 60}
+	defer func() { CacheConf = CacheConfig{} }()
+
+	expired := Parsed{"status": Parsed{"version": "2.0.7"}}
+	cache.Set(Default.cacheKey("status"), expired, 5*time.Minute)
+	expired["ttl"] = time.Now().Add(-10 * time.Second)
+
+	res, fromCache := RunAndParse(context.Background(), true, "", "status", parseStatus, nil)
+	if !fromCache || res[StaleKey] != true {
+		t.Fatal("Expected a stale result, got:", res)
+	}
+	if _, ok := expired[StaleKey]; ok {
+		t.Error("The cached result was modified")
+	}
+
+	// The result is refreshed in the background
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if res, err := cache.Get(Default.cacheKey("status")); err == nil {
+			if res["status"].(Parsed)["version"] != "2.0.8" {
+				t.Error("Unexpected result:", res)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("The result was not refreshed")
+}
+
+func TestRunAndParseMaxStale(t *testing.T) {
+	path := startFakeBird(t, map[string]string{
+		"show status": "1000-BIRD 2.0.8\n" +
+			"0013 Daemon is up and running\n",
+	})
+	setupFakeBirdClient(t, path).Config.CacheTtl = 5
+	CacheConf = CacheConfig{MaxStale: 60}
+	defer func() { CacheConf = CacheConfig{} }()
+
+	expired := Parsed{"status": Parsed{"version": "2.0.7"}}
+	cache.Set(Default.cacheKey("status"), expired, 5*time.Minute)
+	expired["ttl"] = time.Now().Add(-2 * time.Minute)
+
+	res, fromCache := RunAndParse(context.Background(), true, "", "status", parseStatus, nil)
+	if fromCache || res[StaleKey] != nil {
+		t.Error("Expected a fresh result, got:", res)
+	}
+}
+
+func TestProtocolsBgpStale(t *testing.T) {
+	path := startFakeBird(t, map[string]string{
+		"show protocols all": "0000 \n",
+	})
+	setupFakeBirdClient(t, path).Config.CacheTtl = 5
+	CacheConf = CacheConfig{MaxStale: 60}
+	defer func() { CacheConf = CacheConfig{} }()
+
+	expired := Parsed{"protocols": Parsed{
+		"R1": Parsed{"bird_protocol": "BGP", "state": "up"},
+	}}
+	cache.Set(Default.cacheKey("protocols all"), expired, 5*time.Minute)
+	expired["ttl"] = time.Now().Add(-10 * time.Second)
+
+	res, fromCache := ProtocolsBgp(context.Background(), true)
+	if !fromCache || res[StaleKey] != true {
+		t.Error("Expected a stale result, got:", res)
+	}
+}
+
+func TestRunAndParseStaleTimeout(t *testing.T) {
+	path := startSlowFakeBird(t, time.Second, map[string]string{
+		"show status": "1000-BIRD 2.0.8\n" +
+			"0013 Daemon is up and running\n",
+	})
+	instance := setupFakeBirdClient(t, path)
+	instance.Config.CacheTtl = 5
+	CacheConf = CacheConfig{MaxStale: 60}
+	defer func() { CacheConf = CacheConfig{} }()
+
+	expired := Parsed{"status": Parsed{"version": "2.0.7"}}
+	cache.Set(instance.cacheKey("status"), expired, 5*time.Minute)
+	expired["ttl"] = time.Now().Add(-10 * time.Second)
+
+	// The refresh is bounded by the timeout of the request
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if res, _ := RunAndParse(ctx, true, "", "status", parseStatus, nil); res[StaleKey] != true {
+		t.Fatal("Expected a stale result, got:", res)
+	}
+
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		if _, ok := instance.runQueue.Load("status"); !ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("The refresh was not aborted")
+}
+
+func TestGetBirdVersionStatusTTL(t *testing.T) {
+	path := startFakeBird(t, map[string]string{
+		"show status": "1000-BIRD 2.0.8\n" +
+			"0013 Daemon is up and running\n",
+	})
+	instance := setupFakeBirdClient(t, path)
+	instance.Config.CacheTtl = 5
+	CacheConf = CacheConfig{TTL: map[string]int{"status": 10, "routes_table": 1800}}
+	defer func() { CacheConf = CacheConfig{} }()
+
+	ctx := WithModule(context.Background(), "routes_table")
+	start := time.Now()
+	if v := getBirdVersion(ctx); v != 2 {
+		t.Fatal("Unexpected BIRD version:", v)
+	}
+
+	res, err := cache.Get(instance.cacheKey("status"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl := res["ttl"].(time.Time); ttl.After(start.Add(time.Minute)) {
+		t.Error("Expected the TTL of the status, got:", ttl.Sub(start))
+	}
+}
@@ -0,0 +1,106 @@
+package bird
+
+// Inspection and removal of cached results
+
+import (
+	"strings"
+	"sync"
+)
+
+// Hits of the cached results served by this process, by
+// key. The keys stem from client input, so the hits of
+// keys no longer in the cache are dropped.
+type hitCounter struct {
+	sync.Mutex
+	hits map[string]uint64
+}
+
+func newHitCounter() *hitCounter {
+	return &hitCounter{hits: make(map[string]uint64)}
+}
+
+func (h *hitCounter) count(key string) {
+	h.Lock()
+	defer h.Unlock()
+	h.hits[key]++
+}
+
+func (h *hitCounter) get(key string) uint64 {
+	h.Lock()
+	defer h.Unlock()
+	return h.hits[key]
+}
+
+func (h *hitCounter) drop(key string) {
+	h.Lock()
+	defer h.Unlock()
+	delete(h.hits, key)
+}
+
+// Drop the hits of the keys with the prefix, which
+// were not seen in the cache.
+func (h *hitCounter) retain(prefix string, seen map[string]bool) {
+	h.Lock()
+	defer h.Unlock()
+	for key := range h.hits {
+		if strings.HasPrefix(key, prefix) && !seen[key] {
+			delete(h.hits, key)
+		}
+	}
+}
+
+// CacheBackend is the name of the cache implementation
+func CacheBackend() string {
+	switch cache.(type) {
+	case *MemoryCache:
+		return "memory"
+	case *RedisCache:
+		return "redis"
+	case *DiskCache:
+		return "disk"
+	}
+	return ""
+}
+
+// The name of the configured cache, the MemoryCache
+// is used if it is not available.
+func configuredCacheBackend() string {
+	switch {
+	case CacheConf.UseRedis:
+		return "redis"
+	case CacheConf.UseDisk:
+		return "disk"
+	}
+	return "memory"
+}
+
+// CacheEntries lists the cached results of the instance
+// with commands starting with the prefix. The keys are
+// the commands, without the namespace of the instance.
+func (i *Instance) CacheEntries(prefix string) ([]CacheEntry, error) {
+	entries, err := cache.Entries(i.cacheKey(prefix))
+	if err != nil {
+		return nil, err
+	}
+	namespace := i.cacheKey("")
+	for n := range entries {
+		entries[n].Key = strings.TrimPrefix(entries[n].Key, namespace)
+	}
+	return entries, nil
+}
+
+// PurgeCache removes the cached results of the instance
+// with commands starting with the prefix. An empty prefix
+// removes all results of the instance.
+func (i *Instance) PurgeCache(prefix string) int {
+	count := cache.Purge(i.cacheKey(prefix))
+	i.resetWarmup()
+	return count
+}
+
+// DeleteCache removes the cached result of the command
+func (i *Instance) DeleteCache(cmd string) bool {
+	ok := cache.Delete(i.cacheKey(cmd))
+	i.resetWarmup()
+	return ok
+}
@@ -0,0 +1,53 @@
+package bird
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInstanceCacheEntries(t *testing.T) {
+	cache = NewMemoryCache(100)
+	defer func() { cache = nil }()
+
+	unnamed := NewInstance("", BirdConfig{}, "4")
+	blue := NewInstance("blue", BirdConfig{}, "4")
+	for _, key := range []string{
+		"ipv4:status",
+		"ipv4:route all protocol 'R1'",
+		"ipv4:route all protocol 'R2'",
+		"blue_ipv4:route all protocol 'R1'",
+	} {
+		cache.Set(key, Parsed{"foo": "bar"}, 5*time.Minute)
+	}
+	cache.Get("blue_ipv4:route all protocol 'R1'")
+
+	entries, err := blue.CacheEntries("route")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Key != "route all protocol 'R1'" {
+		t.Fatal("Unexpected entries:", entries)
+	}
+	if entries[0].Hits != 1 || entries[0].Size == 0 || entries[0].CachedAt.IsZero() {
+		t.Error("Unexpected entry:", entries[0])
+	}
+	if entries[0].TTL.Sub(entries[0].CachedAt) != 5*time.Minute {
+		t.Error("Unexpected TTL:", entries[0])
+	}
+
+	if !unnamed.DeleteCache("route all protocol 'R2'") {
+		t.Error("Expected the key to be deleted")
+	}
+	if unnamed.DeleteCache("route all protocol 'R2'") {
+		t.Error("Expected the key to be missing")
+	}
+
+	// The namespace of the instance is kept
+	if count := blue.PurgeCache(""); count != 1 {
+		t.Error("Expected 1 purged result, got:", count)
+	}
+	entries, _ = unnamed.CacheEntries("")
+	if len(entries) != 2 || entries[0].Key != "route all protocol 'R1'" || entries[1].Key != "status" {
+		t.Error("Unexpected entries:", entries)
+	}
+}
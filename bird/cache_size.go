@@ -0,0 +1,109 @@
+package bird
+
+// Approximate memory size of cached results
+
+import (
+	"reflect"
+	"time"
+)
+
+// Overheads of the Go runtime representations, on 64 bit
+const (
+	sizeWord      = 8
+	sizeString    = 2 * sizeWord // pointer, length
+	sizeSlice     = 3 * sizeWord // pointer, length, capacity
+	sizeInterface = 2 * sizeWord // type, pointer
+	sizeMapEntry  = 3 * sizeWord // bucket share per entry
+	sizeMap       = 6 * sizeWord
+	sizeTime      = 3 * sizeWord
+)
+
+// Estimate the memory used by a Parsed value. The
+// estimate does not need to be exact, but must grow
+// with the number of routes and attributes.
+func parsedSize(p Parsed) int64 {
+	return valueSize(map[string]interface{}(p))
+}
+
+func valueSize(v interface{}) int64 {
+	// Fast path for the types produced by the parsers
+	switch val := v.(type) {
+	case nil:
+		return 0
+	case string:
+		return sizeString + int64(len(val))
+	case bool:
+		return 1
+	case int, int64, uint64, float64:
+		return sizeWord
+	case time.Time:
+		return sizeTime
+	case Parsed:
+		return mapSize(val)
+	case map[string]interface{}:
+		return mapSize(val)
+	case []Parsed:
+		size := int64(sizeSlice)
+		for _, p := range val {
+			size += sizeWord + mapSize(p)
+		}
+		return size
+	case []interface{}:
+		size := int64(sizeSlice)
+		for _, e := range val {
+			size += sizeInterface + valueSize(e)
+		}
+		return size
+	case []string:
+		size := int64(sizeSlice)
+		for _, s := range val {
+			size += sizeString + int64(len(s))
+		}
+		return size
+	}
+	return reflectSize(reflect.ValueOf(v))
+}
+
+func mapSize(m map[string]interface{}) int64 {
+	size := int64(sizeMap)
+	for k, v := range m {
+		size += sizeMapEntry + sizeString + int64(len(k)) +
+			sizeInterface + valueSize(v)
+	}
+	return size
+}
+
+// Estimate the size of other values, e.g. communities
+func reflectSize(v reflect.Value) int64 {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return 0
+	case reflect.String:
+		return sizeString + int64(v.Len())
+	case reflect.Slice, reflect.Array:
+		size := int64(sizeSlice)
+		for i := 0; i < v.Len(); i++ {
+			size += reflectSize(v.Index(i))
+		}
+		return size
+	case reflect.Map:
+		size := int64(sizeMap)
+		iter := v.MapRange()
+		for iter.Next() {
+			size += sizeMapEntry + reflectSize(iter.Key()) + reflectSize(iter.Value())
+		}
+		return size
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return sizeWord
+		}
+		return sizeWord + reflectSize(v.Elem())
+	case reflect.Struct:
+		size := int64(0)
+		for i := 0; i < v.NumField(); i++ {
+			size += reflectSize(v.Field(i))
+		}
+		return size
+	}
+	return int64(v.Type().Size())
+}
@@ -0,0 +1,287 @@
+package bird
+
+// Native client for the BIRD control socket
+//
+// Instead of running `birdc` for every query, the client
+// connects to the unix socket of the daemon and speaks the
+// CLI protocol directly. See docs/bird-client-server.txt.
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reply codes of the BIRD command-line interface
+// we need to know about.
+const (
+	ReplyOK               = 0
+	ReplyWelcome          = 1
+	ReplyAccessRestricted = 16
+)
+
+// The default timeout for a single query on the socket
+const defaultSocketTimeout = 60 * time.Second
+
+// SocketClient queries BIRD through its control socket.
+// Every query uses a new connection, see SocketPool for
+// persistent connections.
+type SocketClient struct {
+	Path    string
+	Timeout time.Duration
+}
+
+// NewSocketClient creates a new client for the control
+// socket at path, e.g. /run/bird/bird.ctl
+func NewSocketClient(path string) *SocketClient {
+	return &SocketClient{
+		Path:    path,
+		Timeout: defaultSocketTimeout,
+	}
+}
+
+// Run connects to the control socket, enters restricted
+// mode and executes the command. The reply is returned
+// in the same format as printed by birdc. The query is
+// aborted when the context is done.
+func (c *SocketClient) Run(ctx context.Context, cmd string) (io.Reader, error) {
+	buf := &bytes.Buffer{}
+	if err := c.Query(ctx, cmd, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// Query executes the command like Run, but writes the
+// reply to w while it is read from the socket.
+func (c *SocketClient) Query(ctx context.Context, cmd string, w io.Writer) error {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	conn, err := dialSocket(ctx, c.Path)
+	if err != nil {
+		return err
+	}
+	defer conn.close()
+
+	return conn.query(ctx, cmd, c.Timeout, w)
+}
+
+// A socketConn is an established session with the
+// daemon in restricted mode.
+type socketConn struct {
+	conn     net.Conn
+	r        *bufio.Reader
+	lastUsed time.Time
+}
+
+// Connect to the socket, read the welcome message and
+// enter restricted mode.
+func dialSocket(ctx context.Context, path string) (*socketConn, error) {
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &socketConn{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// Read the welcome message
+	code, msg, err := readReply(c.r, ioutil.Discard)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if code != ReplyWelcome {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected greeting from bird: %04d %s", code, msg)
+	}
+
+	if err := enterRestrictedMode(conn, c.r); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Time{})
+	c.lastUsed = time.Now()
+
+	return c, nil
+}
+
+// Execute a command and write the reply to w. The query
+// is aborted when the context is done or the timeout
+// is exceeded.
+func (c *socketConn) query(
+	ctx context.Context,
+	cmd string,
+	timeout time.Duration,
+	w io.Writer,
+) error {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	// Interrupt blocking reads and writes when
+	// the context is cancelled.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	if _, err := fmt.Fprintf(c.conn, "%s\n", cmd); err != nil {
+		return contextError(ctx, err)
+	}
+
+	if _, _, err := readReply(c.r, w); err != nil {
+		return contextError(ctx, err)
+	}
+
+	c.lastUsed = time.Now()
+	return nil
+}
+
+// Check if the connection is still usable: There
+// should be nothing to read and the peer must not
+// have closed the connection.
+func (c *socketConn) alive() bool {
+	c.conn.SetReadDeadline(time.Now().Add(time.Millisecond))
+	_, err := c.r.Peek(1)
+	c.conn.SetReadDeadline(time.Time{})
+
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+	return false
+}
+
+func (c *socketConn) close() error {
+	return c.conn.Close()
+}
+
+// Prefer the context error over the i/o error
+// caused by interrupting the connection.
+func contextError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// Like birdc -r: Restrict the session to read only
+// commands. We refuse to continue if BIRD does not
+// acknowledge this.
+func enterRestrictedMode(w io.Writer, r *bufio.Reader) error {
+	if _, err := io.WriteString(w, "restrict\n"); err != nil {
+		return err
+	}
+
+	code, msg, err := readReply(r, ioutil.Discard)
+	if err != nil {
+		return err
+	}
+	if code != ReplyAccessRestricted {
+		return fmt.Errorf("could not enter restricted mode: %04d %s", code, msg)
+	}
+
+	return nil
+}
+
+// Read a complete reply from the socket and write the
+// text to w without the reply codes - as birdc would.
+//
+// A reply consists of lines prefixed with a four digit
+// reply code. If the code is followed by a '-', the reply
+// continues, a ' ' marks the last line. Lines starting
+// with a space continue the previous code. Lines starting
+// with '+' are spontaneous printouts and are ignored.
+//
+// The code and message of the last line are returned.
+// Run-time and parse-time errors are returned as Error.
+func readReply(r *bufio.Reader, w io.Writer) (int, string, error) {
+	var replyErr *Error
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		code, last, ok := parseReplyCode(line)
+		if !ok {
+			if strings.HasPrefix(line, "+") {
+				continue // spontaneous printout
+			}
+			if len(line) > 0 {
+				line = line[1:]
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return 0, "", err
+			}
+			continue
+		}
+
+		msg := line[5:]
+		if code >= 8000 {
+			if replyErr == nil {
+				replyErr = &Error{Code: code, Message: msg}
+			}
+		} else if code != ReplyOK {
+			if _, err := fmt.Fprintln(w, msg); err != nil {
+				return 0, "", err
+			}
+		}
+		if !last {
+			continue
+		}
+		if replyErr != nil {
+			return replyErr.Code, replyErr.Message, replyErr
+		}
+		return code, msg, nil
+	}
+}
+
+// Get the reply code from a line. The second return value
+// indicates if this is the last line of the reply.
+func parseReplyCode(line string) (int, bool, bool) {
+	if len(line) < 5 {
+		return 0, false, false
+	}
+	if line[4] != ' ' && line[4] != '-' {
+		return 0, false, false
+	}
+	code, err := strconv.Atoi(line[:4])
+	if err != nil || line[0] < '0' || line[0] > '9' {
+		return 0, false, false
+	}
+
+	return code, line[4] == ' ', true
+}
@@ -0,0 +1,200 @@
+package bird
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Start a fake BIRD daemon listening on a unix socket.
+// The replies are looked up by command.
+func startFakeBird(t *testing.T, replies map[string]string) string {
+	return startSlowFakeBird(t, 0, replies)
+}
+
+// Start a fake BIRD daemon, delaying every reply
+func startSlowFakeBird(t *testing.T, delay time.Duration, replies map[string]string) string {
+	path := filepath.Join(t.TempDir(), "bird.ctl")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeBird(conn, delay, replies)
+		}
+	}()
+
+	return path
+}
+
+func serveFakeBird(conn net.Conn, delay time.Duration, replies map[string]string) {
+	defer conn.Close()
+	fmt.Fprint(conn, "0001 BIRD 2.0.7 ready.\n")
+
+	r := bufio.NewReader(conn)
+	for {
+		cmd, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd = strings.TrimSpace(cmd)
+		if cmd == "restrict" {
+			fmt.Fprint(conn, "0016 Access restricted\n")
+			continue
+		}
+		reply, ok := replies[cmd]
+		if !ok {
+			reply = "9001 syntax error, unexpected CF_SYM_UNDEFINED\n"
+		}
+		time.Sleep(delay)
+		fmt.Fprint(conn, reply)
+	}
+}
+
+func TestSocketClientStatus(t *testing.T) {
+	path := startFakeBird(t, map[string]string{
+		"show status": "1000-BIRD 2.0.7\n" +
+			"1011-Router ID is 172.25.3.2\n" +
+			" Current server time is 2021-03-30 02:23:32.330\n" +
+			" Last reboot on 2021-03-30 01:58:07.850\n" +
+			" Last reconfiguration on 2021-03-30 01:58:07.850\n" +
+			"0013 Daemon is up and running\n",
+	})
+
+	out, err := NewSocketClient(path).Run(context.Background(), "show status")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := parseStatus(out)["status"].(Parsed)
+	expected := Parsed{
+		"current_server": "2021-03-30 02:23:32.330",
+		"last_reboot":    "2021-03-30 01:58:07.850",
+		"last_reconfig":  "2021-03-30 01:58:07.850",
+		"message":        "Daemon is up and running",
+		"router_id":      "172.25.3.2",
+		"version":        "2.0.7",
+	}
+	for k, v := range expected {
+		if status[k] != v {
+			t.Error("Expected", k, "to be", v, "got:", status[k])
+		}
+	}
+}
+
+func TestSocketClientRoutes(t *testing.T) {
+	path := startFakeBird(t, map[string]string{
+		"show route all": "1007-1.2.3.0/24          unicast [R192_175 2021-03-30 02:28:25] * (100) [AS4242i]\n" +
+			" \tvia 172.25.3.10 on eth0\n" +
+			"1008-\tType: BGP univ\n" +
+			"1012-\tBGP.origin: IGP\n" +
+			" \tBGP.as_path: 4242\n" +
+			" \tBGP.next_hop: 172.25.3.10\n" +
+			" \tBGP.local_pref: 100\n" +
+			"0000 \n",
+	})
+
+	out, err := NewSocketClient(path).Run(context.Background(), "show route all")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes := parseRoutes(out)["routes"].([]Parsed)
+	if len(routes) != 1 {
+		t.Fatal("Expected 1 route, got:", len(routes))
+	}
+	route := routes[0]
+	if route["network"] != "1.2.3.0/24" {
+		t.Error("Unexpected network:", route["network"])
+	}
+	if route["gateway"] != "172.25.3.10" {
+		t.Error("Unexpected gateway:", route["gateway"])
+	}
+	bgp := route["bgp"].(Parsed)
+	if bgp["local_pref"] != "100" {
+		t.Error("Unexpected local_pref:", bgp["local_pref"])
+	}
+}
+
+func TestSocketClientReplyError(t *testing.T) {
+	path := startFakeBird(t, map[string]string{
+		"show route protocol 'foo'": "8003 No protocols match\n",
+	})
+
+	_, err := NewSocketClient(path).Run(context.Background(), "show route protocol 'foo'")
+	replyErr, ok := err.(*Error)
+	if !ok {
+		t.Fatal("Expected an Error, got:", err)
+	}
+	if replyErr.Code != 8003 {
+		t.Error("Unexpected code:", replyErr.Code)
+	}
+
+	_, err = NewSocketClient(path).Run(context.Background(), "show foo")
+	replyErr, ok = err.(*Error)
+	if !ok || replyErr.Code != 9001 {
+		t.Error("Expected syntax error, got:", err)
+	}
+}
+
+func TestSocketClientNotRestricted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bird.ctl")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, "0001 BIRD 2.0.7 ready.\n")
+		bufio.NewReader(conn).ReadString('\n')
+		fmt.Fprint(conn, "9001 syntax error, unexpected CF_SYM_UNDEFINED\n")
+		ioutil.ReadAll(conn)
+	}()
+
+	if _, err := NewSocketClient(path).Run(context.Background(), "show status"); err == nil {
+		t.Error("Expected an error when restricted mode is refused")
+	}
+}
+
+func TestReadReplyContinuation(t *testing.T) {
+	reply := "2002-Name       Proto      Table      State  Since         Info\n" +
+		"1002-device1    Device     ---        up     2021-03-30 01:58:07\n" +
+		" kernel1    Kernel     master4    up     2021-03-30 01:58:07\n" +
+		"+spontaneous printout\n" +
+		"0000 \n"
+
+	out := &strings.Builder{}
+	code, _, err := readReply(bufio.NewReader(strings.NewReader(reply)), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != ReplyOK {
+		t.Error("Unexpected code:", code)
+	}
+
+	expected := "Name       Proto      Table      State  Since         Info\n" +
+		"device1    Device     ---        up     2021-03-30 01:58:07\n" +
+		"kernel1    Kernel     master4    up     2021-03-30 01:58:07\n"
+	if out.String() != expected {
+		t.Errorf("Unexpected output: %q", out.String())
+	}
+}
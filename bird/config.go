@@ -13,8 +13,22 @@ type BirdConfig struct {
 	Listen         string
 	ConfigFilename string `toml:"config"`
 	BirdCmd        string `toml:"birdc"`
+	Socket         string `toml:"socket"`
+	SocketPoolSize int    `toml:"socket_pool_size"`
+	SocketTimeout  int    `toml:"socket_timeout"`
 	CacheTtl       int    `toml:"ttl"`
 	Dualstack      bool   `toml:"dualstack"`
+
+	// Namespace of the cached results, defaults to the
+	// instance name and IP version, see CacheNamespace.
+	CacheNamespace string `toml:"cache_namespace"`
+}
+
+// InstanceConfig configures a named BIRD daemon,
+// e.g. in a VRF or network namespace.
+type InstanceConfig struct {
+	BirdConfig
+	IPVersion string `toml:"ip_version"` // "4" or "6"
 }
 
 type ParserConfig struct {
@@ -32,6 +46,36 @@ type CacheConfig struct {
 	RedisServer   string `toml:"redis_server"`
 	RedisPassword string `toml:"redis_password"`
 	RedisDb       int    `toml:"redis_db"`
+	// Prefix of all keys, defaults to "birdwatcher:"
+	RedisKeyPrefix string `toml:"redis_key_prefix"`
+
+	// Keep the results in files in the DiskPath directory,
+	// so they survive a restart.
+	UseDisk  bool   `toml:"use_disk"`
+	DiskPath string `toml:"disk_path"`
 
 	MaxKeys int `toml:"max_keys"`
+	// Memory budget of the memory cache in MiB
+	MaxMemory int `toml:"max_memory"`
+
+	// TTL in seconds by module, e.g. "status"
+	TTL map[string]int `toml:"ttl"`
+
+	// Seconds an expired result is served while it
+	// is refreshed. 0 disables serving stale results.
+	MaxStale int `toml:"max_stale"`
+
+	// Remove the cached protocols, routes and symbols when
+	// the last_reconfig of the status changes.
+	InvalidateOnReconfig bool `toml:"invalidate_on_reconfig"`
+	// Seconds between the status queries checking for a
+	// reconfiguration. 0 checks only when the status is
+	// queried anyway.
+	ReconfigCheckInterval int `toml:"reconfig_check_interval"`
+}
+
+type WarmupConfig struct {
+	Interval  int      `toml:"interval"` // Seconds between the runs
+	Modules   []string `toml:"modules"`
+	BgpRoutes bool     `toml:"bgp_routes"` // Routes of established BGP sessions
 }
@@ -0,0 +1,324 @@
+package bird
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The extension of the cache files
+const diskCacheExt = ".cache"
+
+// DiskCache keeps the results in files, so they survive
+// a restart of birdwatcher. Every file starts with a line
+// of metadata, followed by the gzip compressed result.
+// Files are replaced atomically, so concurrent readers
+// always see a complete result.
+type DiskCache struct {
+	dir string
+
+	// Hits by key, counted in memory to avoid rewriting the
+	// files on every read. They are lost on restart.
+	hits *hitCounter
+}
+
+// The first line of a cache file
+type diskCacheMeta struct {
+	Version  int       `json:"version"`
+	Key      string    `json:"key"`
+	CachedAt time.Time `json:"cached_at"`
+	TTL      time.Time `json:"ttl"`
+}
+
+// NewDiskCache creates a DiskCache storing the results
+// in the configured directory.
+func NewDiskCache(config CacheConfig) (*DiskCache, error) {
+	if config.DiskPath == "" {
+		return nil, errors.New("disk_path not set")
+	}
+	if err := os.MkdirAll(config.DiskPath, 0750); err != nil {
+		return nil, err
+	}
+
+	cache := &DiskCache{
+		dir:  config.DiskPath,
+		hits: newHitCounter(),
+	}
+	if err := cache.Ping(context.Background()); err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+// Get the file of a key. Keys are hashed, as they
+// contain arbitrary commands.
+func (c *DiskCache) filename(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+diskCacheExt)
+}
+
+// Get retrieves a result from the disk cache.
+func (c *DiskCache) Get(key string) (Parsed, error) {
+	f, err := os.Open(c.filename(key))
+	if err != nil {
+		if os.IsNotExist(err) { // e.g. removed by another process
+			c.hits.drop(key)
+		}
+		return NilParse, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	meta, err := readDiskCacheMeta(r)
+	if err != nil {
+		return NilParse, err
+	}
+	if meta.Version != cacheFormatVersion {
+		return NilParse, fmt.Errorf("unsupported format for key: %s", key)
+	}
+	if meta.Key != key { // Hash collision
+		return NilParse, fmt.Errorf("key mismatch for key: %s", key)
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return NilParse, err
+	}
+	defer gz.Close()
+
+	parsed := Parsed{}
+	if err := json.NewDecoder(gz).Decode(&parsed); err != nil {
+		return NilParse, err
+	}
+	parsed, err = restoreCachedResult(parsed)
+	if err != nil {
+		return NilParse, fmt.Errorf("%s for key: %s", err, key)
+	}
+
+	ttl, _ := parsed["ttl"].(time.Time)
+	// Like in the other caches, the expired value
+	// is returned along.
+	if !ttl.IsZero() && ttl.Before(time.Now()) {
+		return parsed, fmt.Errorf("TTL expired for key: %s", key)
+	}
+
+	c.hits.count(key)
+
+	return parsed, nil // cache hit
+}
+
+func readDiskCacheMeta(r *bufio.Reader) (diskCacheMeta, error) {
+	meta := diskCacheMeta{}
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return meta, err
+	}
+	err = json.Unmarshal(line, &meta)
+	return meta, err
+}
+
+// Set writes a result to the disk cache.
+func (c *DiskCache) Set(key string, parsed Parsed, ttl time.Duration) error {
+	switch {
+	case ttl == 0:
+		return nil // do not cache
+	case ttl < 0:
+		return fmt.Errorf("negative TTL value for key: %s", key)
+	}
+
+	// The TTL is kept inband, like in the RedisCache
+	cachedAt := time.Now().UTC()
+	entry := make(Parsed, len(parsed)+2)
+	for k, v := range parsed {
+		entry[k] = v
+	}
+	entry["ttl"] = cachedAt.Add(ttl)
+	entry["cached_at"] = cachedAt
+
+	meta, err := json.Marshal(diskCacheMeta{
+		Version:  cacheFormatVersion,
+		Key:      key,
+		CachedAt: cachedAt,
+		TTL:      cachedAt.Add(ttl),
+	})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(c.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Unless renamed
+
+	if err := writeDiskCacheFile(tmp, meta, entry); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.filename(key))
+}
+
+func writeDiskCacheFile(w io.Writer, meta []byte, entry Parsed) error {
+	if _, err := w.Write(append(meta, '\n')); err != nil {
+		return err
+	}
+	gz, err := gzip.NewWriterLevel(w, gzip.BestSpeed)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(gz).Encode(entry); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Visit the metadata of the cache files. The visit
+// function gets the path and size of the file.
+func (c *DiskCache) walk(visit func(meta diskCacheMeta, path string, size int64)) error {
+	files, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, info := range files {
+		if !strings.HasSuffix(info.Name(), diskCacheExt) {
+			continue
+		}
+		path := filepath.Join(c.dir, info.Name())
+		f, err := os.Open(path)
+		if err != nil {
+			continue // Removed meanwhile
+		}
+		meta, err := readDiskCacheMeta(bufio.NewReader(f))
+		f.Close()
+		if err != nil {
+			log.Println("Invalid cache file:", path, err)
+			continue
+		}
+		visit(meta, path, info.Size())
+	}
+	return nil
+}
+
+// Remove the file of a key
+func (c *DiskCache) remove(key, path string) bool {
+	if err := os.Remove(path); err != nil {
+		return false
+	}
+	c.hits.drop(key)
+	return true
+}
+
+// Expire removes the results which expired more than
+// CacheConf.MaxStale ago. The hits of results removed
+// by other processes are dropped.
+func (c *DiskCache) Expire() int {
+	deadline := time.Now().Add(-time.Duration(CacheConf.MaxStale) * time.Second)
+	count := 0
+	seen := map[string]bool{}
+	err := c.walk(func(meta diskCacheMeta, path string, size int64) {
+		if meta.TTL.Before(deadline) && c.remove(meta.Key, path) {
+			count++
+			return
+		}
+		seen[meta.Key] = true
+	})
+	if err != nil {
+		log.Println("Could not expire disk cache:", err)
+	} else {
+		c.hits.retain("", seen)
+	}
+	c.removeTempFiles(time.Hour)
+	return count
+}
+
+// Remove the temporary files left behind, e.g. by a
+// crash while writing.
+func (c *DiskCache) removeTempFiles(age time.Duration) {
+	files, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	for _, info := range files {
+		if strings.HasPrefix(info.Name(), ".tmp-") && time.Since(info.ModTime()) > age {
+			os.Remove(filepath.Join(c.dir, info.Name()))
+		}
+	}
+}
+
+// Purge walks the cache directory and removes the files
+// of the keys starting with the prefix. The keys are read
+// from the files, as the file names are hashed.
+func (c *DiskCache) Purge(prefix string) int {
+	count := 0
+	err := c.walk(func(meta diskCacheMeta, path string, size int64) {
+		if strings.HasPrefix(meta.Key, prefix) && c.remove(meta.Key, path) {
+			count++
+		}
+	})
+	if err != nil {
+		log.Println("Could not purge disk cache:", err)
+	}
+	return count
+}
+
+// Delete removes a key from the disk cache.
+func (c *DiskCache) Delete(key string) bool {
+	return c.remove(key, c.filename(key))
+}
+
+// Entries describes the cached results with keys starting
+// with the prefix, ordered by key. The size is the size of
+// the compressed file, the hits are those served by this
+// process.
+func (c *DiskCache) Entries(prefix string) ([]CacheEntry, error) {
+	entries := []CacheEntry{}
+	seen := map[string]bool{}
+	err := c.walk(func(meta diskCacheMeta, path string, size int64) {
+		if !strings.HasPrefix(meta.Key, prefix) {
+			return
+		}
+		seen[meta.Key] = true
+		entries = append(entries, CacheEntry{
+			Key:      meta.Key,
+			Size:     size,
+			CachedAt: meta.CachedAt,
+			TTL:      meta.TTL,
+			Hits:     c.hits.get(meta.Key),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.hits.retain(prefix, seen)
+
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].Key < entries[b].Key
+	})
+	return entries, nil
+}
+
+// Ping checks that the cache directory is writable
+func (c *DiskCache) Ping(ctx context.Context) error {
+	f, err := ioutil.TempFile(c.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,216 @@
+package bird
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDiskCacheAccess(t *testing.T) {
+	cache, err := NewDiskCache(CacheConfig{DiskPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed := Parsed{
+		"routes": []Parsed{{"network": "10.0.0.0/24"}},
+	}
+	key := "route all protocol 'R1' where net.type = NET_IP4"
+	if err := cache.Set(key, parsed, 5*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := parsed["ttl"]; ok {
+		t.Error("The result was modified")
+	}
+
+	res, err := cache.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The types are restored like in the MemoryCache
+	routes, ok := res["routes"].([]Parsed)
+	if !ok || len(routes) != 1 || routes[0]["network"] != "10.0.0.0/24" {
+		t.Fatal("Unexpected result:", res)
+	}
+	ttl, ok := res["ttl"].(time.Time)
+	if !ok || time.Until(ttl) < 4*time.Minute {
+		t.Error("Unexpected TTL:", res["ttl"])
+	}
+	if _, ok := res["cached_at"].(time.Time); !ok {
+		t.Error("Unexpected cached_at:", res["cached_at"])
+	}
+
+	if _, err := cache.Get("status"); err == nil {
+		t.Error("Expected a missing key")
+	}
+}
+
+func TestDiskCacheExpired(t *testing.T) {
+	cache, err := NewDiskCache(CacheConfig{DiskPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	CacheConf = CacheConfig{MaxStale: 60}
+	defer func() { CacheConf = CacheConfig{} }()
+
+	cache.Set("status", Parsed{"status": "ok"}, time.Nanosecond)
+	cache.Set("protocols", Parsed{"protocols": "ok"}, 5*time.Minute)
+	time.Sleep(time.Millisecond)
+
+	// The expired value is returned along, so it can be
+	// served while it is refreshed.
+	res, err := cache.Get("status")
+	if err == nil || res["status"] != "ok" {
+		t.Error("Expected an expired result:", res, err)
+	}
+
+	// Expired results are kept for MaxStale
+	if count := cache.Expire(); count != 0 {
+		t.Error("Expected no expired keys, got:", count)
+	}
+	CacheConf.MaxStale = 0
+	if count := cache.Expire(); count != 1 {
+		t.Error("Expected 1 expired key, got:", count)
+	}
+	if _, err := cache.Get("protocols"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDiskCacheFormatVersion(t *testing.T) {
+	cache, err := NewDiskCache(CacheConfig{DiskPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A file written by an older release, without version
+	f, err := os.Create(cache.filename("status"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := []byte(`{"key":"status","ttl":"2100-01-01T00:00:00Z"}`)
+	err = writeDiskCacheFile(f, meta, Parsed{"status": "ok"})
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := cache.Get("status")
+	if err == nil || res != nil {
+		t.Error("Expected the result to be ignored:", res)
+	}
+}
+
+func TestDiskCacheEntries(t *testing.T) {
+	cache, err := NewDiskCache(CacheConfig{DiskPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{
+		"status", "route all protocol 'R1'", "route all protocol 'R2'",
+	} {
+		cache.Set(key, Parsed{"foo": "bar"}, 5*time.Minute)
+	}
+	cache.Get("route all protocol 'R1'")
+
+	entries, err := cache.Entries("route")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Key != "route all protocol 'R1'" {
+		t.Fatal("Unexpected entries:", entries)
+	}
+	if entries[0].Hits != 1 || entries[0].Size == 0 || entries[0].TTL.IsZero() {
+		t.Error("Unexpected entry:", entries[0])
+	}
+
+	if !cache.Delete("route all protocol 'R1'") || cache.Delete("route all protocol 'R1'") {
+		t.Error("Expected the key to be deleted once")
+	}
+	if count := cache.Purge("route"); count != 1 {
+		t.Error("Expected 1 purged key, got:", count)
+	}
+	if entries, _ := cache.Entries(""); len(entries) != 1 || entries[0].Key != "status" {
+		t.Error("Unexpected entries:", entries)
+	}
+}
+
+func TestDiskCacheHitsOfRemovedFiles(t *testing.T) {
+	cache, err := NewDiskCache(CacheConfig{DiskPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"status", "protocols"} {
+		cache.Set(key, Parsed{"foo": "bar"}, 5*time.Minute)
+		cache.Get(key)
+	}
+
+	// Files removed by another process
+	os.Remove(cache.filename("status"))
+	os.Remove(cache.filename("protocols"))
+
+	if _, err := cache.Get("status"); err == nil {
+		t.Error("Expected a missing key")
+	}
+	if hits := cache.hits.get("status"); hits != 0 {
+		t.Error("Expected the hits to be dropped, got:", hits)
+	}
+	if _, err := cache.Entries(""); err != nil {
+		t.Fatal(err)
+	}
+	if len(cache.hits.hits) != 0 {
+		t.Error("Expected no hits, got:", cache.hits.hits)
+	}
+}
+
+func TestDiskCacheConcurrentAccess(t *testing.T) {
+	cache, err := NewDiskCache(CacheConfig{DiskPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; n < 20; n++ {
+				cache.Set("status", Parsed{"writer": fmt.Sprint(i)}, 5*time.Minute)
+				if res, err := cache.Get("status"); err != nil || res["writer"] == nil {
+					t.Error("Incomplete result:", res, err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// No temporary files are left behind
+	files, _ := filepath.Glob(filepath.Join(cache.dir, ".tmp-*"))
+	if len(files) != 0 {
+		t.Error("Unexpected files:", files)
+	}
+}
+
+func TestInitializeDiskCache(t *testing.T) {
+	defer func() {
+		CacheConf = CacheConfig{}
+		cache = nil
+		cacheError = nil
+	}()
+
+	CacheConf = CacheConfig{UseDisk: true, DiskPath: t.TempDir()}
+	InitializeCache()
+	if _, ok := cache.(*DiskCache); !ok || cacheError != nil {
+		t.Error("Expected a disk cache:", cache, cacheError)
+	}
+
+	CacheConf = CacheConfig{UseDisk: true}
+	InitializeCache()
+	if _, ok := cache.(*MemoryCache); !ok || cacheError == nil {
+		t.Error("Expected the memory cache as fallback:", cache)
+	}
+}
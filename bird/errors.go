@@ -0,0 +1,169 @@
+package bird
+
+// Errors reported by BIRD and their API representation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+)
+
+// Error is a failed query. Errors reported by BIRD carry
+// the reply code, see BIRD's doc/reply_codes. The Code is
+// 0 if BIRD could not be queried at all.
+type Error struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message"`
+	Command string `json:"command,omitempty"`
+
+	status int // Overrides the HTTP status derived from the code
+}
+
+func (e *Error) Error() string {
+	if e.Code == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("bird replied %04d: %s", e.Code, e.Message)
+}
+
+// HTTPStatus maps the error to a HTTP status code
+func (e *Error) HTTPStatus() int {
+	if e.status != 0 {
+		return e.status
+	}
+
+	switch e.Code {
+	case 0:
+		return http.StatusServiceUnavailable // BIRD unreachable
+	case 8001: // Route not found
+		return http.StatusNotFound
+	case 8003: // No protocols match
+		return http.StatusNotFound
+	case 8004: // Stopped due to reconfiguration
+		return http.StatusServiceUnavailable
+	case 8005: // Protocol is down
+		return http.StatusConflict
+	case 8007: // Access denied
+		return http.StatusForbidden
+	}
+
+	if e.Code >= 9000 { // Parse-time errors, e.g. 9001 syntax error
+		return http.StatusBadRequest
+	}
+	if e.Code == 8008 { // Evaluation runtime error
+		return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
+
+// The error for queries rejected because the request
+// budget is exhausted.
+func errRateLimited(cmd string) *Error {
+	return &Error{
+		Message: "rate limit exceeded",
+		Command: cmd,
+		status:  http.StatusTooManyRequests,
+	}
+}
+
+// NewRequestError creates an error for a request that
+// could not be served, reported with the HTTP status.
+func NewRequestError(status int, message string) *Error {
+	return &Error{
+		Message: message,
+		status:  status,
+	}
+}
+
+// Run-time and parse-time errors are printed by birdc without
+// the reply code. We recognize them by their message.
+var replyMessages = []struct {
+	code   int
+	prefix string
+}{
+	{8000, "Reply too long"},
+	{8001, "Network not found"},
+	{8001, "Network not in table"},
+	{8003, "No protocols match"},
+	{8004, "Stopped due to reconfiguration"},
+	{8005, "Protocol is down"},
+	{8007, "Access denied"},
+	{9000, "Command too long"},
+	{9001, "syntax error"},
+	{9001, "Parse error"},
+}
+
+// Check if the output of birdc is an error reply.
+func errorFromOutput(out []byte) *Error {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	last := strings.TrimSpace(lines[len(lines)-1])
+	for _, reply := range replyMessages {
+		if strings.HasPrefix(last, reply.prefix) {
+			return &Error{Code: reply.code, Message: last}
+		}
+	}
+	return nil
+}
+
+// Make an API error for a failed command
+func newError(cmd string, err error) *Error {
+	switch err {
+	case context.DeadlineExceeded:
+		return &Error{
+			Message: "query timed out",
+			Command: cmd,
+			status:  http.StatusGatewayTimeout,
+		}
+	case context.Canceled:
+		return &Error{
+			Message: "query cancelled",
+			Command: cmd,
+		}
+	}
+
+	switch e := err.(type) {
+	case *Error:
+		res := *e
+		res.Command = cmd
+		return &res
+	case *exec.ExitError:
+		msg := strings.TrimSpace(string(e.Stderr))
+		if msg == "" {
+			msg = e.Error()
+		}
+		return &Error{
+			Message: "bird unreachable: " + msg,
+			Command: cmd,
+		}
+	}
+
+	return &Error{
+		Message: "bird unreachable: " + err.Error(),
+		Command: cmd,
+	}
+}
+
+// BirdError is the result of a query when BIRD is
+// unreachable.
+//
+// Deprecated: Failed queries return an *Error with the
+// reply code and command, use ParsedError to get it.
+var BirdError = errorParsed(&Error{Message: "bird unreachable"})
+
+// Errors are passed as special Parsed values
+func errorParsed(err *Error) Parsed {
+	return Parsed{"error": err}
+}
+
+// ParsedError returns the error if the result is an
+// error value.
+func ParsedError(ret Parsed) (*Error, bool) {
+	if ret == nil {
+		return nil, false
+	}
+	err, ok := ret["error"].(*Error)
+	return err, ok
+}
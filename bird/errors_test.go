@@ -0,0 +1,82 @@
+package bird
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestErrorHTTPStatus(t *testing.T) {
+	tests := []struct {
+		err    *Error
+		status int
+	}{
+		{&Error{Message: "bird unreachable"}, http.StatusServiceUnavailable},
+		{&Error{Code: 8001, Message: "Network not found"}, http.StatusNotFound},
+		{&Error{Code: 8003, Message: "No protocols match"}, http.StatusNotFound},
+		{&Error{Code: 8002, Message: "Configuration file error"}, http.StatusInternalServerError},
+		{&Error{Code: 9000, Message: "Command too long"}, http.StatusBadRequest},
+		{&Error{Code: 9001, Message: "syntax error"}, http.StatusBadRequest},
+		{errRateLimited("show status"), http.StatusTooManyRequests},
+	}
+
+	for _, test := range tests {
+		if status := test.err.HTTPStatus(); status != test.status {
+			t.Error("Expected status", test.status, "for", test.err, "got:", status)
+		}
+	}
+}
+
+func TestBirdError(t *testing.T) {
+	err, ok := ParsedError(BirdError)
+	if !ok || err.HTTPStatus() != http.StatusServiceUnavailable {
+		t.Error("Unexpected error:", BirdError)
+	}
+	if !IsSpecial(BirdError) {
+		t.Error("Expected a special value")
+	}
+}
+
+func TestErrorFromOutput(t *testing.T) {
+	out := "BIRD 2.0.7 ready.\nAccess restricted\nNo protocols match\n"
+	err := errorFromOutput([]byte(out))
+	if err == nil || err.Code != 8003 {
+		t.Error("Expected error 8003, got:", err)
+	}
+
+	out = "BIRD 2.0.7 ready.\nAccess restricted\nsyntax error, unexpected CF_SYM_UNDEFINED\n"
+	err = errorFromOutput([]byte(out))
+	if err == nil || err.Code != 9001 {
+		t.Error("Expected error 9001, got:", err)
+	}
+
+	f, _ := openFile("routes_bird2_ipv4.sample")
+	defer f.Close()
+	buf := make([]byte, 1<<20)
+	n, _ := f.Read(buf)
+	if err := errorFromOutput(buf[:n]); err != nil {
+		t.Error("Unexpected error:", err)
+	}
+}
+
+func TestRunAndParseError(t *testing.T) {
+	path := startFakeBird(t, map[string]string{
+		"show route all protocol 'foo'": "8003 No protocols match\n",
+	})
+	setupFakeBirdClient(t, path)
+
+	res, _ := RunAndParse(context.Background(), true, "", "route all protocol 'foo'", parseRoutes, nil)
+	err, ok := ParsedError(res)
+	if !ok {
+		t.Fatal("Expected an error, got:", res)
+	}
+	if err.Code != 8003 || err.Command != "show route all protocol 'foo'" {
+		t.Error("Unexpected error:", err)
+	}
+	if err.HTTPStatus() != http.StatusNotFound {
+		t.Error("Unexpected status:", err.HTTPStatus())
+	}
+	if !IsSpecial(res) {
+		t.Error("Errors should be special values")
+	}
+}
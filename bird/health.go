@@ -0,0 +1,99 @@
+package bird
+
+// Readiness checks of BIRD and the cache
+
+import (
+	"context"
+	"errors"
+)
+
+// HealthCheck is the result of a readiness check
+type HealthCheck struct {
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+func healthCheck(err error) HealthCheck {
+	if err != nil {
+		return HealthCheck{OK: false, Message: err.Error()}
+	}
+	return HealthCheck{OK: true}
+}
+
+// Check that BIRD answers and the version of BIRD is
+// known. The status is queried directly, so the check
+// neither counts against the rate limit nor is it
+// answered from the cache.
+func checkBird(ctx context.Context) (HealthCheck, HealthCheck) {
+	instance := InstanceFromContext(ctx)
+	out, err := instance.Run(ctx, "status")
+	if err != nil {
+		err = newError("show status", contextError(ctx, err))
+		return healthCheck(err), healthCheck(errors.New("BIRD is unreachable"))
+	}
+
+	if instance.BirdVersion() == 0 {
+		if v := statusBirdVersion(parseStatus(out)); v != 0 {
+			instance.setBirdVersion(v)
+		}
+	}
+	if instance.BirdVersion() == 0 {
+		return healthCheck(nil), healthCheck(errors.New("unknown BIRD version"))
+	}
+	return healthCheck(nil), healthCheck(nil)
+}
+
+// Check that the configured cache backend is connected
+func checkCache(ctx context.Context) HealthCheck {
+	if cacheError != nil {
+		return healthCheck(errors.New(
+			configuredCacheBackend() + " unavailable, using memory cache: " + cacheError.Error()))
+	}
+	if cache == nil {
+		return healthCheck(errors.New("cache not initialized"))
+	}
+	switch c := cache.(type) {
+	case *RedisCache:
+		return healthCheck(c.Ping(ctx))
+	case *DiskCache:
+		return healthCheck(c.Ping(ctx))
+	}
+	return healthCheck(nil)
+}
+
+// Readiness checks if birdwatcher can answer queries
+// for the instance of the context. The results of the
+// checks are returned by name.
+func Readiness(ctx context.Context) (map[string]HealthCheck, bool) {
+	birdCheck, versionCheck := checkBird(ctx)
+	checks := map[string]HealthCheck{
+		"bird":         birdCheck,
+		"bird_version": versionCheck,
+		"cache":        checkCache(ctx),
+	}
+
+	ready := true
+	for _, check := range checks {
+		ready = ready && check.OK
+	}
+	return checks, ready
+}
+
+// InstancesReadiness checks if birdwatcher can answer
+// queries for all of the instances. The checks of BIRD
+// are named by instance, e.g. v4.bird.
+func InstancesReadiness(ctx context.Context, instances []*Instance) (map[string]HealthCheck, bool) {
+	checks := map[string]HealthCheck{}
+	ready := true
+	for _, instance := range instances {
+		instanceChecks, ok := Readiness(WithInstance(ctx, instance))
+		ready = ready && ok
+		for name, check := range instanceChecks {
+			if name != "cache" { // Shared by the instances
+				name = instance.Name + "." + name
+			}
+			checks[name] = check
+		}
+	}
+	return checks, ready
+}
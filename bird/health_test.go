@@ -0,0 +1,66 @@
+package bird
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestReadiness(t *testing.T) {
+	path := startFakeBird(t, map[string]string{
+		"show status": "1000-BIRD 2.0.7\n" +
+			"1011-Router ID is 172.25.3.2\n" +
+			"0013 Daemon is up and running\n",
+	})
+	instance := setupFakeBirdClient(t, path)
+	RateLimitConf.Lock()
+	RateLimitConf.Conf = RateLimitConfig{Enabled: true, Reqs: 0}
+	RateLimitConf.Unlock()
+	defer func() {
+		RateLimitConf.Lock()
+		RateLimitConf.Conf = RateLimitConfig{}
+		RateLimitConf.Unlock()
+	}()
+
+	// The rate limit is exhausted, but not applied
+	checks, ready := Readiness(context.Background())
+	if !ready {
+		t.Error("Expected to be ready:", checks)
+	}
+	if instance.BirdVersion() != 2 {
+		t.Error("Expected the version to be resolved, got:", instance.BirdVersion())
+	}
+}
+
+func TestReadinessUnavailable(t *testing.T) {
+	setupFakeBirdClient(t, "/nonexistent/bird.ctl")
+	cacheError = errors.New("connection refused")
+	defer func() { cacheError = nil }()
+
+	checks, ready := Readiness(context.Background())
+	if ready {
+		t.Error("Expected not to be ready")
+	}
+	for _, name := range []string{"bird", "bird_version", "cache"} {
+		if checks[name].OK || checks[name].Message == "" {
+			t.Error("Expected check to fail:", name, checks[name])
+		}
+	}
+}
+
+func TestInitializeCacheRedisFallback(t *testing.T) {
+	CacheConf = CacheConfig{UseRedis: true, RedisServer: "localhost:1"}
+	defer func() {
+		CacheConf = CacheConfig{}
+		cache = nil
+		cacheError = nil
+	}()
+
+	InitializeCache()
+	if _, ok := cache.(*MemoryCache); !ok {
+		t.Error("Expected fallback to the memory cache, got:", cache)
+	}
+	if check := checkCache(context.Background()); check.OK {
+		t.Error("Expected the cache check to fail")
+	}
+}
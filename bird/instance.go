@@ -0,0 +1,223 @@
+package bird
+
+// Instances of BIRD queried by birdwatcher
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Instance is a BIRD daemon. The queries are sent to
+// the instance of the context, see WithInstance.
+type Instance struct {
+	Name      string
+	Config    BirdConfig
+	IPVersion string
+	Namespace string // Of the results in the cache, see CacheNamespace
+
+	birdVersion int // Detected major version of BIRD
+	versionLock sync.Mutex
+
+	lastReconfig string // From the last status, see checkReconfig
+	reconfigLock sync.Mutex
+
+	socketPool *SocketPool
+	runQueue   sync.Map // queue birdc commands before execution
+
+	warmup warmupState
+
+	metrics *queryMetrics
+}
+
+// NewInstance creates an instance of BIRD with
+// the IP version "4" or "6".
+func NewInstance(name string, config BirdConfig, ipVersion string) *Instance {
+	namespace := config.CacheNamespace
+	if namespace == "" {
+		namespace = CacheNamespace(name, ipVersion)
+	}
+	return &Instance{
+		Name:      name,
+		Config:    config,
+		IPVersion: ipVersion,
+		Namespace: namespace,
+		metrics:   newQueryMetrics(),
+	}
+}
+
+// Default is the instance used if the context
+// does not hold an instance.
+var Default = NewInstance("", BirdConfig{}, "4")
+
+// The named instances, see RegisterInstance
+var namedInstances = struct {
+	sync.RWMutex
+	m map[string]*Instance
+}{m: make(map[string]*Instance)}
+
+// NewNamedInstance creates an instance from the
+// configuration of a named BIRD daemon.
+func NewNamedInstance(name string, config InstanceConfig) (*Instance, error) {
+	if err := ValidateInstanceName(name); err != nil {
+		return nil, err
+	}
+	ipVersion := config.IPVersion
+	switch ipVersion {
+	case "":
+		ipVersion = "4"
+	case "4", "6":
+	default:
+		return nil, fmt.Errorf("instance %s: invalid ip_version: %s", name, ipVersion)
+	}
+	return NewInstance(name, config.BirdConfig, ipVersion), nil
+}
+
+// CacheNamespace is the default namespace of the results
+// of an instance, made of its name and IP version, e.g.
+// "ipv4" or "vrf_blue_ipv6". Instances sharing a cache,
+// like a redis server, need distinct namespaces.
+func CacheNamespace(name, ipVersion string) string {
+	if name == "" {
+		return "ipv" + ipVersion
+	}
+	return name + "_ipv" + ipVersion
+}
+
+// ValidateCacheNamespaces checks that the namespaces of
+// the instances are valid and distinct, so their results
+// are not mixed up in the cache.
+func ValidateCacheNamespaces(instances []*Instance) error {
+	seen := map[string]bool{}
+	for _, i := range instances {
+		if !isValidName(i.Namespace) {
+			return fmt.Errorf("invalid cache namespace: %q", i.Namespace)
+		}
+		if seen[i.Namespace] {
+			return fmt.Errorf("cache namespace used by more than one instance: %s", i.Namespace)
+		}
+		seen[i.Namespace] = true
+	}
+	return nil
+}
+
+// ValidateInstanceName checks that the name can be used
+// in a path and as namespace in the cache.
+func ValidateInstanceName(name string) error {
+	if !isValidName(name) {
+		return fmt.Errorf("invalid instance name: %q", name)
+	}
+	return nil
+}
+
+func isValidName(name string) bool {
+	if name == "" || len(name) > 64 {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '_' || c == '-' || c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// RegisterInstance makes a named instance available
+// by its name.
+func RegisterInstance(instance *Instance) error {
+	namedInstances.Lock()
+	defer namedInstances.Unlock()
+	if _, ok := namedInstances.m[instance.Name]; ok {
+		return fmt.Errorf("duplicate instance: %s", instance.Name)
+	}
+	namedInstances.m[instance.Name] = instance
+	return nil
+}
+
+// GetInstance looks up a named instance
+func GetInstance(name string) (*Instance, bool) {
+	namedInstances.RLock()
+	defer namedInstances.RUnlock()
+	instance, ok := namedInstances.m[name]
+	return instance, ok
+}
+
+// Instances returns the named instances, ordered by name
+func Instances() []*Instance {
+	namedInstances.RLock()
+	defer namedInstances.RUnlock()
+	instances := make([]*Instance, 0, len(namedInstances.m))
+	for _, instance := range namedInstances.m {
+		instances = append(instances, instance)
+	}
+	sort.Slice(instances, func(a, b int) bool {
+		return instances[a].Name < instances[b].Name
+	})
+	return instances
+}
+
+type instanceKey struct{}
+
+// WithInstance returns a context for queries to the instance
+func WithInstance(ctx context.Context, instance *Instance) context.Context {
+	return context.WithValue(ctx, instanceKey{}, instance)
+}
+
+// InstanceFromContext gets the instance queried in
+// the context or the Default instance.
+func InstanceFromContext(ctx context.Context) *Instance {
+	if instance, ok := ctx.Value(instanceKey{}).(*Instance); ok {
+		return instance
+	}
+	return Default
+}
+
+// InitializeSocketPool sets up the persistent connections
+// to the BIRD control socket, if the socket is used
+// instead of birdc.
+func (i *Instance) InitializeSocketPool() {
+	if i.Config.Socket == "" {
+		return
+	}
+
+	size := i.Config.SocketPoolSize
+	if size <= 0 {
+		size = 4
+	}
+	i.socketPool = NewSocketPool(i.Config.Socket, size, i.queryTimeout())
+	log.Println("Initialized SocketPool with size:", size)
+}
+
+// The timeout of a single query, see socket_timeout
+func (i *Instance) queryTimeout() time.Duration {
+	if i.Config.SocketTimeout > 0 {
+		return time.Duration(i.Config.SocketTimeout) * time.Second
+	}
+	return defaultSocketTimeout
+}
+
+// BirdVersion is the major version of BIRD, or 0
+// if it is not known yet.
+func (i *Instance) BirdVersion() int {
+	i.versionLock.Lock()
+	defer i.versionLock.Unlock()
+	return i.birdVersion
+}
+
+func (i *Instance) setBirdVersion(v int) {
+	i.versionLock.Lock()
+	defer i.versionLock.Unlock()
+	i.birdVersion = v
+}
+
+// Results of the instances are kept apart in the
+// shared cache by their namespace.
+func (i *Instance) cacheKey(cmd string) string {
+	return i.Namespace + ":" + cmd
+}
@@ -0,0 +1,117 @@
+package bird
+
+import (
+	"context"
+	"testing"
+)
+
+func TestInstancesFromContext(t *testing.T) {
+	status := func(version string) string {
+		return "1000-BIRD " + version + "\n" +
+			"1011-Router ID is 172.25.3.2\n" +
+			"0013 Daemon is up and running\n"
+	}
+	path4 := startFakeBird(t, map[string]string{"show status": status("2.0.7")})
+	path6 := startFakeBird(t, map[string]string{"show status": status("1.6.8")})
+
+	setupFakeBirdClient(t, path4).Config.CacheTtl = 5
+	v4 := NewInstance("v4", BirdConfig{Socket: path4, CacheTtl: 5}, "4")
+	v6 := NewInstance("v6", BirdConfig{Socket: path6, CacheTtl: 5}, "6")
+
+	for _, tc := range []struct {
+		ctx     context.Context
+		version string
+	}{
+		{context.Background(), "2.0.7"}, // Default
+		{WithInstance(context.Background(), v4), "2.0.7"},
+		{WithInstance(context.Background(), v6), "1.6.8"},
+	} {
+		res, _ := Status(tc.ctx, true)
+		status, err := DecodeStatus(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Version != tc.version {
+			t.Error("Expected version", tc.version, "got:", status.Version)
+		}
+	}
+
+	// The results are cached per instance
+	for _, key := range []string{"ipv4:status", "v4_ipv4:status", "v6_ipv6:status"} {
+		if _, err := cache.Get(key); err != nil {
+			t.Error("Expected cached result:", key, err)
+		}
+	}
+
+	if v := getBirdVersion(WithInstance(context.Background(), v6)); v != 1 {
+		t.Error("Unexpected BIRD version:", v)
+	}
+	if v4.BirdVersion() != 0 {
+		t.Error("Version should be detected per instance")
+	}
+}
+
+func TestRoutesQueryIPVersion(t *testing.T) {
+	v6 := NewInstance("v6", BirdConfig{}, "6")
+	v6.setBirdVersion(2)
+	ctx := WithInstance(context.Background(), v6)
+
+	if cmd := routesQuery(ctx, "all"); cmd != "route all where net.type = NET_IP6" {
+		t.Error("Unexpected query:", cmd)
+	}
+	if table := remapTable(ctx, "master"); table != "master6" {
+		t.Error("Unexpected table:", table)
+	}
+}
+
+func TestNewNamedInstance(t *testing.T) {
+	instance, err := NewNamedInstance("vrf-blue", InstanceConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if instance.IPVersion != "4" {
+		t.Error("Expected IPv4 by default, got:", instance.IPVersion)
+	}
+	if instance.cacheKey("protocols all") != "vrf-blue_ipv4:protocols all" {
+		t.Error("Unexpected cache key:", instance.cacheKey("protocols all"))
+	}
+
+	for _, name := range []string{"", "blue/red", "a b"} {
+		if _, err := NewNamedInstance(name, InstanceConfig{}); err == nil {
+			t.Error("Expected invalid name:", name)
+		}
+	}
+	if _, err := NewNamedInstance("blue", InstanceConfig{IPVersion: "5"}); err == nil {
+		t.Error("Expected invalid ip version")
+	}
+}
+
+func TestCacheNamespace(t *testing.T) {
+	for _, tc := range []struct {
+		instance  *Instance
+		namespace string
+	}{
+		{NewInstance("", BirdConfig{}, "4"), "ipv4"},
+		{NewInstance("", BirdConfig{}, "6"), "ipv6"},
+		{NewInstance("blue", BirdConfig{}, "6"), "blue_ipv6"},
+		{NewInstance("blue", BirdConfig{CacheNamespace: "rs1"}, "4"), "rs1"},
+	} {
+		if tc.instance.Namespace != tc.namespace {
+			t.Error("Expected namespace", tc.namespace, "got:", tc.instance.Namespace)
+		}
+	}
+
+	v4 := NewInstance("", BirdConfig{}, "4")
+	v6 := NewInstance("", BirdConfig{}, "6")
+	if err := ValidateCacheNamespaces([]*Instance{v4, v6}); err != nil {
+		t.Error(err)
+	}
+	shared := NewInstance("blue", BirdConfig{CacheNamespace: "ipv4"}, "4")
+	if err := ValidateCacheNamespaces([]*Instance{v4, shared}); err == nil {
+		t.Error("Expected duplicate namespace")
+	}
+	invalid := NewInstance("", BirdConfig{CacheNamespace: "rs:1"}, "4")
+	if err := ValidateCacheNamespaces([]*Instance{invalid}); err == nil {
+		t.Error("Expected invalid namespace")
+	}
+}
@@ -31,3 +31,7 @@ func (l *lineIterator) next() bool {
 func (l *lineIterator) string() string {
 	return l.scanner.Text()
 }
+
+func (l *lineIterator) err() error {
+	return l.scanner.Err()
+}
@@ -1,70 +1,101 @@
 package bird
 
 import (
+	"container/list"
 	"errors"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
 // MemoryCache is a simple in-memory cache for parsed BIRD output.
-// Limiting the number of cached results is using a simple LRU algorithm.
+// The cached results are limited by number and by their
+// approximate size. The least recently used results are
+// evicted first.
 type MemoryCache struct {
 	sync.Mutex
-	m map[string]Parsed    // Cached data
-	a map[string]time.Time // Access times
+	m   map[string]*list.Element // Cached data
+	lru *list.List               // Most recently used first
 
-	maxKeys int // Maximum number of keys to cache
+	maxKeys  int   // Maximum number of keys to cache, 0 is unlimited
+	maxBytes int64 // Memory budget, 0 is unlimited
+	size     int64 // Approximate size of the cached data
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// A cached result
+type memoryCacheEntry struct {
+	key  string
+	val  Parsed
+	size int64
+	hits uint64
+}
+
+// MemoryCacheStats are the statistics of the MemoryCache
+type MemoryCacheStats struct {
+	Keys      int    `json:"keys"`
+	Bytes     int64  `json:"bytes"`
+	MaxKeys   int    `json:"max_keys"`
+	MaxBytes  int64  `json:"max_bytes"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
 }
 
 // NewMemoryCache creates a new MemoryCache with a maximum number of keys.
 func NewMemoryCache(maxKeys int) *MemoryCache {
-	var cache *MemoryCache
-	cache = &MemoryCache{
-		m: make(map[string]Parsed),
-		a: make(map[string]time.Time),
+	return NewSizedMemoryCache(maxKeys, 0)
+}
 
-		maxKeys: maxKeys,
+// NewSizedMemoryCache creates a new MemoryCache with a maximum
+// number of keys and a memory budget in bytes.
+func NewSizedMemoryCache(maxKeys int, maxBytes int64) *MemoryCache {
+	return &MemoryCache{
+		m:   make(map[string]*list.Element),
+		lru: list.New(),
+
+		maxKeys:  maxKeys,
+		maxBytes: maxBytes,
 	}
-	return cache
 }
 
 // Get a key from the cache.
 func (c *MemoryCache) Get(key string) (Parsed, error) {
 	c.Lock()
-	val, ok := c.m[key]
-	c.a[key] = time.Now().UTC() // Update access
-	c.Unlock()
+	defer c.Unlock()
 
+	elem, ok := c.m[key]
 	if !ok { // cache miss
+		c.misses++
 		return NilParse, errors.New("Failed to retrive key '" + key + "' from MemoryCache.")
 	}
+	entry := elem.Value.(*memoryCacheEntry)
+	val := entry.val
+	c.lru.MoveToFront(elem) // Update access
 
 	// Check if the TTL is still valid
 	ttl, ok := val["ttl"].(time.Time)
 	if !ok {
+		c.misses++
 		return NilParse, errors.New("Invalid TTL value for key '" + key + "'")
 	}
 
 	if ttl.Before(time.Now()) {
+		c.misses++
 		return val, errors.New("TTL expired for key '" + key + "'") // TTL expired
 	}
 
+	c.hits++
+	entry.hits++
 	return val, nil // cache hit
 }
 
 // Set a key in the cache.
-func (c *MemoryCache) Set(key string, val Parsed, ttl int) error {
-	c.Lock()
-	defer c.Unlock()
-
-	// Check if the key exists, if not clear the oldest key if
-	// the number of entries exceeds maxKeys.
-	if _, ok := c.a[key]; !ok {
-		if len(c.a) >= c.maxKeys {
-			c.expireLRU()
-		}
-	}
-
+func (c *MemoryCache) Set(key string, val Parsed, ttl time.Duration) error {
 	if ttl == 0 {
 		return nil // do not cache
 	}
@@ -73,57 +104,173 @@ func (c *MemoryCache) Set(key string, val Parsed, ttl int) error {
 	}
 
 	cachedAt := time.Now().UTC()
-	cacheTTL := cachedAt.Add(time.Duration(ttl) * time.Minute)
+	cacheTTL := cachedAt.Add(ttl)
 
 	// This is not a really ... clean way of doing this.
 	val["ttl"] = cacheTTL
 	val["cached_at"] = cachedAt
 
-	c.m[key] = val
-	c.a[key] = cachedAt
+	// The size is estimated before locking the cache,
+	// as walking large results takes a while.
+	size := int64(len(key)) + parsedSize(val)
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.maxBytes > 0 && size > c.maxBytes {
+		c.remove(key)
+		return errors.New("Value for key '" + key + "' exceeds the memory budget")
+	}
+
+	if elem, ok := c.m[key]; ok {
+		entry := elem.Value.(*memoryCacheEntry)
+		c.size += size - entry.size
+		entry.val = val
+		entry.size = size
+		entry.hits = 0
+		c.lru.MoveToFront(elem)
+	} else {
+		c.m[key] = c.lru.PushFront(&memoryCacheEntry{
+			key:  key,
+			val:  val,
+			size: size,
+		})
+		c.size += size
+	}
+
+	// Evict the least recently used entries until
+	// the cache is within its limits again.
+	for c.exceedsLimits() {
+		c.expireLRU()
+	}
 
 	return nil
 }
 
+// Check the number and size of the entries.
+// WARNING: not thread safe, the mutex must be held.
+func (c *MemoryCache) exceedsLimits() bool {
+	if c.maxKeys > 0 && len(c.m) > c.maxKeys {
+		return true
+	}
+	return c.maxBytes > 0 && c.size > c.maxBytes
+}
+
 // Expire oldest key in cache.
 // WARNING: this is not thread safe and a mutex
 // 		    should be acquired before calling this function.
 func (c *MemoryCache) expireLRU() {
-	oldestKey := ""
-	oldestTime := time.Now().UTC()
-	for key := range c.m {
-		if c.a[key].Before(oldestTime) {
-			oldestKey = key
-			oldestTime = c.a[key]
-		}
-	}
-	if oldestKey == "" {
+	elem := c.lru.Back()
+	if elem == nil {
 		return // Nothing to do here.
 	}
-	delete(c.m, oldestKey)
-	delete(c.a, oldestKey)
+	c.remove(elem.Value.(*memoryCacheEntry).key)
+	c.evictions++
+}
+
+// Remove a key from the cache.
+// WARNING: not thread safe, the mutex must be held.
+func (c *MemoryCache) remove(key string) {
+	elem, ok := c.m[key]
+	if !ok {
+		return
+	}
+	c.size -= elem.Value.(*memoryCacheEntry).size
+	c.lru.Remove(elem)
+	delete(c.m, key)
 }
 
 // Expire all keys in cache that are older than the
-// TTL value.
+// TTL value. Expired results are kept for
+// CacheConf.MaxStale, so they can be served while
+// they are refreshed.
 func (c *MemoryCache) Expire() int {
 	c.Lock()
 	defer c.Unlock()
 
-	now := time.Now().UTC()
+	deadline := time.Now().UTC().Add(-time.Duration(CacheConf.MaxStale) * time.Second)
 
 	expiredKeys := []string{}
-	for key := range c.m {
-		ttl, ok := c.m[key]["ttl"].(time.Time)
-		if !ok || ttl.Before(now) {
+	for key, elem := range c.m {
+		ttl, ok := elem.Value.(*memoryCacheEntry).val["ttl"].(time.Time)
+		if !ok || ttl.Before(deadline) {
 			expiredKeys = append(expiredKeys, key)
 		}
 	}
 
 	for _, key := range expiredKeys {
-		delete(c.m, key)
-		delete(c.a, key)
+		c.remove(key)
 	}
 
 	return len(expiredKeys)
 }
+
+// Purge drops the results with keys starting with the
+// prefix from the map and the LRU list.
+func (c *MemoryCache) Purge(prefix string) int {
+	c.Lock()
+	defer c.Unlock()
+
+	keys := []string{}
+	for key := range c.m {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		c.remove(key)
+	}
+	return len(keys)
+}
+
+// Delete removes a key from the cache.
+func (c *MemoryCache) Delete(key string) bool {
+	c.Lock()
+	defer c.Unlock()
+	_, ok := c.m[key]
+	c.remove(key)
+	return ok
+}
+
+// Entries describes the cached results with keys
+// starting with the prefix, ordered by key.
+func (c *MemoryCache) Entries(prefix string) ([]CacheEntry, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	entries := []CacheEntry{}
+	for key, elem := range c.m {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		entry := elem.Value.(*memoryCacheEntry)
+		ttl, _ := entry.val["ttl"].(time.Time)
+		cachedAt, _ := entry.val["cached_at"].(time.Time)
+		entries = append(entries, CacheEntry{
+			Key:      key,
+			Size:     entry.size,
+			CachedAt: cachedAt,
+			TTL:      ttl,
+			Hits:     entry.hits,
+		})
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].Key < entries[b].Key
+	})
+	return entries, nil
+}
+
+// Stats returns the size and the statistics of the cache.
+func (c *MemoryCache) Stats() MemoryCacheStats {
+	c.Lock()
+	defer c.Unlock()
+	return MemoryCacheStats{
+		Keys:      len(c.m),
+		Bytes:     c.size,
+		MaxKeys:   c.maxKeys,
+		MaxBytes:  c.maxBytes,
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+}
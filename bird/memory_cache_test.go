@@ -1,7 +1,9 @@
 package bird
 
 import (
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestMemoryCacheAccess(t *testing.T) {
@@ -15,7 +17,7 @@ func TestMemoryCacheAccess(t *testing.T) {
 	}
 
 	t.Log("Setting memory cache...")
-	if err := cache.Set("testkey", parsed, 5); err != nil {
+	if err := cache.Set("testkey", parsed, 5*time.Minute); err != nil {
 		t.Error(err)
 	}
 
@@ -54,7 +56,7 @@ func TestMemoryCacheRoutes(t *testing.T) {
 
 	cache := NewMemoryCache(100)
 
-	if err := cache.Set("routes_protocol_test", parsed, 5); err != nil {
+	if err := cache.Set("routes_protocol_test", parsed, 5*time.Minute); err != nil {
 		t.Error(err)
 	}
 
@@ -79,13 +81,13 @@ func TestMemoryCacheMaxEntries(t *testing.T) {
 	}
 
 	// Set 3 entries
-	if err := cache.Set("testkey1", parsed, 5); err != nil {
+	if err := cache.Set("testkey1", parsed, 5*time.Minute); err != nil {
 		t.Error(err)
 	}
-	if err := cache.Set("testkey2", parsed, 5); err != nil {
+	if err := cache.Set("testkey2", parsed, 5*time.Minute); err != nil {
 		t.Error(err)
 	}
-	if err := cache.Set("testkey3", parsed, 5); err != nil {
+	if err := cache.Set("testkey3", parsed, 5*time.Minute); err != nil {
 		t.Error(err)
 	}
 
@@ -136,3 +138,140 @@ func TestMemoryCacheNoCache(t *testing.T) {
 		t.Error("Expected error, got nil")
 	}
 }
+
+func TestMemoryCachePurge(t *testing.T) {
+	cache := NewMemoryCache(100)
+	for _, key := range []string{"protocols all", "protocols", "status", "v4:protocols"} {
+		cache.Set(key, Parsed{}, 5*time.Minute)
+	}
+
+	if count := cache.Purge("protocols"); count != 2 {
+		t.Error("Expected 2 purged keys, got:", count)
+	}
+	for _, key := range []string{"status", "v4:protocols"} {
+		if _, err := cache.Get(key); err != nil {
+			t.Error("Expected cached result:", key, err)
+		}
+	}
+}
+
+func TestMemoryCacheMaxBytes(t *testing.T) {
+	small := func() Parsed { return Parsed{"status": Parsed{"version": "2.0.7"}} }
+	large := Parsed{"routes": make([]Parsed, 0, 100)}
+	for i := 0; i < 100; i++ {
+		large["routes"] = append(large["routes"].([]Parsed), Parsed{
+			"network": "10.0.0.0/24",
+			"gateway": "172.25.3.10",
+		})
+	}
+	smallSize := parsedSize(small()) + 2*sizeTime
+	largeSize := parsedSize(large) + 2*sizeTime
+	if largeSize < 50*smallSize {
+		t.Fatal("Unexpected size estimates:", smallSize, largeSize)
+	}
+
+	cache := NewSizedMemoryCache(0, largeSize+3*smallSize)
+	cache.Set("a", small(), 5*time.Minute)
+	cache.Set("b", small(), 5*time.Minute)
+	cache.Set("c", small(), 5*time.Minute)
+	cache.Get("a") // a is used more recently than b
+
+	// The large result evicts the least recently used
+	if err := cache.Set("large", large, 5*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Get("b"); err == nil {
+		t.Error("Expected b to be evicted")
+	}
+	if _, err := cache.Get("a"); err != nil {
+		t.Error("Expected a to be cached:", err)
+	}
+
+	stats := cache.Stats()
+	if stats.Bytes > stats.MaxBytes || stats.Evictions == 0 {
+		t.Error("Unexpected stats:", stats)
+	}
+	if stats.Hits != 2 || stats.Misses != 1 {
+		t.Error("Unexpected hits and misses:", stats)
+	}
+
+	// Results exceeding the budget are not cached
+	tooLarge := NewSizedMemoryCache(0, smallSize)
+	if err := tooLarge.Set("large", large, 5*time.Minute); err == nil {
+		t.Error("Expected an error")
+	}
+	if stats := tooLarge.Stats(); stats.Keys != 0 || stats.Bytes != 0 {
+		t.Error("Unexpected stats:", stats)
+	}
+}
+
+func TestMemoryCacheSizeAccounting(t *testing.T) {
+	cache := NewMemoryCache(100)
+	cache.Set("a", Parsed{"foo": "bar"}, 5*time.Minute)
+	cache.Set("a", Parsed{"foo": "a much longer value"}, 5*time.Minute)
+	cache.Set("b", Parsed{"foo": "bar"}, 5*time.Minute)
+
+	expected := int64(2) + parsedSize(Parsed{"foo": "a much longer value",
+		"ttl": time.Time{}, "cached_at": time.Time{}}) +
+		parsedSize(Parsed{"foo": "bar", "ttl": time.Time{}, "cached_at": time.Time{}})
+	if stats := cache.Stats(); stats.Bytes != expected || stats.Keys != 2 {
+		t.Error("Unexpected stats:", stats, "expected bytes:", expected)
+	}
+
+	cache.Purge("")
+	if stats := cache.Stats(); stats.Bytes != 0 || stats.Keys != 0 {
+		t.Error("Unexpected stats:", stats)
+	}
+}
+
+func TestMemoryCacheExpireMaxStale(t *testing.T) {
+	cache := NewMemoryCache(10)
+	CacheConf = CacheConfig{MaxStale: 60}
+	defer func() { CacheConf = CacheConfig{} }()
+
+	cache.Set("status", Parsed{"status": "ok"}, time.Nanosecond)
+	cache.Set("protocols", Parsed{"protocols": "ok"}, 5*time.Minute)
+	time.Sleep(time.Millisecond)
+
+	// Expired results are kept for MaxStale
+	if count := cache.Expire(); count != 0 {
+		t.Error("Expected no expired keys, got:", count)
+	}
+	if res, _ := cache.Get("status"); res["status"] != "ok" {
+		t.Error("Expected a stale result, got:", res)
+	}
+
+	CacheConf.MaxStale = 0
+	if count := cache.Expire(); count != 1 {
+		t.Error("Expected 1 expired key, got:", count)
+	}
+	if _, err := cache.Get("protocols"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMemoryCacheConcurrentAccess(t *testing.T) {
+	cache := NewMemoryCache(10)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				cache.Set("status", Parsed{"status": j}, time.Minute)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				cache.Get("status")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if stats := cache.Stats(); stats.Hits+stats.Misses != 800 {
+		t.Error("Unexpected stats:", stats)
+	}
+}
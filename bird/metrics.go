@@ -0,0 +1,228 @@
+package bird
+
+// Metrics of the queries in the Prometheus text format
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The upper bounds of the duration histograms in seconds
+var durationBuckets = []float64{
+	0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60,
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(v float64) {
+	for i, le := range durationBuckets {
+		if v <= le {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// Durations by command
+type durationMetric struct {
+	sync.Mutex
+	values map[string]*histogram
+}
+
+func newDurationMetric() *durationMetric {
+	return &durationMetric{values: make(map[string]*histogram)}
+}
+
+func (m *durationMetric) observe(cmd string, d time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+	h, ok := m.values[cmd]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(durationBuckets))}
+		m.values[cmd] = h
+	}
+	h.observe(d.Seconds())
+}
+
+func (m *durationMetric) write(w io.Writer, name, help, instance string) {
+	m.Lock()
+	defer m.Unlock()
+
+	WriteMetricHeader(w, name, "histogram", help)
+	for _, cmd := range sortedKeys(m.values) {
+		h := m.values[cmd]
+		for i, le := range durationBuckets {
+			WriteMetricSample(w, name+"_bucket", float64(h.counts[i]),
+				"instance", instance, "command", cmd,
+				"le", strconv.FormatFloat(le, 'f', -1, 64))
+		}
+		WriteMetricSample(w, name+"_bucket", float64(h.count),
+			"instance", instance, "command", cmd, "le", "+Inf")
+		WriteMetricSample(w, name+"_sum", h.sum,
+			"instance", instance, "command", cmd)
+		WriteMetricSample(w, name+"_count", float64(h.count),
+			"instance", instance, "command", cmd)
+	}
+}
+
+func sortedKeys(m map[string]*histogram) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// The metrics of the queries of an instance
+type queryMetrics struct {
+	sync.Mutex
+	queryDuration *durationMetric
+	parseDuration *durationMetric
+	cacheHits     uint64
+	cacheMisses   uint64
+	cacheStale    uint64
+	rateLimited   uint64
+}
+
+func newQueryMetrics() *queryMetrics {
+	return &queryMetrics{
+		queryDuration: newDurationMetric(),
+		parseDuration: newDurationMetric(),
+	}
+}
+
+// The command is reported without arguments, like
+// `route` for `route all protocol 'R1'`, to keep the
+// number of series bounded.
+func metricCommand(cmd string) string {
+	return strings.SplitN(cmd, " ", 2)[0]
+}
+
+func (m *queryMetrics) countCacheResult(hit bool) {
+	m.Lock()
+	defer m.Unlock()
+	if hit {
+		m.cacheHits++
+	} else {
+		m.cacheMisses++
+	}
+}
+
+func (m *queryMetrics) countStaleResult() {
+	m.Lock()
+	defer m.Unlock()
+	m.cacheStale++
+}
+
+func (m *queryMetrics) countRateLimited() {
+	m.Lock()
+	defer m.Unlock()
+	m.rateLimited++
+}
+
+func (m *queryMetrics) write(w io.Writer, instance string) {
+	m.queryDuration.write(w,
+		"birdwatcher_bird_query_duration_seconds",
+		"Duration of the queries to BIRD", instance)
+	m.parseDuration.write(w,
+		"birdwatcher_parse_duration_seconds",
+		"Duration of parsing the output of BIRD", instance)
+
+	m.Lock()
+	defer m.Unlock()
+
+	WriteMetricHeader(w, "birdwatcher_cache_requests_total", "counter",
+		"Lookups of results in the cache")
+	WriteMetricSample(w, "birdwatcher_cache_requests_total",
+		float64(m.cacheHits), "instance", instance, "result", "hit")
+	WriteMetricSample(w, "birdwatcher_cache_requests_total",
+		float64(m.cacheMisses), "instance", instance, "result", "miss")
+
+	WriteMetricHeader(w, "birdwatcher_cache_stale_total", "counter",
+		"Expired results served while they are refreshed")
+	WriteMetricSample(w, "birdwatcher_cache_stale_total",
+		float64(m.cacheStale), "instance", instance)
+
+	WriteMetricHeader(w, "birdwatcher_rate_limited_total", "counter",
+		"Queries rejected by the rate limit")
+	WriteMetricSample(w, "birdwatcher_rate_limited_total",
+		float64(m.rateLimited), "instance", instance)
+}
+
+// WriteMetrics writes the metrics of the queries to the
+// instance of the context, labeled with its namespace.
+// The memory cache is shared by the instances, its
+// metrics are written only for the Default instance.
+func WriteMetrics(ctx context.Context, w io.Writer) {
+	instance := InstanceFromContext(ctx)
+	instance.metrics.write(w, instance.Namespace)
+
+	if instance != Default {
+		return
+	}
+	if stats, ok := MemoryCacheStatistics(); ok {
+		writeMemoryCacheMetrics(w, stats)
+	}
+}
+
+func writeMemoryCacheMetrics(w io.Writer, stats MemoryCacheStats) {
+	WriteMetricHeader(w, "birdwatcher_memory_cache_keys", "gauge",
+		"Results in the memory cache")
+	WriteMetricSample(w, "birdwatcher_memory_cache_keys", float64(stats.Keys))
+
+	WriteMetricHeader(w, "birdwatcher_memory_cache_size_bytes", "gauge",
+		"Approximate size of the results in the memory cache")
+	WriteMetricSample(w, "birdwatcher_memory_cache_size_bytes", float64(stats.Bytes))
+
+	if stats.MaxBytes > 0 {
+		WriteMetricHeader(w, "birdwatcher_memory_cache_max_bytes", "gauge",
+			"Memory budget of the memory cache")
+		WriteMetricSample(w, "birdwatcher_memory_cache_max_bytes", float64(stats.MaxBytes))
+	}
+
+	WriteMetricHeader(w, "birdwatcher_memory_cache_evictions_total", "counter",
+		"Results evicted from the memory cache to stay within its limits")
+	WriteMetricSample(w, "birdwatcher_memory_cache_evictions_total", float64(stats.Evictions))
+}
+
+// WriteMetricHeader writes the help and type of a metric
+func WriteMetricHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+// The text format escapes only backslash, double quote
+// and line feed in label values
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WriteMetricSample writes a value of the metric with
+// the labels given as name, value pairs.
+func WriteMetricSample(w io.Writer, name string, value float64, labels ...string) {
+	if len(labels) == 0 {
+		fmt.Fprintf(w, "%s %s\n", name, formatMetricValue(value))
+		return
+	}
+
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+`="`+labelValueEscaper.Replace(labels[i+1])+`"`)
+	}
+	fmt.Fprintf(w, "%s{%s} %s\n",
+		name, strings.Join(pairs, ","), formatMetricValue(value))
+}
+
+func formatMetricValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,108 @@
+package bird
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMetricSample(t *testing.T) {
+	buf := &bytes.Buffer{}
+	WriteMetricSample(buf, "test_total", 42)
+	WriteMetricSample(buf, "test_total", 0.5, "name", `R1 "a"`, "table", "master")
+	WriteMetricSample(buf, "test_total", 1, "description", "Zürich\tC:\\bird\nv2")
+
+	expected := "test_total 42\n" +
+		`test_total{name="R1 \"a\"",table="master"} 0.5` + "\n" +
+		"test_total{description=\"Zürich\tC:\\\\bird\\nv2\"} 1\n"
+	if buf.String() != expected {
+		t.Error("Unexpected samples:", buf.String())
+	}
+}
+
+func TestDurationMetric(t *testing.T) {
+	m := newDurationMetric()
+	m.observe("route", 20*time.Millisecond)
+	m.observe("route", 2*time.Second)
+
+	buf := &bytes.Buffer{}
+	m.write(buf, "test_seconds", "Test", "ipv4")
+	out := buf.String()
+
+	for _, line := range []string{
+		"# TYPE test_seconds histogram",
+		`test_seconds_bucket{instance="ipv4",command="route",le="0.01"} 0`,
+		`test_seconds_bucket{instance="ipv4",command="route",le="0.025"} 1`,
+		`test_seconds_bucket{instance="ipv4",command="route",le="2.5"} 2`,
+		`test_seconds_bucket{instance="ipv4",command="route",le="+Inf"} 2`,
+		`test_seconds_sum{instance="ipv4",command="route"} 2.02`,
+		`test_seconds_count{instance="ipv4",command="route"} 2`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Error("Expected line:", line, out)
+		}
+	}
+}
+
+func TestWriteMetricsByInstance(t *testing.T) {
+	cache = NewMemoryCache(10)
+	defer func() { cache = nil }()
+
+	v6 := NewInstance("", BirdConfig{}, "6")
+	v6.metrics.countCacheResult(true)
+	v6.metrics.countRateLimited()
+
+	buf := &bytes.Buffer{}
+	WriteMetrics(WithInstance(context.Background(), v6), buf)
+	out := buf.String()
+	for _, line := range []string{
+		`birdwatcher_cache_requests_total{instance="ipv6",result="hit"} 1`,
+		`birdwatcher_rate_limited_total{instance="ipv6"} 1`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Error("Expected line:", line, out)
+		}
+	}
+	// The shared memory cache is reported once
+	if strings.Contains(out, "birdwatcher_memory_cache_keys") {
+		t.Error("Unexpected memory cache metrics:", out)
+	}
+
+	buf.Reset()
+	WriteMetrics(context.Background(), buf)
+	out = buf.String()
+	if !strings.Contains(out, `birdwatcher_cache_requests_total{instance="ipv4",result="hit"} 0`) ||
+		!strings.Contains(out, "birdwatcher_memory_cache_keys") {
+		t.Error("Unexpected metrics of the default instance:", out)
+	}
+}
+
+func TestMetricCommand(t *testing.T) {
+	if cmd := metricCommand("route all protocol 'R1'"); cmd != "route" {
+		t.Error("Unexpected command:", cmd)
+	}
+	if cmd := metricCommand("status"); cmd != "status" {
+		t.Error("Unexpected command:", cmd)
+	}
+}
+
+func TestWriteMemoryCacheMetrics(t *testing.T) {
+	buf := &bytes.Buffer{}
+	writeMemoryCacheMetrics(buf, MemoryCacheStats{
+		Keys: 3, Bytes: 2048, MaxBytes: 4096, Evictions: 7,
+	})
+	out := buf.String()
+
+	for _, line := range []string{
+		"birdwatcher_memory_cache_keys 3",
+		"birdwatcher_memory_cache_size_bytes 2048",
+		"birdwatcher_memory_cache_max_bytes 4096",
+		"birdwatcher_memory_cache_evictions_total 7",
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Error("Expected line:", line, out)
+		}
+	}
+}
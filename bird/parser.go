@@ -183,7 +183,9 @@ func parseProtocols(reader io.Reader) Parsed {
 			if !emptyString(proto) {
 				parsed := parseProtocol(proto)
 
-				res[parsed["protocol"].(string)] = parsed
+				if name, ok := parsed["protocol"].(string); ok {
+					res[name] = parsed
+				}
 			}
 			proto = ""
 		} else {
@@ -230,12 +232,19 @@ type blockParsed struct {
 }
 
 func parseRoutes(reader io.Reader) Parsed {
-	jobs := make(chan blockJob)
-	out := startRouteWorkers(jobs)
+	routes := []Parsed{}
+	parseRoutesStream(reader, func(route Parsed) error {
+		routes = append(routes, route)
+		return nil
+	})
 
-	res := startRouteConsumer(out)
-	defer close(res)
+	return Parsed{"routes": routes}
+}
 
+// Split the output into blocks of lines starting with
+// a non whitespace character. The blocks are passed to
+// the send callback, which returns false to stop reading.
+func readRouteBlocks(reader io.Reader, send func(blockJob) bool) error {
 	pos := 0
 	block := []string{}
 	lines := newLineIterator(reader, true)
@@ -244,7 +253,9 @@ func parseRoutes(reader io.Reader) Parsed {
 		line := lines.string()
 
 		if line[0] != 32 && line[0] != 9 && len(block) > 0 {
-			jobs <- blockJob{block, pos}
+			if !send(blockJob{block, pos}) {
+				return nil
+			}
 			pos++
 			block = []string{}
 		}
@@ -253,12 +264,10 @@ func parseRoutes(reader io.Reader) Parsed {
 	}
 
 	if len(block) > 0 {
-		jobs <- blockJob{block, pos}
+		send(blockJob{block, pos})
 	}
 
-	close(jobs)
-
-	return <-res
+	return lines.err()
 }
 
 func startRouteWorkers(jobs chan blockJob) chan blockParsed {
@@ -277,37 +286,6 @@ func startRouteWorkers(jobs chan blockJob) chan blockParsed {
 	return out
 }
 
-func startRouteConsumer(out <-chan blockParsed) chan Parsed {
-	res := make(chan Parsed)
-
-	go func() {
-		byBlock := map[int][]Parsed{}
-		count := 0
-		for r := range out {
-			count++
-			byBlock[r.position] = r.items
-		}
-		res <- Parsed{"routes": sortedSliceForRouteBlocks(byBlock, count)}
-	}()
-
-	return res
-}
-
-func sortedSliceForRouteBlocks(byBlock map[int][]Parsed, numBlocks int) []Parsed {
-	res := []Parsed{}
-
-	for i := 0; i < numBlocks; i++ {
-		routes, ok := byBlock[i]
-		if !ok {
-			continue
-		}
-
-		res = append(res, routes...)
-	}
-
-	return res
-}
-
 func workerForRouteBlockParsing(jobs <-chan blockJob, out chan<- blockParsed, wg *sync.WaitGroup) {
 	for j := range jobs {
 		parseRouteLines(j.lines, j.position, out)
@@ -332,7 +310,7 @@ func parseRouteLines(lines []string, position int, ch chan<- blockParsed) {
 			if len(route) > 0 {
 				routes = append(routes, route)
 
-				formerPrefix = route["network"].(string)
+				formerPrefix, _ = route["network"].(string)
 				route = Parsed{}
 			}
 
@@ -540,14 +518,6 @@ func parseRoutesCount(reader io.Reader) Parsed {
 	return res
 }
 
-func isCorrectChannel(currentIPVersion string) bool {
-	if len(currentIPVersion) == 0 {
-		return true
-	}
-
-	return currentIPVersion == IPVersion
-}
-
 // ProtocolParserState encapsulates the state of the
 // parser and can be accessed by the handlers.
 type ProtocolParserState struct {
@@ -560,10 +530,8 @@ type ProtocolParserState struct {
 // NewProtocolParserState initializes the parser state.
 func NewProtocolParserState() *ProtocolParserState {
 	s := ProtocolParserState{
-		channel: "",
-		result: Parsed{
-			"channels": Parsed{},
-		},
+		channel:      "",
+		result:       Parsed{},
 		routeChanges: Parsed{},
 		channels:     Parsed{},
 	}
@@ -578,13 +546,12 @@ func sumChannelRoutes(routes, channel Parsed) {
 		return
 	}
 	for k, v := range r {
-		val, ok := routes[k].(int64)
-		if ok {
-			val = val + v.(int64)
-			routes[k] = val
-		} else {
-			routes[k] = v.(int64)
+		count, ok := v.(int64)
+		if !ok {
+			continue
 		}
+		val, _ := routes[k].(int64)
+		routes[k] = val + count
 	}
 }
 
@@ -608,12 +575,15 @@ func parseProtocol(lines string) Parsed {
 	}
 
 	result := state.result
+	result["channels"] = state.channels
 	result["route_changes"] = state.routeChanges
 
 	// Calculate routes count from both channels
 	routes := Parsed{}
-	for _, channel := range result["channels"].(Parsed) {
-		sumChannelRoutes(routes, channel.(Parsed))
+	for _, channel := range state.channels {
+		if c, ok := channel.(Parsed); ok {
+			sumChannelRoutes(routes, c)
+		}
 	}
 
 	result["routes"] = routes
@@ -632,7 +602,7 @@ func parseLine(line string, handlers []func(string) bool) {
 func parseProtocolChannel(line string, state *ProtocolParserState) bool {
 	if m := regex.protocol.channel.FindStringSubmatch(line); len(m) > 0 {
 		state.channel = m[1]
-		state.result["channels"].(Parsed)[m[1]] = Parsed{}
+		state.channels[m[1]] = Parsed{}
 		return true
 	}
 
@@ -662,7 +632,7 @@ func parseProtocolHeader(line string, state *ProtocolParserState) bool {
 }
 
 func parseProtocolRouteLine(line string, state *ProtocolParserState) bool {
-	channel, ok := state.result["channels"].(Parsed)[state.channel].(Parsed)
+	channel, ok := state.channels[state.channel].(Parsed)
 	if !ok {
 		return false
 	}
@@ -0,0 +1,261 @@
+package bird
+
+// Persistent connections to the BIRD control socket
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// Reconnect backoff boundaries
+const (
+	minReconnectBackoff = 100 * time.Millisecond
+	maxReconnectBackoff = 5 * time.Second
+)
+
+// Idle connections are checked before they are
+// reused, if they were not used for this duration.
+const idleCheckInterval = 10 * time.Second
+
+// ErrSocketBackoff is returned while the pool waits
+// before trying to reconnect to the daemon.
+var ErrSocketBackoff = errors.New("bird control socket unreachable, waiting to reconnect")
+
+// PoolStats are the current statistics of the pool
+type PoolStats struct {
+	Size   int   `json:"size"`
+	InUse  int   `json:"in_use"`
+	Idle   int   `json:"idle"`
+	Errors int64 `json:"errors"`
+}
+
+// SocketPool maintains a bounded number of persistent
+// connections to the BIRD control socket.
+type SocketPool struct {
+	path    string
+	timeout time.Duration
+
+	slots chan struct{} // Limits the number of connections
+
+	sync.Mutex
+	idle      []*socketConn
+	inUse     int
+	errors    int64
+	backoff   time.Duration
+	nextRetry time.Time
+}
+
+// NewSocketPool creates a pool with at most size connections
+// to the socket at path. Each command must complete
+// within the timeout.
+func NewSocketPool(path string, size int, timeout time.Duration) *SocketPool {
+	return &SocketPool{
+		path:    path,
+		timeout: timeout,
+		slots:   make(chan struct{}, size),
+		idle:    []*socketConn{},
+	}
+}
+
+// Run executes a command on a pooled connection and
+// returns the reply. See Query.
+func (p *SocketPool) Run(ctx context.Context, cmd string) (io.Reader, error) {
+	buf := &bytes.Buffer{}
+	if err := p.Query(ctx, cmd, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// Query executes a command on a pooled connection and writes
+// the reply to w. If all connections are in use, Query waits
+// until a connection is released or the context is done.
+// Waiting, connecting and the query itself must complete
+// within the timeout.
+func (p *SocketPool) Query(ctx context.Context, cmd string, w io.Writer) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-p.slots }()
+
+	p.Lock()
+	p.inUse++
+	p.Unlock()
+	defer func() {
+		p.Lock()
+		p.inUse--
+		p.Unlock()
+	}()
+
+	conn, reused, err := p.acquire(ctx)
+	if err != nil {
+		p.countError()
+		return err
+	}
+
+	out := &countingWriter{w: w}
+	err = conn.query(ctx, cmd, p.timeout, out)
+	if err != nil && reused && out.n == 0 &&
+		ctx.Err() == nil && !isReplyError(err) {
+		// The daemon might have closed the connection
+		// in the meantime, e.g. after a restart. Retry once
+		// with a fresh connection.
+		conn.close()
+		conn, err = p.dial(ctx)
+		if err != nil {
+			p.countError()
+			return err
+		}
+		err = conn.query(ctx, cmd, p.timeout, out)
+	}
+
+	if err != nil && !isReplyError(err) {
+		// The state of the connection is unknown
+		conn.close()
+		p.countError()
+		return err
+	}
+
+	p.release(conn)
+	return err
+}
+
+// Stats returns the current pool statistics.
+func (p *SocketPool) Stats() PoolStats {
+	p.Lock()
+	defer p.Unlock()
+	return PoolStats{
+		Size:   cap(p.slots),
+		InUse:  p.inUse,
+		Idle:   len(p.idle),
+		Errors: p.errors,
+	}
+}
+
+// Close all idle connections
+func (p *SocketPool) Close() {
+	p.Lock()
+	defer p.Unlock()
+	for _, c := range p.idle {
+		c.close()
+	}
+	p.idle = []*socketConn{}
+}
+
+// Get an idle connection or establish a new one.
+// The second return value indicates if the connection
+// was reused.
+func (p *SocketPool) acquire(ctx context.Context) (*socketConn, bool, error) {
+	for {
+		p.Lock()
+		n := len(p.idle)
+		if n == 0 {
+			p.Unlock()
+			break
+		}
+		conn := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.Unlock()
+
+		// Health check connections which were idle for a while
+		if time.Since(conn.lastUsed) < idleCheckInterval || conn.alive() {
+			return conn, true, nil
+		}
+		conn.close()
+	}
+
+	conn, err := p.dial(ctx)
+	return conn, false, err
+}
+
+// Put a connection back into the pool
+func (p *SocketPool) release(conn *socketConn) {
+	p.Lock()
+	defer p.Unlock()
+	p.idle = append(p.idle, conn)
+}
+
+// Connect to the socket. Failed attempts are retried with
+// an exponential backoff, shared by all callers.
+func (p *SocketPool) dial(ctx context.Context) (*socketConn, error) {
+	var lastErr error
+	for {
+		p.Lock()
+		wait := time.Until(p.nextRetry)
+		p.Unlock()
+
+		if wait > 0 {
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+				if lastErr != nil {
+					return nil, lastErr
+				}
+				return nil, ErrSocketBackoff
+			}
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		dialCtx, cancel := context.WithTimeout(ctx, p.timeout)
+		conn, err := dialSocket(dialCtx, p.path)
+		cancel()
+
+		p.Lock()
+		if err == nil {
+			p.backoff = 0
+			p.nextRetry = time.Time{}
+			p.Unlock()
+			return conn, nil
+		}
+		if p.backoff == 0 {
+			p.backoff = minReconnectBackoff
+		} else {
+			p.backoff *= 2
+		}
+		if p.backoff > maxReconnectBackoff {
+			p.backoff = maxReconnectBackoff
+		}
+		p.nextRetry = time.Now().Add(p.backoff)
+		p.Unlock()
+
+		if ctx.Err() != nil || isReplyError(err) {
+			return nil, contextError(ctx, err)
+		}
+		lastErr = err
+	}
+}
+
+func (p *SocketPool) countError() {
+	p.Lock()
+	p.errors++
+	p.Unlock()
+}
+
+// Errors replied by the daemon do not affect the connection
+func isReplyError(err error) bool {
+	_, ok := err.(*Error)
+	return ok
+}
+
+// Count the bytes written
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,191 @@
+package bird
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSocketPoolReuse(t *testing.T) {
+	path := startFakeBird(t, map[string]string{
+		"show status": "1000-BIRD 2.0.7\n0013 Daemon is up and running\n",
+	})
+
+	pool := NewSocketPool(path, 2, time.Second)
+	defer pool.Close()
+
+	for i := 0; i < 5; i++ {
+		out, err := pool.Run(context.Background(), "show status")
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf, _ := ioutil.ReadAll(out)
+		if string(buf) != "BIRD 2.0.7\nDaemon is up and running\n" {
+			t.Errorf("Unexpected output: %q", buf)
+		}
+	}
+
+	stats := pool.Stats()
+	if stats.Idle != 1 || stats.InUse != 0 || stats.Errors != 0 {
+		t.Error("Unexpected stats:", stats)
+	}
+}
+
+func TestSocketPoolBounded(t *testing.T) {
+	path := startFakeBird(t, map[string]string{
+		"show status": "0013 Daemon is up and running\n",
+	})
+
+	pool := NewSocketPool(path, 2, time.Second)
+	defer pool.Close()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := pool.Run(context.Background(), "show status"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := pool.Stats()
+	if stats.Idle > 2 {
+		t.Error("Pool exceeds size:", stats)
+	}
+}
+
+func TestSocketPoolReplyError(t *testing.T) {
+	path := startFakeBird(t, map[string]string{
+		"show route protocol 'foo'": "8003 No protocols match\n",
+	})
+
+	pool := NewSocketPool(path, 1, time.Second)
+	defer pool.Close()
+
+	_, err := pool.Run(context.Background(), "show route protocol 'foo'")
+	if !isReplyError(err) {
+		t.Fatal("Expected a reply error, got:", err)
+	}
+
+	// The connection is still usable
+	stats := pool.Stats()
+	if stats.Idle != 1 || stats.Errors != 0 {
+		t.Error("Unexpected stats:", stats)
+	}
+}
+
+func TestSocketPoolReconnect(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bird.ctl")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// The daemon closes the connection after every command
+	accepted := int32(0)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+			go func() {
+				defer conn.Close()
+				fmt.Fprint(conn, "0001 BIRD 2.0.7 ready.\n")
+				r := bufio.NewReader(conn)
+				r.ReadString('\n')
+				fmt.Fprint(conn, "0016 Access restricted\n")
+				r.ReadString('\n')
+				fmt.Fprint(conn, "0013 Daemon is up and running\n")
+			}()
+		}
+	}()
+
+	pool := NewSocketPool(path, 1, time.Second)
+	defer pool.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, err := pool.Run(context.Background(), "show status"); err != nil {
+			t.Fatal(err)
+		}
+		// Wait for the server to close the connection
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if n := atomic.LoadInt32(&accepted); n != 3 {
+		t.Error("Expected 3 connections, got:", n)
+	}
+}
+
+func TestSocketPoolCancel(t *testing.T) {
+	path := startFakeBird(t, map[string]string{}) // never used
+	hung := filepath.Join(filepath.Dir(path), "hung.ctl")
+	l, err := net.Listen("unix", hung)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// The daemon greets but never answers a command
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				fmt.Fprint(conn, "0001 BIRD 2.0.7 ready.\n")
+				r := bufio.NewReader(conn)
+				r.ReadString('\n')
+				fmt.Fprint(conn, "0016 Access restricted\n")
+				ioutil.ReadAll(r)
+			}()
+		}
+	}()
+
+	pool := NewSocketPool(hung, 1, 10*time.Second)
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = pool.Run(ctx, "show status")
+	if err != context.DeadlineExceeded {
+		t.Error("Expected deadline exceeded, got:", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("Query was not cancelled in time")
+	}
+
+	stats := pool.Stats()
+	if stats.Errors != 1 || stats.InUse != 0 || stats.Idle != 0 {
+		t.Error("Unexpected stats:", stats)
+	}
+}
+
+func TestSocketPoolUnreachable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.ctl")
+	pool := NewSocketPool(path, 1, 200*time.Millisecond)
+
+	start := time.Now()
+	if _, err := pool.Run(context.Background(), "show status"); err == nil {
+		t.Error("Expected an error")
+	}
+	if time.Since(start) > time.Second {
+		t.Error("Connecting was not aborted after the timeout")
+	}
+}
@@ -1,10 +1,14 @@
 package bird
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -13,8 +17,15 @@ import (
 type RedisCache struct {
 	client    *redis.Client
 	keyPrefix string
+
+	// Hits by redis key; redis does not count them and other
+	// processes sharing the database keep their own.
+	hits *hitCounter
 }
 
+// The header of the serialized results in redis
+var redisFormatHeader = fmt.Sprintf("bw%d:", cacheFormatVersion)
+
 func NewRedisCache(config CacheConfig) (*RedisCache, error) {
 
 	client := redis.NewClient(&redis.Options{
@@ -29,8 +40,15 @@ func NewRedisCache(config CacheConfig) (*RedisCache, error) {
 		return nil, err
 	}
 
+	keyPrefix := config.RedisKeyPrefix
+	if keyPrefix == "" {
+		keyPrefix = "birdwatcher:"
+	}
+
 	cache := &RedisCache{
-		client: client,
+		client:    client,
+		keyPrefix: keyPrefix,
+		hits:      newHitCounter(),
 	}
 
 	return cache, nil
@@ -40,44 +58,72 @@ func NewRedisCache(config CacheConfig) (*RedisCache, error) {
 // the redis cache.
 func (self *RedisCache) Get(key string) (Parsed, error) {
 	ctx := context.Background()
-	key = self.keyPrefix + key //"B" + IPVersion + "_" + key
-	data, err := self.client.Get(ctx, key).Result()
+	key = self.keyPrefix + key
+	data, err := self.client.Get(ctx, key).Bytes()
+	if err == redis.Nil { // Expired by redis
+		self.hits.drop(key)
+	}
 	if err != nil {
 		return NilParse, err
 	}
 
+	payload, err := redisPayload(data)
+	if err != nil {
+		return NilParse, fmt.Errorf("%s for key: %s", err, key)
+	}
 	parsed := Parsed{}
-	err = json.Unmarshal([]byte(data), &parsed)
-
-	ttl, err := parseCacheTTL(parsed["ttl"])
+	if err := json.Unmarshal(payload, &parsed); err != nil {
+		return NilParse, err
+	}
+	parsed, err = restoreCachedResult(parsed)
 	if err != nil {
-		return NilParse, fmt.Errorf("invalid TTL value for key: %s", key)
+		return NilParse, fmt.Errorf("%s for key: %s", err, key)
 	}
-	// Deal with the inband TTL if present
+
+	ttl, _ := parsed["ttl"].(time.Time)
+	// Deal with the inband TTL if present. Like in the
+	// MemoryCache, the expired value is returned along.
 	if !ttl.Equal(time.Time{}) && ttl.Before(time.Now()) {
-		return NilParse, err // TTL expired
+		return parsed, fmt.Errorf("TTL expired for key: %s", key)
 	}
 
-	return parsed, err // cache hit
+	self.hits.count(key)
+
+	return parsed, nil // cache hit
 }
 
 // Set adds a birdwatcher `Parsed` result
 // to the redis cache.
-func (self *RedisCache) Set(key string, parsed Parsed, ttl int) error {
+func (self *RedisCache) Set(key string, parsed Parsed, ttl time.Duration) error {
 	switch {
 	case ttl == 0:
 		return nil // do not cache
 
 	case ttl > 0:
-		key = self.keyPrefix + key //TODO "B" + IPVersion + "_" + key
-		payload, err := json.Marshal(parsed)
+		key = self.keyPrefix + key
+
+		// The inband TTL is kept, so expired entries can
+		// be served while they are refreshed.
+		cachedAt := time.Now().UTC()
+		entry := make(Parsed, len(parsed)+2)
+		for k, v := range parsed {
+			entry[k] = v
+		}
+		entry["ttl"] = cachedAt.Add(ttl)
+		entry["cached_at"] = cachedAt
+
+		payload, err := json.Marshal(entry)
 		if err != nil {
 			return err
 		}
+		payload = append([]byte(redisFormatHeader), payload...)
 
+		expire := ttl
+		if CacheConf.MaxStale > 0 {
+			expire += time.Duration(CacheConf.MaxStale) * time.Second
+		}
 		ctx := context.Background()
-		_, err = self.client.Set(
-			ctx, key, payload, time.Duration(ttl)*time.Minute).Result()
+		_, err = self.client.Set(ctx, key, payload, expire).Result()
 		return err
 
 	default: // ttl negative - invalid
@@ -85,11 +131,128 @@ func (self *RedisCache) Set(key string, parsed Parsed, ttl int) error {
 	}
 }
 
+// Get the serialized result, if it is in the
+// current format.
+func redisPayload(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(redisFormatHeader)) {
+		return nil, errors.New("unsupported format")
+	}
+	return data[len(redisFormatHeader):], nil
+}
+
+// Ping checks the connection to the redis server
+func (self *RedisCache) Ping(ctx context.Context) error {
+	return self.client.Ping(ctx).Err()
+}
+
 func (self *RedisCache) Expire() int {
 	log.Printf("Cannot expire entries in RedisCache backend, redis does this automatically")
 	return 0
 }
 
+// Purge scans the redis keys matching the prefix and
+// deletes them one by one, so other keys in the same
+// database are left alone.
+func (self *RedisCache) Purge(prefix string) int {
+	ctx := context.Background()
+	match := redisGlobEscape(self.keyPrefix+prefix) + "*"
+
+	count := 0
+	iter := self.client.Scan(ctx, 0, match, 100).Iterator()
+	for iter.Next(ctx) {
+		n, err := self.client.Del(ctx, iter.Val()).Result()
+		if err != nil {
+			log.Println("Could not purge redis key:", err)
+			continue
+		}
+		self.hits.drop(iter.Val())
+		count += int(n)
+	}
+	if err := iter.Err(); err != nil {
+		log.Println("Could not scan redis keys:", err)
+	}
+	return count
+}
+
+// Delete removes a key from the redis cache.
+func (self *RedisCache) Delete(key string) bool {
+	key = self.keyPrefix + key
+	n, err := self.client.Del(context.Background(), key).Result()
+	if err != nil {
+		log.Println("Could not delete redis key:", err)
+		return false
+	}
+	self.hits.drop(key)
+	return n > 0
+}
+
+// Entries describes the cached results with keys starting
+// with the prefix, ordered by key. Every value is read
+// from redis, so the prefix should be narrow for large
+// caches. The hits are the hits served by this process.
+func (self *RedisCache) Entries(prefix string) ([]CacheEntry, error) {
+	ctx := context.Background()
+	match := redisGlobEscape(self.keyPrefix+prefix) + "*"
+
+	entries := []CacheEntry{}
+	seen := map[string]bool{}
+	iter := self.client.Scan(ctx, 0, match, 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		data, err := self.client.Get(ctx, key).Bytes()
+		if err == redis.Nil {
+			continue // Expired meanwhile
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		payload, err := redisPayload(data)
+		if err != nil {
+			continue // Written by another release
+		}
+
+		// Only the metadata is decoded
+		meta := struct {
+			TTL      time.Time `json:"ttl"`
+			CachedAt time.Time `json:"cached_at"`
+		}{}
+		json.Unmarshal(payload, &meta)
+
+		seen[key] = true
+		entries = append(entries, CacheEntry{
+			Key:      strings.TrimPrefix(key, self.keyPrefix),
+			Size:     int64(len(data)),
+			CachedAt: meta.CachedAt,
+			TTL:      meta.TTL,
+			Hits:     self.hits.get(key),
+		})
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	self.hits.retain(self.keyPrefix+prefix, seen)
+
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].Key < entries[b].Key
+	})
+	return entries, nil
+}
+
+// Escape the special characters of a redis
+// glob pattern, e.g. in "route table 'master'"
+func redisGlobEscape(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
 // Helperfunction to decode the cache ttl stored
 // in the cache - which will most likely just be
 // RFC3339 timestamp.
@@ -111,3 +274,55 @@ func parseCacheTTL(cacheTTL interface{}) (time.Time, error) {
 	}
 	return time.Time{}, nil
 }
+
+// Restore the types of a result decoded from JSON, as
+// the consumers expect them from the MemoryCache:
+// objects become Parsed, lists of objects []Parsed and
+// the cache timestamps time.Time.
+func restoreCachedResult(parsed Parsed) (Parsed, error) {
+	res := restoreParsed(parsed)
+	for _, key := range []string{"ttl", "cached_at"} {
+		if _, ok := res[key]; !ok {
+			continue
+		}
+		t, err := parseCacheTTL(res[key])
+		if err != nil {
+			return NilParse, fmt.Errorf("invalid %s: %s", key, err)
+		}
+		res[key] = t
+	}
+	return res, nil
+}
+
+func restoreParsed(m map[string]interface{}) Parsed {
+	res := make(Parsed, len(m))
+	for k, v := range m {
+		res[k] = restoreValue(v)
+	}
+	return res
+}
+
+func restoreValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return restoreParsed(v)
+	case []interface{}:
+		objects := make([]Parsed, 0, len(v))
+		for _, e := range v {
+			obj, ok := e.(map[string]interface{})
+			if !ok {
+				break
+			}
+			objects = append(objects, restoreParsed(obj))
+		}
+		if len(objects) == len(v) {
+			return objects
+		}
+		values := make([]interface{}, len(v))
+		for i, e := range v {
+			values[i] = restoreValue(e)
+		}
+		return values
+	}
+	return value
+}
@@ -25,7 +25,7 @@ func Test_RedisCacheAccess(t *testing.T) {
 	}
 
 	t.Log("Setting redis cache...")
-	err = cache.Set("testkey", parsed, 5)
+	err = cache.Set("testkey", parsed, 5*time.Minute)
 	if err != nil {
 		t.Error(err)
 	}
@@ -82,7 +82,7 @@ func Test_RedisCacheRoutes(t *testing.T) {
 		return
 	}
 
-	err = cache.Set("routes_protocol_test", parsed, 5)
+	err = cache.Set("routes_protocol_test", parsed, 5*time.Minute)
 	if err != nil {
 		t.Error(err)
 	}
@@ -100,3 +100,46 @@ func Test_RedisCacheRoutes(t *testing.T) {
 
 	t.Log("Retrieved routes:", len(routes))
 }
+
+func TestRedisGlobEscape(t *testing.T) {
+	escaped := redisGlobEscape("v4:route table 'T*' [a]?")
+	if escaped != `v4:route table 'T\*' \[a\]\?` {
+		t.Error("Unexpected pattern:", escaped)
+	}
+}
+
+func TestRedisPayload(t *testing.T) {
+	payload, err := redisPayload([]byte(redisFormatHeader + `{"foo":"bar"}`))
+	if err != nil || string(payload) != `{"foo":"bar"}` {
+		t.Error("Unexpected payload:", string(payload), err)
+	}
+
+	// Results of older releases are plain JSON
+	if _, err := redisPayload([]byte(`{"foo":"bar"}`)); err == nil {
+		t.Error("Expected unsupported format")
+	}
+	if _, err := redisPayload([]byte(`bw0:{"foo":"bar"}`)); err == nil {
+		t.Error("Expected unsupported format")
+	}
+}
+
+func Test_RedisCachePurge(t *testing.T) {
+	cache, err := NewRedisCache(CacheConfig{
+		RedisServer: "localhost:6379",
+	})
+	if err != nil {
+		t.Log("Redis server not available:", err)
+		t.Log("Skipping redis tests.")
+		return
+	}
+
+	cache.Set("purge_test:route all", Parsed{}, 5*time.Minute)
+	cache.Set("purge_test:status", Parsed{}, 5*time.Minute)
+
+	if count := cache.Purge("purge_test:route"); count != 1 {
+		t.Error("Expected 1 purged key, got:", count)
+	}
+	if _, err := cache.Get("purge_test:status"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,245 @@
+package bird
+
+// Streaming of parsed routes
+//
+// Instead of collecting all routes of a large table in
+// memory, the routes are passed to a callback as soon
+// as they are parsed.
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// The maximum number of route blocks parsed ahead of
+// the block which is emitted next
+var routeStreamWindow = 64
+
+// Parse the routes and pass them to emit in the order
+// of the output. The routes are parsed concurrently,
+// but at most routeStreamWindow blocks are held in memory.
+// Parsing stops if emit returns an error.
+func parseRoutesStream(reader io.Reader, emit func(Parsed) error) error {
+	jobs := make(chan blockJob)
+	out := startRouteWorkers(jobs)
+
+	window := make(chan struct{}, routeStreamWindow)
+	stop := make(chan struct{})
+	readErr := make(chan error, 1)
+
+	go func() {
+		defer close(jobs)
+		readErr <- readRouteBlocks(reader, func(job blockJob) bool {
+			select {
+			case window <- struct{}{}:
+			case <-stop:
+				return false
+			}
+			jobs <- job
+			return true
+		})
+	}()
+
+	// Reorder the parsed blocks
+	var emitErr error
+	pending := map[int][]Parsed{}
+	next := 0
+	for block := range out {
+		pending[block.position] = block.items
+		for {
+			routes, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			<-window
+
+			if emitErr != nil {
+				continue // Drain the workers
+			}
+			for _, route := range routes {
+				if emitErr = emit(route); emitErr != nil {
+					close(stop)
+					break
+				}
+			}
+		}
+	}
+
+	if emitErr != nil {
+		return emitErr
+	}
+	return <-readErr
+}
+
+// RunStream executes a show command on the instance of
+// the context, see Instance.RunStream.
+func RunStream(ctx context.Context, args string) (io.ReadCloser, error) {
+	return InstanceFromContext(ctx).RunStream(ctx, args)
+}
+
+// RunStream executes a show command like Run, but the
+// output is read while the command is running. The reader
+// must be closed.
+func (i *Instance) RunStream(ctx context.Context, args string) (io.ReadCloser, error) {
+	if i.socketPool != nil {
+		r, w := io.Pipe()
+		go func() {
+			w.CloseWithError(i.socketPool.Query(ctx, "show "+args, w))
+		}()
+		return r, nil
+	}
+	if i.Config.Socket != "" {
+		r, w := io.Pipe()
+		go func() {
+			w.CloseWithError(NewSocketClient(i.Config.Socket).Query(ctx, "show "+args, w))
+		}()
+		return r, nil
+	}
+	return i.runBirdcStream(ctx, args)
+}
+
+// The output of birdc, read while birdc is running
+type birdcStream struct {
+	cmd    *exec.Cmd
+	out    io.ReadCloser
+	stderr *bytes.Buffer
+	tail   []byte
+	done   bool
+}
+
+func (i *Instance) runBirdcStream(ctx context.Context, args string) (io.ReadCloser, error) {
+	cmd := i.birdcCommand(ctx, args)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return &birdcStream{cmd: cmd, out: out, stderr: stderr}, nil
+}
+
+// Read the output. When reaching the end, errors printed
+// by birdc or the exit status are returned.
+func (s *birdcStream) Read(p []byte) (int, error) {
+	n, err := s.out.Read(p)
+
+	// Keep the end of the output for checking errors
+	s.tail = append(s.tail, p[:n]...)
+	if len(s.tail) > 1024 {
+		s.tail = s.tail[len(s.tail)-512:]
+	}
+
+	if err != io.EOF {
+		return n, err
+	}
+
+	s.done = true
+	if err := s.cmd.Wait(); err != nil {
+		if msg := strings.TrimSpace(s.stderr.String()); msg != "" {
+			return n, &Error{Message: "bird unreachable: " + msg}
+		}
+		return n, err
+	}
+	if replyErr := errorFromOutput(s.tail); replyErr != nil {
+		return n, replyErr
+	}
+
+	return n, io.EOF
+}
+
+func (s *birdcStream) Close() error {
+	if s.done {
+		return nil
+	}
+	s.out.Close()
+	s.done = true
+	return s.cmd.Wait()
+}
+
+// Run a routes query and pass the routes to emit
+func streamRoutes(ctx context.Context, cmd string, emit func(Parsed) error) Parsed {
+	metrics := InstanceFromContext(ctx).metrics
+	if !checkRateLimit() {
+		metrics.countRateLimited()
+		return errorParsed(errRateLimited("show " + cmd))
+	}
+
+	start := time.Now()
+	defer func() {
+		metrics.queryDuration.observe(metricCommand(cmd), time.Since(start))
+	}()
+
+	out, err := RunStream(ctx, cmd)
+	if err != nil {
+		return errorParsed(newError("show "+cmd, contextError(ctx, err)))
+	}
+	defer out.Close()
+
+	// Errors while writing the routes are passed on
+	var emitErr error
+	err = parseRoutesStream(&contextReader{ctx: ctx, r: out}, func(route Parsed) error {
+		emitErr = emit(route)
+		return emitErr
+	})
+	if emitErr != nil {
+		return errorParsed(newError("show "+cmd, emitErr))
+	}
+	if err != nil {
+		return errorParsed(newError("show "+cmd, contextError(ctx, err)))
+	}
+
+	return nil
+}
+
+// Stream the routes of a query, unless a cached result
+// is available. The cached result is returned instead.
+// Streamed results are not cached.
+func streamRoutesCached(
+	ctx context.Context,
+	useCache bool,
+	cmd string,
+	emit func(Parsed) error,
+) (Parsed, bool) {
+	if useCache {
+		if val, ok := InstanceFromContext(ctx).fromCache(cmd); ok {
+			return val, true
+		}
+	}
+	return streamRoutes(ctx, cmd, emit), false
+}
+
+// RoutesProtoStream passes the routes of a protocol to emit
+// while they are parsed. A cached result is returned
+// instead, if available. On success nil is returned.
+func RoutesProtoStream(
+	ctx context.Context,
+	useCache bool,
+	protocol string,
+	emit func(Parsed) error,
+) (Parsed, bool) {
+	cmd := routesQuery(ctx, "all protocol '"+protocol+"'")
+	return streamRoutesCached(ctx, useCache, cmd, emit)
+}
+
+// RoutesTableStream passes the routes of a table to emit
+// while they are parsed. See RoutesProtoStream.
+func RoutesTableStream(
+	ctx context.Context,
+	useCache bool,
+	table string,
+	emit func(Parsed) error,
+) (Parsed, bool) {
+	table = remapTable(ctx, table)
+	cmd := routesQuery(ctx, "table '"+table+"' all")
+	return streamRoutesCached(ctx, useCache, cmd, emit)
+}
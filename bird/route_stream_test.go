@@ -0,0 +1,175 @@
+package bird
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRoutesStreamOrder(t *testing.T) {
+	files := []string{
+		"routes_bird1_ipv4.sample",
+		"routes_bird2_ipv4.sample",
+		"routes_bird3_ipv6.sample",
+	}
+
+	defer func(window, workers int) {
+		routeStreamWindow = window
+		WorkerPoolSize = workers
+	}(routeStreamWindow, WorkerPoolSize)
+	routeStreamWindow = 2
+	WorkerPoolSize = 4
+
+	for _, file := range files {
+		f, err := openFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := parseRoutes(f)["routes"].([]Parsed)
+		f.Close()
+
+		f, err = openFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		routes := []Parsed{}
+		err = parseRoutesStream(f, func(route Parsed) error {
+			routes = append(routes, route)
+			return nil
+		})
+		f.Close()
+		if err != nil {
+			t.Error(err)
+		}
+
+		if !reflect.DeepEqual(routes, expected) {
+			t.Error(file, ": streamed routes differ from parsed routes")
+		}
+	}
+}
+
+func TestParseRoutesStreamStop(t *testing.T) {
+	f, err := openFile("routes_bird2_ipv4.sample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	stop := errors.New("client gone")
+	count := 0
+	err = parseRoutesStream(f, func(route Parsed) error {
+		count++
+		return stop
+	})
+	if err != stop {
+		t.Error("Expected emit error, got:", err)
+	}
+	if count != 1 {
+		t.Error("Expected parsing to stop after the first route, got:", count)
+	}
+}
+
+func TestStreamRoutesSocket(t *testing.T) {
+	path := startFakeBird(t, map[string]string{
+		"show route all protocol 'R1'": "1007-1.2.3.0/24          unicast [R1 2021-03-30 02:28:25] * (100) [AS4242i]\n" +
+			" \tvia 172.25.3.10 on eth0\n" +
+			"1007-1.2.4.0/24          unicast [R1 2021-03-30 02:28:25] * (100) [AS4242i]\n" +
+			" \tvia 172.25.3.10 on eth0\n" +
+			"0000 \n",
+		"show route all protocol 'R2'": "8003 No protocols match\n",
+	})
+	instance := setupFakeBirdClient(t, path)
+	instance.socketPool = NewSocketPool(path, 1, time.Second)
+	instance.setBirdVersion(1) // Do not query the version
+
+	routes := []Parsed{}
+	res, _ := RoutesProtoStream(context.Background(), true, "R1", func(route Parsed) error {
+		routes = append(routes, route)
+		return nil
+	})
+	if res != nil {
+		t.Error("Unexpected result:", res)
+	}
+	if len(routes) != 2 || routes[1]["network"] != "1.2.4.0/24" {
+		t.Error("Unexpected routes:", routes)
+	}
+
+	res, _ = RoutesProtoStream(context.Background(), true, "R2", func(route Parsed) error {
+		t.Error("Unexpected route:", route)
+		return nil
+	})
+	if err, ok := ParsedError(res); !ok || err.Code != 8003 {
+		t.Error("Expected error 8003, got:", res)
+	}
+}
+
+func TestBirdcCommand(t *testing.T) {
+	instance := NewInstance("", BirdConfig{BirdCmd: "birdc -s /run/bird.ctl"}, "4")
+	cmd := instance.birdcCommand(context.Background(), "route all table master")
+	expected := []string{"birdc", "-s", "/run/bird.ctl", "-r", "show", "route", "all", "table", "master"}
+	if !reflect.DeepEqual(cmd.Args, expected) {
+		t.Error("Unexpected args:", cmd.Args)
+	}
+}
+
+func TestRunStreamSocket(t *testing.T) {
+	// The fake BIRD ends the reply once released
+	path := filepath.Join(t.TempDir(), "bird.ctl")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	release := make(chan struct{})
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, "0001 BIRD 2.0.7 ready.\n")
+		r := bufio.NewReader(conn)
+		r.ReadString('\n')
+		fmt.Fprint(conn, "0016 Access restricted\n")
+		r.ReadString('\n')
+		fmt.Fprint(conn, "1007-1.2.3.0/24          unicast [R1 2021-03-30 02:28:25] * (100) [AS4242i]\n")
+		<-release
+		fmt.Fprint(conn, "0000 \n")
+	}()
+
+	instance := NewInstance("", BirdConfig{Socket: path}, "4")
+	out, err := instance.RunStream(context.Background(), "route all protocol 'R1'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	// The first row is read before the reply ends
+	lines := make(chan string)
+	r := bufio.NewReader(out)
+	go func() {
+		line, _ := r.ReadString('\n')
+		lines <- line
+	}()
+	select {
+	case line := <-lines:
+		if !strings.HasPrefix(line, "1.2.3.0/24") {
+			t.Error("Unexpected line:", line)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The reply was not streamed")
+	}
+
+	close(release)
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Error(err)
+	}
+}
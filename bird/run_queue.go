@@ -0,0 +1,86 @@
+package bird
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// A queued command. Waiting requests get the result
+// of the running command. The command is cancelled
+// when there are no more waiting requests.
+type runQueueEntry struct {
+	sync.Mutex
+	waiters int
+	cancel  context.CancelFunc
+
+	done   chan struct{}
+	result Parsed
+}
+
+func newRunQueueEntry(cancel context.CancelFunc) *runQueueEntry {
+	return &runQueueEntry{
+		waiters: 1,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+}
+
+// Join the waiting requests. This fails if all other
+// requests are already gone.
+func (e *runQueueEntry) join() bool {
+	e.Lock()
+	defer e.Unlock()
+	if e.waiters == 0 {
+		return false
+	}
+	e.waiters++
+	return true
+}
+
+// Leave the waiting requests and cancel the command
+// if this was the last one.
+func (e *runQueueEntry) leave() {
+	e.Lock()
+	defer e.Unlock()
+	e.waiters--
+	if e.waiters == 0 {
+		e.cancel()
+	}
+}
+
+// Wait for the result of the command or until the
+// context of the request is done.
+func (e *runQueueEntry) wait(ctx context.Context, cmd string) Parsed {
+	defer e.leave()
+	select {
+	case <-e.done:
+		return e.result
+	case <-ctx.Done():
+		return errorParsed(newError("show "+cmd, ctx.Err()))
+	}
+}
+
+// Set the result and release the waiting requests. The
+// entry is removed from the queue with dequeue first, so
+// requests retrying an abandoned command do not find the
+// finished entry.
+func (e *runQueueEntry) finish(result Parsed, dequeue func()) {
+	e.result = result
+	dequeue()
+	close(e.done)
+}
+
+// contextReader stops reading when the context is done.
+// This aborts parsing the output of a cancelled command.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
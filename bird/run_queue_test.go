@@ -0,0 +1,165 @@
+package bird
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func setupFakeBirdClient(t *testing.T, path string) *Instance {
+	instance := NewInstance("", BirdConfig{Socket: path}, "4")
+	Default = instance
+	cache = NewMemoryCache(10)
+	t.Cleanup(func() {
+		Default = NewInstance("", BirdConfig{}, "4")
+		cache = nil
+	})
+	return instance
+}
+
+func TestRunAndParseTimeout(t *testing.T) {
+	path := startSlowFakeBird(t, time.Second, map[string]string{
+		"show status": "0013 Daemon is up and running\n",
+	})
+	setupFakeBirdClient(t, path)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	res, _ := RunAndParse(ctx, false, "", "status", parseStatus, nil)
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("Request was not aborted")
+	}
+
+	err, ok := ParsedError(res)
+	if !ok {
+		t.Fatal("Expected an error, got:", res)
+	}
+	if err.HTTPStatus() != http.StatusGatewayTimeout {
+		t.Error("Unexpected status:", err.HTTPStatus())
+	}
+
+	// All waiters are gone: The command is cancelled
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := Default.runQueue.Load("status"); ok {
+		t.Error("Abandoned command is still queued")
+	}
+}
+
+func TestRunAndParseWaiters(t *testing.T) {
+	path := startSlowFakeBird(t, 200*time.Millisecond, map[string]string{
+		"show status": "1000-BIRD 2.0.7\n0013 Daemon is up and running\n",
+	})
+	setupFakeBirdClient(t, path)
+
+	// The first request goes away, the second one
+	// still gets the result.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		res, _ := RunAndParse(ctx, false, "", "status", parseStatus, nil)
+		if _, ok := ParsedError(res); !ok {
+			t.Error("Expected an error, got:", res)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		time.Sleep(10 * time.Millisecond)
+		res, _ := RunAndParse(context.Background(), false, "", "status", parseStatus, nil)
+		if _, ok := ParsedError(res); ok {
+			t.Error("Unexpected error:", res)
+			return
+		}
+		status := res["status"].(Parsed)
+		if status["version"] != "2.0.7" {
+			t.Error("Unexpected status:", status)
+		}
+	}()
+	wg.Wait()
+}
+
+func TestRunQueueEntryFinish(t *testing.T) {
+	entry := newRunQueueEntry(func() {})
+	dequeued := false
+	entry.finish(Parsed{"status": "ok"}, func() {
+		dequeued = true
+		select {
+		case <-entry.done:
+			t.Error("The entry was done before it was dequeued")
+		default:
+		}
+	})
+	if !dequeued {
+		t.Error("The entry was not dequeued")
+	}
+
+	// Abandoned: Joining fails, the result is ready
+	entry.leave()
+	if entry.join() {
+		t.Error("Expected joining the abandoned entry to fail")
+	}
+	select {
+	case <-entry.done:
+	default:
+		t.Error("The entry is not done")
+	}
+}
+
+func TestParseRoutesCancelled(t *testing.T) {
+	f, err := openFile("routes_bird2_ipv4.sample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	res := parseRoutes(&contextReader{ctx: ctx, r: f})
+	if routes := res["routes"].([]Parsed); len(routes) != 0 {
+		t.Error("Expected no routes, got:", len(routes))
+	}
+
+	r := &contextReader{
+		ctx: context.Background(),
+		r:   strings.NewReader("1.2.3.0/24 unicast [R1 2021-03-30 02:28:25] * (100) [AS4242i]\n"),
+	}
+	if routes := parseRoutes(r)["routes"].([]Parsed); len(routes) != 1 {
+		t.Error("Expected 1 route, got:", len(routes))
+	}
+}
+
+func TestRunAndParseWithoutRateLimit(t *testing.T) {
+	path := startFakeBird(t, map[string]string{
+		"show status": "0013 Daemon is up and running\n",
+	})
+	setupFakeBirdClient(t, path)
+
+	RateLimitConf.Lock()
+	RateLimitConf.Conf = RateLimitConfig{Enabled: true, Reqs: 0}
+	RateLimitConf.Unlock()
+	defer func() {
+		RateLimitConf.Lock()
+		RateLimitConf.Conf = RateLimitConfig{}
+		RateLimitConf.Unlock()
+	}()
+
+	res, _ := RunAndParse(context.Background(), false, "", "status", parseStatus, nil)
+	if err, ok := ParsedError(res); !ok || err.HTTPStatus() != http.StatusTooManyRequests {
+		t.Error("Expected the rate limit to be exceeded, got:", res)
+	}
+
+	ctx := WithoutRateLimit(context.Background())
+	res, _ = RunAndParse(ctx, false, "", "status", parseStatus, nil)
+	if err, ok := ParsedError(res); ok {
+		t.Error("Unexpected error:", err)
+	}
+}
@@ -0,0 +1,60 @@
+package bird
+
+// Sorted route listings
+
+import (
+	"time"
+)
+
+// Sorted copies of a route listing are kept in the cache
+// next to the result of the command, so they count against
+// the memory budget and are purged with the result.
+func sortedRoutesKey(cmd, order string) string {
+	return cmd + " | sort " + order
+}
+
+// ResultCachedAt gets the time the result was cached at,
+// as string. Results decoded from JSON may hold a string.
+func ResultCachedAt(ret Parsed) string {
+	switch cachedAt := ret["cached_at"].(type) {
+	case time.Time:
+		return cachedAt.Format(time.RFC3339Nano)
+	case string:
+		return cachedAt
+	}
+	return ""
+}
+
+// CachedSortedRoutes gets the routes of the result of the
+// command in the order, if they were sorted before. The
+// sorted routes must stem from the same result.
+func (i *Instance) CachedSortedRoutes(cmd, order string, ret Parsed) ([]Parsed, bool) {
+	cachedAt := ResultCachedAt(ret)
+	if cachedAt == "" {
+		return nil, false
+	}
+	val, err := cache.Get(i.cacheKey(sortedRoutesKey(cmd, order)))
+	if err != nil || val["sorted_from"] != cachedAt {
+		return nil, false
+	}
+	routes, ok := val["routes"].([]Parsed)
+	return routes, ok
+}
+
+// CacheSortedRoutes keeps the sorted routes of the result
+// of the command until the result expires.
+func (i *Instance) CacheSortedRoutes(cmd, order string, ret Parsed, routes []Parsed) {
+	cachedAt := ResultCachedAt(ret)
+	ttl, err := parseCacheTTL(ret["ttl"])
+	if cachedAt == "" || err != nil {
+		return
+	}
+	remaining := time.Until(ttl)
+	if remaining <= 0 {
+		return // Stale results are refreshed soon
+	}
+	cache.Set(i.cacheKey(sortedRoutesKey(cmd, order)), Parsed{
+		"routes":      routes,
+		"sorted_from": cachedAt,
+	}, remaining)
+}
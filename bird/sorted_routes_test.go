@@ -0,0 +1,45 @@
+package bird
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCachedSortedRoutes(t *testing.T) {
+	cache = NewMemoryCache(10)
+	defer func() { cache = nil }()
+
+	instance := NewInstance("", BirdConfig{}, "4")
+	cmd := "route all protocol 'R1'"
+	ret := Parsed{"routes": []Parsed{{"network": "10.1.0.0/16"}, {"network": "10.0.0.0/16"}}}
+	cache.Set(instance.cacheKey(cmd), ret, 5*time.Minute)
+
+	sorted := []Parsed{{"network": "10.0.0.0/16"}, {"network": "10.1.0.0/16"}}
+	instance.CacheSortedRoutes(cmd, "network,asc", ret, sorted)
+
+	routes, ok := instance.CachedSortedRoutes(cmd, "network,asc", ret)
+	if !ok || len(routes) != 2 || routes[0]["network"] != "10.0.0.0/16" {
+		t.Error("Expected the sorted routes, got:", routes)
+	}
+	if _, ok := instance.CachedSortedRoutes(cmd, "network,desc", ret); ok {
+		t.Error("Unexpected routes in another order")
+	}
+	other := NewInstance("blue", BirdConfig{}, "4")
+	if _, ok := other.CachedSortedRoutes(cmd, "network,asc", ret); ok {
+		t.Error("Unexpected routes of another instance")
+	}
+
+	// The sorted routes are not used for a refreshed result
+	refreshed := Parsed{"routes": ret["routes"]}
+	cache.Set(instance.cacheKey(cmd), refreshed, 5*time.Minute)
+	if _, ok := instance.CachedSortedRoutes(cmd, "network,asc", refreshed); ok {
+		t.Error("Unexpected routes of the previous result")
+	}
+
+	// Stale results are not sorted into the cache
+	stale := Parsed{"cached_at": time.Now(), "ttl": time.Now().Add(-time.Second)}
+	instance.CacheSortedRoutes("route all", "network,asc", stale, sorted)
+	if _, err := cache.Get(instance.cacheKey("route all | sort network,asc")); err == nil {
+		t.Error("Unexpected sorted routes of a stale result")
+	}
+}
@@ -2,9 +2,24 @@ package bird
 
 import (
 	"bufio"
+	"context"
 	"fmt"
+	"log"
 	"os"
 	"regexp"
+	"time"
+)
+
+// The commands of the results which are outdated
+// after a reconfiguration
+var reconfigCommands = []string{"protocols", "route ", "symbols"}
+
+// The last reconfiguration is kept in the cache, so results
+// cached by the redis or disk cache before a reconfiguration
+// are removed after a restart of birdwatcher.
+const (
+	reconfigMarkerKey = "last_reconfig"
+	reconfigMarkerTTL = 365 * 24 * time.Hour
 )
 
 // Get last reconfig timestamp from file modification date
@@ -45,3 +60,50 @@ func lastReconfigTimestampFromFileContent(filename string, regex string) string
 
 	return ""
 }
+
+// Check if BIRD was reconfigured since the last status
+// and remove the outdated results from the cache.
+func (i *Instance) checkReconfig(lastReconfig string) bool {
+	if !CacheConf.InvalidateOnReconfig || lastReconfig == "" {
+		return false
+	}
+
+	i.reconfigLock.Lock()
+	previous := i.lastReconfig
+	key := i.cacheKey(reconfigMarkerKey)
+	if marker, err := cache.Get(key); err == nil {
+		previous, _ = marker["last_reconfig"].(string)
+	}
+	if previous != lastReconfig {
+		err := cache.Set(key, Parsed{"last_reconfig": lastReconfig}, reconfigMarkerTTL)
+		if err != nil {
+			log.Println("Could not cache the last reconfiguration:", err)
+		}
+	}
+	i.lastReconfig = lastReconfig
+	i.reconfigLock.Unlock()
+
+	if previous == "" || previous == lastReconfig {
+		return false
+	}
+
+	count := i.InvalidateCache()
+	log.Println("BIRD was reconfigured, removed", count, "cached results", i.Name)
+	return true
+}
+
+// InvalidateCache removes the cached protocols, routes
+// and symbols of the instance. If the warmup is enabled,
+// the results are warmed again.
+func (i *Instance) InvalidateCache() int {
+	count := 0
+	for _, cmd := range reconfigCommands {
+		count += cache.Purge(i.cacheKey(cmd))
+	}
+
+	i.resetWarmup()
+	if WarmupConf.Interval > 0 {
+		go i.Warm(context.Background())
+	}
+	return count
+}
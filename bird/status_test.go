@@ -3,7 +3,9 @@ package bird
 // Created: 2016-12-01 14:15:00
 
 import (
+	"context"
 	"testing"
+	"time"
 )
 
 func TestReconfigTimestampFromStat(t *testing.T) {
@@ -21,3 +23,80 @@ func TestReconfigTimestampFromContent(t *testing.T) {
 	ts := lastReconfigTimestampFromFileContent("./status_test.go", "// Created: (.*)")
 	t.Log(ts)
 }
+
+func TestStatusInvalidatesCacheOnReconfig(t *testing.T) {
+	path := startFakeBird(t, map[string]string{
+		"show status": "1000-BIRD 2.0.7\n" +
+			"1011-Router ID is 172.25.3.2\n" +
+			" Last reconfiguration on 2021-03-30 01:58:07.850\n" +
+			"0013 Daemon is up and running\n",
+	})
+	instance := setupFakeBirdClient(t, path)
+	instance.Config.CacheTtl = 5
+	instance.lastReconfig = "2021-03-29 12:00:00.000"
+
+	StatusConf = StatusConfig{ReconfigTimestampSource: "bird"}
+	CacheConf = CacheConfig{InvalidateOnReconfig: true}
+	defer func() {
+		StatusConf = StatusConfig{}
+		CacheConf = CacheConfig{}
+	}()
+
+	keys := []string{
+		"ipv4:protocols all", "ipv4:route all protocol 'R1'", "ipv4:symbols", "v4_ipv4:protocols all",
+	}
+	for _, key := range keys {
+		cache.Set(key, Parsed{}, 5*time.Minute)
+	}
+
+	Status(context.Background(), false)
+	for _, key := range keys[:3] {
+		if _, err := cache.Get(key); err == nil {
+			t.Error("Expected purged result:", key)
+		}
+	}
+	// Other instances are not affected
+	if _, err := cache.Get("v4_ipv4:protocols all"); err != nil {
+		t.Error(err)
+	}
+	if instance.lastReconfig != "2021-03-30 01:58:07.850" {
+		t.Error("Unexpected last reconfig:", instance.lastReconfig)
+	}
+
+	// Unchanged
+	cache.Set("symbols", Parsed{}, 5*time.Minute)
+	if instance.checkReconfig("2021-03-30 01:58:07.850") {
+		t.Error("Unexpected reconfiguration")
+	}
+	if _, err := cache.Get("symbols"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReconfigMarkerSurvivesRestart(t *testing.T) {
+	disk, err := NewDiskCache(CacheConfig{DiskPath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache = disk
+	CacheConf = CacheConfig{InvalidateOnReconfig: true}
+	defer func() {
+		cache = nil
+		CacheConf = CacheConfig{}
+	}()
+
+	before := NewInstance("", BirdConfig{}, "4")
+	if before.checkReconfig("2021-03-29 12:00:00.000") {
+		t.Error("Unexpected reconfiguration")
+	}
+
+	// BIRD is reconfigured while birdwatcher restarts
+	cache.Set("ipv4:protocols all", Parsed{}, 5*time.Minute)
+	after := NewInstance("", BirdConfig{}, "4")
+	if !after.checkReconfig("2021-03-30 01:58:07.850") {
+		t.Error("Expected a reconfiguration")
+	}
+	if _, err := cache.Get("ipv4:protocols all"); err == nil {
+		t.Error("Expected purged result")
+	}
+}
@@ -0,0 +1,532 @@
+package bird
+
+// Typed representation of the parsed BIRD output.
+//
+// The JSON encoding of the types is the wire format of
+// the API, as documented in docs/schema.md.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// BirdStatus is the status of the BIRD daemon
+type BirdStatus struct {
+	Version       string `json:"version"`
+	RouterID      string `json:"router_id"`
+	CurrentServer string `json:"current_server"`
+	LastReboot    string `json:"last_reboot"`
+	LastReconfig  string `json:"last_reconfig"`
+	Message       string `json:"message"`
+}
+
+// RouteCount holds the number of routes of a protocol
+// or channel. Counts not reported by BIRD are nil.
+type RouteCount struct {
+	Imported  *int64 `json:"imported,omitempty"`
+	Filtered  *int64 `json:"filtered,omitempty"`
+	Exported  *int64 `json:"exported,omitempty"`
+	Preferred *int64 `json:"preferred,omitempty"`
+}
+
+// RouteChanges are the route change statistics of a
+// protocol, like import updates. Counters not available
+// for the protocol are nil.
+type RouteChanges struct {
+	Received *int64 `json:"received,omitempty"`
+	Rejected *int64 `json:"rejected,omitempty"`
+	Filtered *int64 `json:"filtered,omitempty"`
+	Ignored  *int64 `json:"ignored,omitempty"`
+	Accepted *int64 `json:"accepted,omitempty"`
+}
+
+// Channel of a protocol, e.g. ipv4
+type Channel struct {
+	Routes *RouteCount `json:"routes,omitempty"`
+}
+
+// Protocol is a BIRD protocol, e.g. a BGP session.
+// The details depend on the protocol and are kept in
+// the Attributes, e.g. "neighbor_as" or "bgp_state".
+type Protocol struct {
+	Protocol     string                  `json:"protocol"`
+	BirdProtocol string                  `json:"bird_protocol"`
+	Table        string                  `json:"table"`
+	State        string                  `json:"state"`
+	StateChanged string                  `json:"state_changed"`
+	Connection   string                  `json:"connection"`
+	PeerTable    string                  `json:"peer_table,omitempty"`
+	Channels     map[string]*Channel     `json:"channels"`
+	Routes       *RouteCount             `json:"routes"`
+	RouteChanges map[string]RouteChanges `json:"route_changes"`
+
+	Attributes map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON encodes the attributes along with
+// the fields of the protocol.
+func (p Protocol) MarshalJSON() ([]byte, error) {
+	type protocol Protocol
+	return marshalWithAttributes(protocol(p), p.Attributes)
+}
+
+// UnmarshalJSON decodes the protocol. Unknown keys
+// are kept as attributes.
+func (p *Protocol) UnmarshalJSON(data []byte) error {
+	type protocol Protocol
+	attrs := map[string]interface{}{}
+	if err := unmarshalWithAttributes(data, (*protocol)(p), &attrs); err != nil {
+		return err
+	}
+	p.Attributes = attrs
+	return nil
+}
+
+// Community is a BGP community, e.g. (65000, 1)
+type Community [2]int64
+
+func (c Community) String() string {
+	return fmt.Sprintf("%d:%d", c[0], c[1])
+}
+
+// LargeCommunity is a BGP large community,
+// e.g. (65000, 1, 2)
+type LargeCommunity [3]int64
+
+func (c LargeCommunity) String() string {
+	return fmt.Sprintf("%d:%d:%d", c[0], c[1], c[2])
+}
+
+// ExtCommunity is a BGP extended community,
+// e.g. (rt, 65000, 1)
+type ExtCommunity [3]string
+
+func (c ExtCommunity) String() string {
+	return strings.Join(c[:], ":")
+}
+
+// BGPAttributes of a route. The values are reported
+// as strings by BIRD. Other attributes, like "atomic_aggr",
+// are kept in the Attributes.
+type BGPAttributes struct {
+	Origin           string           `json:"origin,omitempty"`
+	ASPath           []string         `json:"as_path,omitempty"`
+	NextHop          string           `json:"next_hop,omitempty"`
+	LocalPref        string           `json:"local_pref,omitempty"`
+	Med              string           `json:"med,omitempty"`
+	Communities      []Community      `json:"communities,omitempty"`
+	LargeCommunities []LargeCommunity `json:"large_communities,omitempty"`
+	ExtCommunities   []ExtCommunity   `json:"ext_communities,omitempty"`
+
+	Attributes map[string]string `json:"-"`
+}
+
+// MarshalJSON encodes the attributes along with
+// the well known bgp attributes.
+func (b BGPAttributes) MarshalJSON() ([]byte, error) {
+	type bgp BGPAttributes
+	attrs := make(map[string]interface{}, len(b.Attributes))
+	for k, v := range b.Attributes {
+		attrs[k] = v
+	}
+	return marshalWithAttributes(bgp(b), attrs)
+}
+
+// UnmarshalJSON decodes the bgp attributes. Unknown
+// keys are kept as attributes.
+func (b *BGPAttributes) UnmarshalJSON(data []byte) error {
+	type bgp BGPAttributes
+	attrs := map[string]string{}
+	if err := unmarshalWithAttributes(data, (*bgp)(b), &attrs); err != nil {
+		return err
+	}
+	b.Attributes = attrs
+	return nil
+}
+
+// Route is a route in a BIRD table
+type Route struct {
+	Network      string         `json:"network"`
+	Gateway      string         `json:"gateway"`
+	Interface    string         `json:"interface"`
+	FromProtocol string         `json:"from_protocol"`
+	Age          string         `json:"age"`
+	LearntFrom   string         `json:"learnt_from"`
+	Primary      bool           `json:"primary"`
+	Metric       int64          `json:"metric"`
+	Type         []string       `json:"type"`
+	BGP          *BGPAttributes `json:"bgp,omitempty"`
+}
+
+// Encode the value with the attributes merged into
+// the object. The fields take precedence.
+func marshalWithAttributes(v interface{}, attrs map[string]interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(attrs) == 0 {
+		return data, err
+	}
+
+	obj := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	for k, v := range attrs {
+		if _, ok := obj[k]; ok {
+			continue
+		}
+		value, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		obj[k] = value
+	}
+	return json.Marshal(obj)
+}
+
+// Decode the value and collect the keys not
+// handled by its fields into attrs, which must be
+// a pointer to a map.
+func unmarshalWithAttributes(data []byte, v interface{}, attrs interface{}) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+
+	obj := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	for _, key := range jsonKeys(v) {
+		delete(obj, key)
+	}
+	for k, raw := range obj {
+		if string(raw) == "null" {
+			delete(obj, k)
+		}
+	}
+
+	rest, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(rest, attrs)
+}
+
+// Get the keys of the fields of a struct
+func jsonKeys(v interface{}) []string {
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	keys := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if tag != "" && tag != "-" {
+			keys = append(keys, tag)
+		}
+	}
+	return keys
+}
+
+// The typed values are read from the parsed values. Results
+// from the redis or disk cache hold generic slices and
+// float64 numbers instead of the types of the parsers.
+
+func stringValue(value interface{}) string {
+	s, _ := value.(string)
+	return s
+}
+
+func intValue(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+func intPtr(value interface{}) *int64 {
+	n, ok := intValue(value)
+	if !ok {
+		return nil
+	}
+	return &n
+}
+
+func stringList(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, s := range v {
+			list = append(list, stringValue(s))
+		}
+		return list
+	}
+	return nil
+}
+
+func intList(value interface{}) []int64 {
+	switch v := value.(type) {
+	case []int64:
+		return v
+	case []interface{}:
+		list := make([]int64, 0, len(v))
+		for _, n := range v {
+			i, _ := intValue(n)
+			list = append(list, i)
+		}
+		return list
+	}
+	return nil
+}
+
+// Get the values of a list of communities, which are
+// lists of numbers or strings
+func communityValues(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case [][]int64:
+		values := make([]interface{}, 0, len(v))
+		for _, c := range v {
+			values = append(values, c)
+		}
+		return values
+	case []interface{}:
+		return v
+	}
+	return nil
+}
+
+func statusFromParsed(status Parsed) *BirdStatus {
+	return &BirdStatus{
+		Version:       stringValue(status["version"]),
+		RouterID:      stringValue(status["router_id"]),
+		CurrentServer: stringValue(status["current_server"]),
+		LastReboot:    stringValue(status["last_reboot"]),
+		LastReconfig:  stringValue(status["last_reconfig"]),
+		Message:       stringValue(status["message"]),
+	}
+}
+
+func routeCountFromParsed(value interface{}) *RouteCount {
+	count, ok := AsParsed(value)
+	if !ok {
+		return nil
+	}
+	return &RouteCount{
+		Imported:  intPtr(count["imported"]),
+		Filtered:  intPtr(count["filtered"]),
+		Exported:  intPtr(count["exported"]),
+		Preferred: intPtr(count["preferred"]),
+	}
+}
+
+// The keys of the protocol which are not attributes
+var protocolKeys = jsonKeys(Protocol{})
+
+func protocolFromParsed(protocol Parsed) *Protocol {
+	p := &Protocol{
+		Protocol:     stringValue(protocol["protocol"]),
+		BirdProtocol: stringValue(protocol["bird_protocol"]),
+		Table:        stringValue(protocol["table"]),
+		State:        stringValue(protocol["state"]),
+		StateChanged: stringValue(protocol["state_changed"]),
+		Connection:   stringValue(protocol["connection"]),
+		PeerTable:    stringValue(protocol["peer_table"]),
+		Routes:       routeCountFromParsed(protocol["routes"]),
+		Attributes:   map[string]interface{}{},
+	}
+
+	if channels, ok := AsParsed(protocol["channels"]); ok {
+		p.Channels = make(map[string]*Channel, len(channels))
+		for name, c := range channels {
+			channel, _ := AsParsed(c)
+			p.Channels[name] = &Channel{
+				Routes: routeCountFromParsed(channel["routes"]),
+			}
+		}
+	}
+
+	if changes, ok := AsParsed(protocol["route_changes"]); ok {
+		p.RouteChanges = make(map[string]RouteChanges, len(changes))
+		for key, c := range changes {
+			counts, _ := AsParsed(c)
+			p.RouteChanges[key] = RouteChanges{
+				Received: intPtr(counts["received"]),
+				Rejected: intPtr(counts["rejected"]),
+				Filtered: intPtr(counts["filtered"]),
+				Ignored:  intPtr(counts["ignored"]),
+				Accepted: intPtr(counts["accepted"]),
+			}
+		}
+	}
+
+	for key, value := range protocol {
+		if value != nil && !dirtyContains(protocolKeys, key) {
+			p.Attributes[key] = value
+		}
+	}
+	return p
+}
+
+// The keys of the bgp attributes which are not
+// kept in the Attributes
+var bgpKeys = jsonKeys(BGPAttributes{})
+
+func bgpFromParsed(bgp Parsed) *BGPAttributes {
+	b := &BGPAttributes{
+		Origin:     stringValue(bgp["origin"]),
+		ASPath:     stringList(bgp["as_path"]),
+		NextHop:    stringValue(bgp["next_hop"]),
+		LocalPref:  stringValue(bgp["local_pref"]),
+		Med:        stringValue(bgp["med"]),
+		Attributes: map[string]string{},
+	}
+	for _, value := range communityValues(bgp["communities"]) {
+		c := Community{}
+		copy(c[:], intList(value))
+		b.Communities = append(b.Communities, c)
+	}
+	for _, value := range communityValues(bgp["large_communities"]) {
+		c := LargeCommunity{}
+		copy(c[:], intList(value))
+		b.LargeCommunities = append(b.LargeCommunities, c)
+	}
+	for _, value := range communityValues(bgp["ext_communities"]) {
+		c := ExtCommunity{}
+		copy(c[:], stringList(value))
+		b.ExtCommunities = append(b.ExtCommunities, c)
+	}
+
+	for key, value := range bgp {
+		if s, ok := value.(string); ok && !dirtyContains(bgpKeys, key) {
+			b.Attributes[key] = s
+		}
+	}
+	return b
+}
+
+func routeFromParsed(route Parsed) *Route {
+	r := &Route{
+		Network:      stringValue(route["network"]),
+		Gateway:      stringValue(route["gateway"]),
+		Interface:    stringValue(route["interface"]),
+		FromProtocol: stringValue(route["from_protocol"]),
+		Age:          stringValue(route["age"]),
+		LearntFrom:   stringValue(route["learnt_from"]),
+		Primary:      route["primary"] == true,
+		Type:         stringList(route["type"]),
+	}
+	r.Metric, _ = intValue(route["metric"])
+	if bgp, ok := AsParsed(route["bgp"]); ok {
+		r.BGP = bgpFromParsed(bgp)
+	}
+	return r
+}
+
+// DecodeStatus gets the status from a result
+// of Status.
+func DecodeStatus(ret Parsed) (*BirdStatus, error) {
+	if err, ok := ParsedError(ret); ok {
+		return nil, err
+	}
+	status, ok := AsParsed(ret["status"])
+	if !ok {
+		return nil, fmt.Errorf("result without status")
+	}
+	return statusFromParsed(status), nil
+}
+
+// DecodeProtocols gets the protocols, by name, from a
+// result of Protocols or ProtocolsBgp.
+func DecodeProtocols(ret Parsed) (map[string]*Protocol, error) {
+	if err, ok := ParsedError(ret); ok {
+		return nil, err
+	}
+	parsed, ok := AsParsed(ret["protocols"])
+	if !ok {
+		return nil, fmt.Errorf("result without protocols")
+	}
+	protocols := make(map[string]*Protocol, len(parsed))
+	for name, p := range parsed {
+		protocol, ok := AsParsed(p)
+		if !ok {
+			return nil, fmt.Errorf("invalid protocol: %s", name)
+		}
+		protocols[name] = protocolFromParsed(protocol)
+	}
+	return protocols, nil
+}
+
+// DecodeRoutes gets the routes from a result of
+// a routes query, like RoutesTable.
+func DecodeRoutes(ret Parsed) ([]*Route, error) {
+	if err, ok := ParsedError(ret); ok {
+		return nil, err
+	}
+
+	var parsed []interface{}
+	switch v := ret["routes"].(type) {
+	case []Parsed:
+		parsed = make([]interface{}, 0, len(v))
+		for _, route := range v {
+			parsed = append(parsed, route)
+		}
+	case []interface{}:
+		parsed = v
+	case nil: // No routes
+	default:
+		return nil, fmt.Errorf("result without routes")
+	}
+
+	routes := make([]*Route, 0, len(parsed))
+	for _, r := range parsed {
+		route, ok := AsParsed(r)
+		if !ok {
+			return nil, fmt.Errorf("invalid route")
+		}
+		routes = append(routes, routeFromParsed(route))
+	}
+	return routes, nil
+}
+
+// DecodeRoutesCount gets the number of routes from
+// a result of a count query, like RoutesTableCount.
+func DecodeRoutesCount(ret Parsed) (int64, error) {
+	if err, ok := ParsedError(ret); ok {
+		return 0, err
+	}
+	count, ok := intValue(ret["routes"])
+	if !ok {
+		return 0, fmt.Errorf("result without route count")
+	}
+	return count, nil
+}
+
+// ParseStatus parses the output of `show status`
+func ParseStatus(reader io.Reader) (*BirdStatus, error) {
+	return DecodeStatus(parseStatus(reader))
+}
+
+// ParseProtocols parses the output of `show protocols all`
+func ParseProtocols(reader io.Reader) (map[string]*Protocol, error) {
+	return DecodeProtocols(parseProtocols(reader))
+}
+
+// ParseRoutes parses the output of `show route all`
+func ParseRoutes(reader io.Reader) ([]*Route, error) {
+	return DecodeRoutes(parseRoutes(reader))
+}
+
+// ParseRoutesCount parses the output of `show route count`
+func ParseRoutesCount(reader io.Reader) (int64, error) {
+	return DecodeRoutesCount(parseRoutesCount(reader))
+}
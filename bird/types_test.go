@@ -0,0 +1,231 @@
+package bird
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Check that the typed value is encoded like the parsed value
+func assertWireFormat(t *testing.T, typed interface{}, parsed interface{}) {
+	typedJSON, err := json.Marshal(typed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsedJSON, err := json.Marshal(parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var a, b interface{}
+	json.Unmarshal(typedJSON, &a)
+	json.Unmarshal(parsedJSON, &b)
+	if !reflect.DeepEqual(a, b) {
+		t.Errorf("Wire format differs:\n%s\n%s", typedJSON, parsedJSON)
+	}
+}
+
+func TestTypedStatus(t *testing.T) {
+	f, err := openFile("status2.sample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	status, err := ParseStatus(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Version != "2.0.7" || status.RouterID != "172.25.3.2" {
+		t.Error("Unexpected status:", status)
+	}
+}
+
+func TestTypedProtocols(t *testing.T) {
+	f, err := openFile("protocols_bgp_pipe.sample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := parseProtocols(f)
+	f.Close()
+
+	protocols, err := DecodeProtocols(parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(protocols) != len(parsed["protocols"].(Parsed)) {
+		t.Error("Unexpected number of protocols:", len(protocols))
+	}
+	for name, protocol := range protocols {
+		if protocol.Protocol != name {
+			t.Error("Unexpected protocol name:", protocol.Protocol)
+		}
+	}
+	assertWireFormat(t, protocols, parsed["protocols"])
+}
+
+func TestTypedRoutes(t *testing.T) {
+	f, err := openFile("routes_bird2_ipv4.sample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	routes, err := ParseRoutes(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) == 0 {
+		t.Fatal("Expected routes")
+	}
+
+	route := routes[0]
+	if route.Network == "" || route.BGP == nil {
+		t.Fatal("Unexpected route:", route)
+	}
+	if len(route.BGP.ASPath) == 0 {
+		t.Error("Expected as path:", route.BGP)
+	}
+}
+
+func TestTypedRoutesWireFormat(t *testing.T) {
+	files := []string{
+		"routes_bird1_ipv4.sample",
+		"routes_bird2_ipv4.sample",
+		"routes_bird3_ipv6.sample",
+	}
+	for _, file := range files {
+		f, err := openFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed := parseRoutes(f)
+		f.Close()
+
+		routes, err := DecodeRoutes(parsed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertWireFormat(t, routes, parsed["routes"])
+	}
+}
+
+func TestDecodeCachedRoutes(t *testing.T) {
+	f, err := openFile("routes_bird2_ipv4.sample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := parseRoutes(f)
+	f.Close()
+
+	// Results from the redis or disk cache are decoded
+	// from JSON
+	data, _ := json.Marshal(parsed)
+	decoded := Parsed{}
+	json.Unmarshal(data, &decoded)
+	cached := restoreParsed(decoded)
+
+	routes, err := DecodeRoutes(cached)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) == 0 || len(routes[0].BGP.Communities) == 0 {
+		t.Fatal("Expected routes with communities:", routes)
+	}
+	assertWireFormat(t, routes, parsed["routes"])
+}
+
+func TestBGPAttributes(t *testing.T) {
+	data := []byte(`{
+		"as_path": ["4242", "65001"],
+		"communities": [[65000, 1]],
+		"large_communities": [[65000, 1, 2]],
+		"ext_communities": [["rt", "65000", "1"]],
+		"atomic_aggr": ""
+	}`)
+
+	bgp := &BGPAttributes{}
+	if err := json.Unmarshal(data, bgp); err != nil {
+		t.Fatal(err)
+	}
+	if bgp.Communities[0].String() != "65000:1" {
+		t.Error("Unexpected community:", bgp.Communities[0])
+	}
+	if bgp.LargeCommunities[0].String() != "65000:1:2" {
+		t.Error("Unexpected large community:", bgp.LargeCommunities[0])
+	}
+	if bgp.ExtCommunities[0].String() != "rt:65000:1" {
+		t.Error("Unexpected ext community:", bgp.ExtCommunities[0])
+	}
+	if _, ok := bgp.Attributes["atomic_aggr"]; !ok {
+		t.Error("Expected unknown attributes to be kept:", bgp.Attributes)
+	}
+
+	var expected, res interface{}
+	js, _ := json.Marshal(bgp)
+	json.Unmarshal(js, &res)
+	json.Unmarshal(data, &expected)
+	if !reflect.DeepEqual(res, expected) {
+		t.Error("Unexpected encoding:", string(js))
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	ret := errorParsed(&Error{Code: 8003, Message: "No protocols match"})
+	if _, err := DecodeRoutes(ret); err == nil {
+		t.Error("Expected the error of the result")
+	}
+}
+
+func TestProtocolsBgp(t *testing.T) {
+	f, err := openFile("protocols_bgp_pipe.sample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := parseProtocols(f)
+	f.Close()
+
+	cache = NewMemoryCache(10)
+	defer func() { cache = nil }()
+
+	// Results from the redis cache are generic maps
+	data, _ := json.Marshal(parsed)
+	decoded := Parsed{}
+	json.Unmarshal(data, &decoded)
+
+	for _, result := range []Parsed{parsed, decoded} {
+		cache.Set(Default.cacheKey("protocols all"), result, 5*time.Minute) // Results are cached by command
+
+		res, fromCache := ProtocolsBgp(context.Background(), true)
+		if !fromCache {
+			t.Error("Expected result from cache")
+		}
+		protocols, err := DecodeProtocols(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(protocols) == 0 {
+			t.Error("Expected bgp protocols")
+		}
+		for _, protocol := range protocols {
+			if protocol.BirdProtocol != "BGP" {
+				t.Error("Unexpected protocol:", protocol.Protocol)
+			}
+		}
+	}
+}
+
+func TestParseProtocolsUnexpectedOutput(t *testing.T) {
+	// A block without the protocol header
+	out := "  Channel ipv4\n    Routes:         1 imported, 0 exported\n\n"
+	protocols, err := ParseProtocols(strings.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(protocols) != 0 {
+		t.Error("Unexpected protocols:", protocols)
+	}
+}
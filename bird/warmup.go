@@ -0,0 +1,214 @@
+package bird
+
+// Refresh cached results in the background before they expire
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var WarmupConf WarmupConfig
+
+type warmupQuery struct {
+	cmd   string // The command of the cached result
+	query func(context.Context, bool) (Parsed, bool)
+}
+
+// Get the query of a module which can be warmed.
+// Modules running the same command share the result.
+func getWarmupQuery(module string) (warmupQuery, bool) {
+	switch module {
+	case "status":
+		return warmupQuery{"status", Status}, true
+	case "protocols":
+		return warmupQuery{"protocols all", Protocols}, true
+	case "protocols_bgp":
+		return warmupQuery{"protocols all", ProtocolsBgp}, true
+	case "protocols_short":
+		return warmupQuery{"protocols", ProtocolsShort}, true
+	case "symbols", "symbols_tables", "symbols_protocols":
+		return warmupQuery{"symbols", Symbols}, true
+	}
+	return warmupQuery{}, false
+}
+
+// IsWarmupModule checks if the results of the module
+// can be warmed. The routes of protocols are warmed
+// with the bgp_routes option.
+func IsWarmupModule(module string) bool {
+	_, ok := getWarmupQuery(module)
+	return ok
+}
+
+// WarmupEntry is a result kept warm in the cache
+type WarmupEntry struct {
+	Module   string    `json:"module"`
+	Protocol string    `json:"protocol,omitempty"`
+	WarmedAt time.Time `json:"warmed_at"`
+	Expires  time.Time `json:"expires"`
+	Error    *Error    `json:"error,omitempty"`
+}
+
+func (e *WarmupEntry) key() string {
+	if e.Protocol == "" {
+		return e.Module
+	}
+	return e.Module + "/" + e.Protocol
+}
+
+// The last warmup of the results of an instance by key
+type warmupState struct {
+	sync.Mutex
+	entries map[string]*WarmupEntry
+}
+
+// Period is the interval of the warmup runs
+func (c WarmupConfig) Period() time.Duration {
+	if c.Interval > 0 {
+		return time.Duration(c.Interval) * time.Second
+	}
+	return time.Minute
+}
+
+// Get the results to keep warm. A command is run for the
+// first of the modules sharing it. The routes of the
+// established BGP sessions are taken from the cached
+// protocols.
+func (i *Instance) warmupTargets(ctx context.Context) []*WarmupEntry {
+	targets := []*WarmupEntry{}
+	commands := map[string]bool{}
+	for _, module := range WarmupConf.Modules {
+		q, ok := getWarmupQuery(module)
+		if !ok || commands[q.cmd] {
+			continue
+		}
+		commands[q.cmd] = true
+		targets = append(targets, &WarmupEntry{Module: module})
+	}
+	if !WarmupConf.BgpRoutes {
+		return targets
+	}
+
+	protocols, _ := ProtocolsBgp(WithModule(ctx, "protocols_bgp"), true)
+	if IsSpecial(protocols) {
+		return targets
+	}
+	all, _ := AsParsed(protocols["protocols"])
+	names := make([]string, 0, len(all))
+	for name, p := range all {
+		if protocol, ok := AsParsed(p); ok && isEstablished(protocol) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		targets = append(targets, &WarmupEntry{
+			Module:   "routes_protocol",
+			Protocol: name,
+		})
+	}
+	return targets
+}
+
+func isEstablished(protocol Parsed) bool {
+	if protocol["state"] != "up" {
+		return false
+	}
+	return protocol["bgp_state"] == "Established" ||
+		protocol["connection"] == "Established"
+}
+
+// Check if the result must be refreshed, because it
+// expires before the next run.
+func (i *Instance) warmupDue(target *WarmupEntry, interval time.Duration) bool {
+	i.warmup.Lock()
+	defer i.warmup.Unlock()
+	last, ok := i.warmup.entries[target.key()]
+	if !ok || last.Error != nil {
+		return true
+	}
+	return time.Until(last.Expires) <= interval
+}
+
+func (i *Instance) setWarmed(entry *WarmupEntry) {
+	i.warmup.Lock()
+	defer i.warmup.Unlock()
+	if i.warmup.entries == nil {
+		i.warmup.entries = make(map[string]*WarmupEntry)
+	}
+	i.warmup.entries[entry.key()] = entry
+}
+
+// Forget the warmed results, e.g. after they
+// were removed from the cache.
+func (i *Instance) resetWarmup() {
+	i.warmup.Lock()
+	defer i.warmup.Unlock()
+	i.warmup.entries = nil
+}
+
+// Warm refreshes the results of the configured modules
+// which expire before the next run and returns the
+// number of refreshed results.
+//
+// The queries count against the rate limit. If it is
+// exceeded, the remaining results are refreshed in
+// the next run.
+func (i *Instance) Warm(ctx context.Context) int {
+	ctx = WithInstance(ctx, i)
+	interval := WarmupConf.Period()
+
+	count := 0
+	for _, target := range i.warmupTargets(ctx) {
+		ttl := i.cacheTTL(target.Module)
+		if ttl <= 0 || !i.warmupDue(target, interval) {
+			continue // Not cached or still fresh
+		}
+
+		moduleCtx := WithModule(ctx, target.Module)
+		var res Parsed
+		if target.Protocol != "" {
+			res, _ = RoutesProto(moduleCtx, false, target.Protocol)
+		} else {
+			q, _ := getWarmupQuery(target.Module)
+			res, _ = q.query(moduleCtx, false)
+		}
+
+		target.WarmedAt = time.Now().UTC()
+		target.Expires = target.WarmedAt.Add(ttl)
+		target.Error, _ = ParsedError(res)
+		i.setWarmed(target)
+
+		if target.Error != nil {
+			if target.Error.HTTPStatus() == http.StatusTooManyRequests {
+				log.Println("Warmup stopped, rate limit exceeded")
+				break
+			}
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+// WarmupStatus returns the last warmup of the
+// results of the instance, ordered by module.
+func (i *Instance) WarmupStatus() []WarmupEntry {
+	i.warmup.Lock()
+	defer i.warmup.Unlock()
+	keys := make([]string, 0, len(i.warmup.entries))
+	for key := range i.warmup.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	entries := make([]WarmupEntry, 0, len(keys))
+	for _, key := range keys {
+		entries = append(entries, *i.warmup.entries[key])
+	}
+	return entries
+}
@@ -0,0 +1,106 @@
+package bird
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func setupWarmup(t *testing.T) *Instance {
+	path := startFakeBird(t, map[string]string{
+		"show status": "1000-BIRD 1.6.8\n" +
+			"0013 Daemon is up and running\n",
+		"show route all protocol 'R1'": "1007-1.2.3.0/24          via 172.25.3.10 on eth0 [R1 2021-03-30 02:28:25] * (100) [AS4242i]\n" +
+			"0000 \n",
+	})
+	instance := setupFakeBirdClient(t, path)
+	instance.Config.CacheTtl = 5
+	instance.setBirdVersion(1)
+
+	WarmupConf = WarmupConfig{Modules: []string{"status"}, BgpRoutes: true}
+	t.Cleanup(func() { WarmupConf = WarmupConfig{} })
+
+	cache.Set(instance.cacheKey("protocols all"), Parsed{"protocols": Parsed{
+		"R1": Parsed{"bird_protocol": "BGP", "state": "up", "bgp_state": "Established"},
+		"R2": Parsed{"bird_protocol": "BGP", "state": "start", "bgp_state": "Active"},
+		"K1": Parsed{"bird_protocol": "Kernel", "state": "up"},
+	}}, time.Minute)
+
+	return instance
+}
+
+func TestWarm(t *testing.T) {
+	instance := setupWarmup(t)
+
+	if count := instance.Warm(context.Background()); count != 2 {
+		t.Error("Expected 2 warmed results, got:", count)
+	}
+	for _, key := range []string{"status", "route all protocol 'R1'"} {
+		if _, err := cache.Get(instance.cacheKey(key)); err != nil {
+			t.Error("Expected cached result:", key, err)
+		}
+	}
+
+	status := instance.WarmupStatus()
+	if len(status) != 2 {
+		t.Fatal("Unexpected warmup status:", status)
+	}
+	if status[0].Module != "routes_protocol" || status[0].Protocol != "R1" {
+		t.Error("Unexpected entry:", status[0])
+	}
+	if status[1].Module != "status" || status[1].Error != nil {
+		t.Error("Unexpected entry:", status[1])
+	}
+	if status[1].Expires.Sub(status[1].WarmedAt) != 5*time.Minute {
+		t.Error("Unexpected expiry:", status[1])
+	}
+
+	// The results do not expire before the next run
+	if count := instance.Warm(context.Background()); count != 0 {
+		t.Error("Expected no warmed results, got:", count)
+	}
+}
+
+func TestWarmRateLimit(t *testing.T) {
+	instance := setupWarmup(t)
+
+	RateLimitConf.Lock()
+	RateLimitConf.Conf = RateLimitConfig{Enabled: true}
+	RateLimitConf.Unlock()
+	defer func() {
+		RateLimitConf.Lock()
+		RateLimitConf.Conf = RateLimitConfig{}
+		RateLimitConf.Unlock()
+	}()
+
+	if count := instance.Warm(context.Background()); count != 0 {
+		t.Error("Expected no warmed results, got:", count)
+	}
+
+	// The warmup stops at the first rejected query
+	status := instance.WarmupStatus()
+	if len(status) != 1 || status[0].Error == nil {
+		t.Fatal("Unexpected warmup status:", status)
+	}
+	if status[0].Error.HTTPStatus() != http.StatusTooManyRequests {
+		t.Error("Unexpected error:", status[0].Error)
+	}
+}
+
+func TestWarmupTargetsByCommand(t *testing.T) {
+	instance := setupWarmup(t)
+	WarmupConf = WarmupConfig{Modules: []string{
+		"symbols_tables", "protocols", "symbols", "protocols_bgp", "symbols_protocols", "status",
+	}}
+
+	targets := instance.warmupTargets(context.Background())
+	modules := []string{}
+	for _, target := range targets {
+		modules = append(modules, target.Module)
+	}
+	if len(modules) != 3 || modules[0] != "symbols_tables" ||
+		modules[1] != "protocols" || modules[2] != "status" {
+		t.Error("Expected a target per command, got:", modules)
+	}
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"flag"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"strings"
 
@@ -28,94 +30,286 @@ func isModuleEnabled(module string, modulesEnabled []string) bool {
 	return false
 }
 
-func makeRouter(config endpoints.ServerConfig) *httprouter.Router {
+// The routes of the API by module
+func moduleRoutes() []endpoints.Route {
+	return []endpoints.Route{
+		{Module: "status", Path: "/version", Handle: endpoints.Version(VERSION),
+			Summary: "Version of birdwatcher", Response: "Version"},
+		{Module: "status", Path: "/status", Handle: endpoints.Endpoint("status", endpoints.Status),
+			Summary: "Status of BIRD", Response: "Status"},
+		{Module: "protocols", Path: "/protocols", Handle: endpoints.Endpoint("protocols", endpoints.Protocols),
+			Summary: "Protocols", Response: "Protocols"},
+		{Module: "protocols_bgp", Path: "/protocols/bgp", Handle: endpoints.Endpoint("protocols_bgp", endpoints.Bgp),
+			Summary: "BGP protocols", Response: "Protocols"},
+		{Module: "protocols_short", Path: "/protocols/short", Handle: endpoints.Endpoint("protocols_short", endpoints.ProtocolsShort),
+			Summary: "Protocols without details", Response: "ProtocolsShort"},
+		{Module: "symbols", Path: "/symbols", Handle: endpoints.Endpoint("symbols", endpoints.Symbols),
+			Summary: "Symbols by type", Response: "Symbols"},
+		{Module: "symbols_tables", Path: "/symbols/tables", Handle: endpoints.Endpoint("symbols_tables", endpoints.SymbolTables),
+			Summary: "Routing tables", Response: "SymbolNames"},
+		{Module: "symbols_protocols", Path: "/symbols/protocols", Handle: endpoints.Endpoint("symbols_protocols", endpoints.SymbolProtocols),
+			Summary: "Protocol names", Response: "SymbolNames"},
+		{Module: "routes_protocol", Path: "/routes/protocol/:protocol",
+			Handle:  endpoints.StreamingEndpoint("routes_protocol", endpoints.ProtoRoutes, endpoints.ProtoRoutesStream),
+			Summary: "Routes of a protocol", Response: "Routes", Stream: true},
+		{Module: "routes_peer", Path: "/routes/peer/:peer", Handle: endpoints.Endpoint("routes_peer", endpoints.PeerRoutes),
+			Summary: "Routes learnt from a peer", Response: "Routes"},
+		{Module: "routes_table", Path: "/routes/table/:table",
+			Handle:  endpoints.StreamingEndpoint("routes_table", endpoints.TableRoutes, endpoints.TableRoutesStream),
+			Summary: "Routes of a table", Response: "Routes", Stream: true},
+		{Module: "routes_table_filtered", Path: "/routes/table/:table/filtered", Handle: endpoints.Endpoint("routes_table_filtered", endpoints.TableRoutesFiltered),
+			Summary: "Filtered routes of a table", Response: "Routes"},
+		{Module: "routes_table_peer", Path: "/routes/table/:table/peer/:peer", Handle: endpoints.Endpoint("routes_table_peer", endpoints.TableAndPeerRoutes),
+			Summary: "Routes of a table learnt from a peer", Response: "Routes"},
+		{Module: "routes_count_protocol", Path: "/routes/count/protocol/:protocol", Handle: endpoints.Endpoint("routes_count_protocol", endpoints.ProtoCount),
+			Summary: "Number of routes of a protocol", Response: "RoutesCount"},
+		{Module: "routes_count_table", Path: "/routes/count/table/:table", Handle: endpoints.Endpoint("routes_count_table", endpoints.TableCount),
+			Summary: "Number of routes of a table", Response: "RoutesCount"},
+		{Module: "routes_count_primary", Path: "/routes/count/primary/:protocol", Handle: endpoints.Endpoint("routes_count_primary", endpoints.ProtoPrimaryCount),
+			Summary: "Number of primary routes of a protocol", Response: "RoutesCount"},
+		{Module: "routes_filtered", Path: "/routes/filtered/:protocol", Handle: endpoints.Endpoint("routes_filtered", endpoints.RoutesFiltered),
+			Summary: "Routes filtered by a protocol", Response: "Routes"},
+		{Module: "routes_export", Path: "/routes/export/:protocol", Handle: endpoints.Endpoint("routes_export", endpoints.RoutesExport),
+			Summary: "Routes exported to a protocol", Response: "Routes"},
+		{Module: "routes_noexport", Path: "/routes/noexport/:protocol", Handle: endpoints.Endpoint("routes_noexport", endpoints.RoutesNoExport),
+			Summary: "Routes not exported to a protocol", Response: "Routes"},
+		{Module: "routes_prefixed", Path: "/routes/prefix", Handle: endpoints.Endpoint("routes_prefixed", endpoints.RoutesPrefixed),
+			Summary: "Routes for a prefix", Response: "Routes",
+			Query: []endpoints.QueryParam{{Name: "prefix", Required: true}}},
+		{Module: "route_net", Path: "/route/net/:net", Handle: endpoints.Endpoint("route_net", endpoints.RouteNet),
+			Summary: "Routes for a network", Response: "Routes"},
+		{Module: "route_net", Path: "/route/net/:net/table/:table", Handle: endpoints.Endpoint("route_net", endpoints.RouteNetTable),
+			Summary: "Routes for a network in a table", Response: "Routes"},
+		{Module: "route_net_mask", Path: "/route/net/:net/mask/:mask", Handle: endpoints.Endpoint("route_net_mask", endpoints.RouteNetMask),
+			Summary: "Routes for a network with mask", Response: "Routes"},
+		{Module: "route_net_mask", Path: "/route/net/:net/mask/:mask/table/:table", Handle: endpoints.Endpoint("route_net_mask", endpoints.RouteNetMaskTable),
+			Summary: "Routes for a network with mask in a table", Response: "Routes"},
+		{Module: "routes_pipe_filtered_count", Path: "/routes/pipe/filtered/count", Handle: endpoints.Endpoint("routes_pipe_filtered_count", endpoints.PipeRoutesFilteredCount),
+			Summary: "Number of routes from a neighbor filtered by a pipe", Response: "RoutesCount",
+			Query: []endpoints.QueryParam{
+				{Name: "table", Required: true},
+				{Name: "pipe", Required: true},
+				{Name: "address", Required: true},
+			}},
+		{Module: "routes_pipe_filtered", Path: "/routes/pipe/filtered", Handle: endpoints.Endpoint("routes_pipe_filtered", endpoints.PipeRoutesFiltered),
+			Summary: "Routes of a table filtered by a pipe", Response: "Routes",
+			Query: []endpoints.QueryParam{
+				{Name: "table", Required: true},
+				{Name: "pipe", Required: true},
+				{Name: "protocol"},
+			}},
+		{Module: "cache_warmup", Path: "/cache/warmup", Handle: endpoints.Endpoint("cache_warmup", endpoints.Warmup),
+			Summary: "Results refreshed in the background", Response: "Warmup"},
+		{Module: "cache", Path: "/cache", Handle: endpoints.AdminEndpoint("cache", endpoints.Cache),
+			Summary: "Cached results", Response: "Cache",
+			Query: []endpoints.QueryParam{{Name: "key_prefix"}}},
+		{Module: "cache", Method: http.MethodDelete, Path: "/cache", Handle: endpoints.AdminEndpoint("cache", endpoints.CachePurge),
+			Summary: "Remove cached results", Response: "CachePurge",
+			Query: []endpoints.QueryParam{{Name: "key"}, {Name: "key_prefix"}, {Name: "all"}}},
+		{Module: "metrics", Path: "/metrics", Handle: endpoints.Metrics,
+			Summary: "Metrics in the Prometheus text format", Response: "Metrics"},
+	}
+}
+
+// The checks for load balancers, served regardless of
+// the enabled modules. The readiness check covers the
+// instances, or if none are given, the instance of
+// the request.
+func healthRoutes(instances ...*bird.Instance) []endpoints.Route {
+	readyz := endpoints.Readyz
+	if len(instances) > 0 {
+		readyz = endpoints.ReadyzInstances(instances)
+	}
+	return []endpoints.Route{
+		{Module: "healthz", Path: "/healthz", Handle: endpoints.Healthz,
+			Summary: "Liveness of birdwatcher", Response: "Health"},
+		{Module: "readyz", Path: "/readyz", Handle: readyz,
+			Summary: "Readiness of BIRD and the cache", Response: "Health"},
+	}
+}
+
+// The list of the named instances, served next to
+// their APIs under /instances/:name
+func instancesRoute() endpoints.Route {
+	return endpoints.Route{Module: "instances", Path: "/instances",
+		Handle:  endpoints.Endpoint("instances", endpoints.Instances),
+		Summary: "Named BIRD instances", Response: "Instances"}
+}
+
+// Make the router of an instance. The named instances
+// are documented by the routers served at the root
+// of a listener.
+func makeRouter(config endpoints.ServerConfig, named []*bird.Instance) *httprouter.Router {
 	whitelist := config.ModulesEnabled
 
 	r := httprouter.New()
-	if isModuleEnabled("status", whitelist) {
-		r.GET("/version", endpoints.Version(VERSION))
-		r.GET("/status", endpoints.Endpoint(endpoints.Status))
-	}
-	if isModuleEnabled("protocols", whitelist) {
-		r.GET("/protocols", endpoints.Endpoint(endpoints.Protocols))
-	}
-	if isModuleEnabled("protocols_bgp", whitelist) {
-		r.GET("/protocols/bgp", endpoints.Endpoint(endpoints.Bgp))
-	}
-	if isModuleEnabled("protocols_short", whitelist) {
-		r.GET("/protocols/short", endpoints.Endpoint(endpoints.ProtocolsShort))
-	}
-	if isModuleEnabled("symbols", whitelist) {
-		r.GET("/symbols", endpoints.Endpoint(endpoints.Symbols))
-	}
-	if isModuleEnabled("symbols_tables", whitelist) {
-		r.GET("/symbols/tables", endpoints.Endpoint(endpoints.SymbolTables))
-	}
-	if isModuleEnabled("symbols_protocols", whitelist) {
-		r.GET("/symbols/protocols", endpoints.Endpoint(endpoints.SymbolProtocols))
-	}
-	if isModuleEnabled("routes_protocol", whitelist) {
-		r.GET("/routes/protocol/:protocol", endpoints.Endpoint(endpoints.ProtoRoutes))
-	}
-	if isModuleEnabled("routes_peer", whitelist) {
-		r.GET("/routes/peer/:peer", endpoints.Endpoint(endpoints.PeerRoutes))
-	}
-	if isModuleEnabled("routes_table", whitelist) {
-		r.GET("/routes/table/:table", endpoints.Endpoint(endpoints.TableRoutes))
-	}
-	if isModuleEnabled("routes_table_filtered", whitelist) {
-		r.GET("/routes/table/:table/filtered", endpoints.Endpoint(endpoints.TableRoutesFiltered))
-	}
-	if isModuleEnabled("routes_table_peer", whitelist) {
-		r.GET("/routes/table/:table/peer/:peer", endpoints.Endpoint(endpoints.TableAndPeerRoutes))
-	}
-	if isModuleEnabled("routes_count_protocol", whitelist) {
-		r.GET("/routes/count/protocol/:protocol", endpoints.Endpoint(endpoints.ProtoCount))
-	}
-	if isModuleEnabled("routes_count_table", whitelist) {
-		r.GET("/routes/count/table/:table", endpoints.Endpoint(endpoints.TableCount))
-	}
-	if isModuleEnabled("routes_count_primary", whitelist) {
-		r.GET("/routes/count/primary/:protocol", endpoints.Endpoint(endpoints.ProtoPrimaryCount))
-	}
-	if isModuleEnabled("routes_filtered", whitelist) {
-		r.GET("/routes/filtered/:protocol", endpoints.Endpoint(endpoints.RoutesFiltered))
-	}
-	if isModuleEnabled("routes_export", whitelist) {
-		r.GET("/routes/export/:protocol", endpoints.Endpoint(endpoints.RoutesExport))
-	}
-	if isModuleEnabled("routes_noexport", whitelist) {
-		r.GET("/routes/noexport/:protocol", endpoints.Endpoint(endpoints.RoutesNoExport))
-	}
-	if isModuleEnabled("routes_prefixed", whitelist) {
-		r.GET("/routes/prefix", endpoints.Endpoint(endpoints.RoutesPrefixed))
-	}
-	if isModuleEnabled("route_net", whitelist) {
-		r.GET("/route/net/:net", endpoints.Endpoint(endpoints.RouteNet))
-		r.GET("/route/net/:net/table/:table", endpoints.Endpoint(endpoints.RouteNetTable))
-	}
-	if isModuleEnabled("route_net_mask", whitelist) {
-		r.GET("/route/net/:net/mask/:mask", endpoints.Endpoint(endpoints.RouteNetMask))
-		r.GET("/route/net/:net/mask/:mask/table/:table", endpoints.Endpoint(endpoints.RouteNetMaskTable))
+	enabled := []endpoints.Route{}
+	for _, route := range moduleRoutes() {
+		if isModuleEnabled(route.Module, whitelist) {
+			r.Handle(route.HTTPMethod(), route.Path, route.Handle)
+			enabled = append(enabled, route)
+		}
 	}
-	if isModuleEnabled("routes_pipe_filtered_count", whitelist) {
-		r.GET("/routes/pipe/filtered/count", endpoints.Endpoint(endpoints.PipeRoutesFilteredCount))
+	for _, route := range healthRoutes() {
+		r.Handle(route.HTTPMethod(), route.Path, route.Handle)
+		enabled = append(enabled, route)
 	}
-	if isModuleEnabled("routes_pipe_filtered", whitelist) {
-		r.GET("/routes/pipe/filtered", endpoints.Endpoint(endpoints.PipeRoutesFiltered))
+
+	// Describe the enabled routes
+	documented := enabled
+	names := []string{}
+	if len(named) > 0 {
+		documented = append(documented, instancesRoute())
+		for _, instance := range named {
+			names = append(names, instance.Name)
+		}
 	}
+	r.GET("/openapi.json", endpoints.OpenAPI(VERSION, documented, names))
 
 	return r
 }
 
+// Serve the queries of the instance
+func instanceHandler(instance *bird.Instance, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		h.ServeHTTP(w, req.WithContext(bird.WithInstance(req.Context(), instance)))
+	})
+}
+
+// A listener serves one or more instances
+type listener struct {
+	addr    string
+	handler http.Handler
+}
+
+// Make a listener for every listen address of the
+// instances. If instances share an address, each
+// is served under the prefix of its name, e.g. /v4,
+// and the health checks of all are served at the
+// root. The named instances are served by every
+// listener.
+func makeListeners(
+	config endpoints.ServerConfig,
+	instances []*bird.Instance,
+	named []*bird.Instance,
+	logger io.Writer,
+) []listener {
+	addrs := []string{}
+	byAddr := map[string][]*bird.Instance{}
+	for _, instance := range instances {
+		addr := instance.Config.Listen
+		if _, ok := byAddr[addr]; !ok {
+			addrs = append(addrs, addr)
+		}
+		byAddr[addr] = append(byAddr[addr], instance)
+	}
+
+	var namedHandler http.Handler
+	if len(named) > 0 {
+		namedHandler = namedInstancesHandler(config, named, logger)
+	}
+
+	listeners := []listener{}
+	for _, addr := range addrs {
+		var handler http.Handler
+		shared := byAddr[addr]
+		if len(shared) == 1 {
+			h := instanceHandler(shared[0], makeRouter(config, named))
+			handler = logRequests(logger, h)
+		} else {
+			mux := http.NewServeMux()
+			for _, instance := range shared {
+				prefix := "/" + instance.Name
+				h := instanceHandler(instance, makeRouter(config, nil))
+				mux.Handle(prefix+"/", http.StripPrefix(prefix, logRequests(logger, h)))
+			}
+			root := httprouter.New()
+			for _, route := range healthRoutes(shared...) {
+				root.Handle(route.HTTPMethod(), route.Path, route.Handle)
+			}
+			mux.Handle("/", logRequests(logger, root))
+			handler = mux
+		}
+
+		if namedHandler != nil {
+			mux := http.NewServeMux()
+			mux.Handle("/", handler)
+			mux.Handle("/instances", namedHandler)
+			mux.Handle("/instances/", namedHandler)
+			handler = mux
+		}
+		listeners = append(listeners, listener{addr, handler})
+	}
+	return listeners
+}
+
+// Serve the API of the named instances under
+// /instances/:name and list them at /instances.
+func namedInstancesHandler(
+	config endpoints.ServerConfig,
+	instances []*bird.Instance,
+	logger io.Writer,
+) http.Handler {
+	routers := map[string]http.Handler{}
+	for _, instance := range instances {
+		prefix := "/instances/" + instance.Name
+		h := instanceHandler(instance, makeRouter(config, nil))
+		routers[instance.Name] = http.StripPrefix(prefix, logRequests(logger, h))
+	}
+
+	list := httprouter.New()
+	route := instancesRoute()
+	list.Handle(route.HTTPMethod(), route.Path, route.Handle)
+	listHandler := logRequests(logger, list)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/instances" {
+			listHandler.ServeHTTP(w, req)
+			return
+		}
+		name := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/instances/"), "/", 2)[0]
+		router, ok := routers[name]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		router.ServeHTTP(w, req)
+	})
+}
+
+// Log the requests to the router, except for the
+// health checks which are polled by load balancers.
+func logRequests(out io.Writer, r http.Handler) http.Handler {
+	logged := handlers.LoggingHandler(out, r)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		for _, path := range endpoints.HealthPaths {
+			if req.URL.Path == path {
+				r.ServeHTTP(w, req)
+				return
+			}
+		}
+		logged.ServeHTTP(w, req)
+	})
+}
+
 // Print service information like, listen address,
 // access restrictions and configuration flags
-func PrintServiceInfo(conf *Config, birdConf bird.BirdConfig) {
+func PrintServiceInfo(conf *Config, instances []*bird.Instance) {
 	// General Info
 	log.Println("Starting Birdwatcher")
-	log.Println("            Using:", birdConf.BirdCmd)
-	log.Println("           Listen:", birdConf.Listen)
-	log.Println("        Cache TTL:", birdConf.CacheTtl)
+	for _, instance := range instances {
+		birdConf := instance.Config
+		if instance.Name != "" {
+			log.Println("         Instance:", instance.Name)
+		}
+		if birdConf.Socket != "" {
+			log.Println("            Using:", birdConf.Socket, "(socket)")
+		} else {
+			log.Println("            Using:", birdConf.BirdCmd)
+		}
+		log.Println("           Listen:", birdConf.Listen)
+		log.Println("        Cache TTL:", birdConf.CacheTtl)
+	}
 
 	// Endpoint Info
 	if len(conf.Server.AllowFrom) == 0 {
@@ -127,6 +321,9 @@ func PrintServiceInfo(conf *Config, birdConf bird.BirdConfig) {
 	if conf.Cache.UseRedis {
 		log.Println("    Caching backend: REDIS")
 		log.Println("       Using server:", conf.Cache.RedisServer)
+	} else if conf.Cache.UseDisk {
+		log.Println("    Caching backend: DISK")
+		log.Println("         Using path:", conf.Cache.DiskPath)
 	} else {
 		log.Println("    Caching backend: MEMORY")
 	}
@@ -152,6 +349,7 @@ func main() {
 	// Disable timestamps for the default logger, as they are generated by the syslog implementation
 	log.SetFlags(log.Flags() &^ (log.Ldate | log.Ltime))
 	bird6 := flag.Bool("6", false, "Use bird6 instead of bird")
+	both := flag.Bool("both", false, "Serve bird and bird6 from a single process")
 	workerPoolSize := flag.Int("worker-pool-size", 8, "Number of go routines used to parse routing tables concurrently")
 	configfile := flag.String("config", "/etc/birdwatcher/birdwatcher.conf", "Configuration file location")
 
@@ -182,16 +380,41 @@ func main() {
 	bird.InstallRateLimitReset()
 
 	// Get config according to flags
-	birdConf := conf.Bird
-	if *bird6 {
-		birdConf = conf.Bird6
-		bird.IPVersion = "6"
+	instances := []*bird.Instance{}
+	switch {
+	case *both:
+		instances = append(instances,
+			bird.NewInstance("v4", conf.Bird, "4"),
+			bird.NewInstance("v6", conf.Bird6, "6"))
+	case *bird6:
+		instances = append(instances, bird.NewInstance("", conf.Bird6, "6"))
+	default:
+		instances = append(instances, bird.NewInstance("", conf.Bird, "4"))
+	}
+	bird.Default = instances[0]
+
+	for name, instanceConf := range conf.Instances {
+		instance, err := bird.NewNamedInstance(name, instanceConf)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, i := range instances {
+			if i.Name == name { // The results would share the cache
+				log.Fatal("Instance name is reserved:", name)
+			}
+		}
+		if err := bird.RegisterInstance(instance); err != nil {
+			log.Fatal(err)
+		}
+	}
+	named := bird.Instances()
+	if err := bird.ValidateCacheNamespaces(append(instances, named...)); err != nil {
+		log.Fatal(err)
 	}
 
-	PrintServiceInfo(conf, birdConf)
+	PrintServiceInfo(conf, append(instances, named...))
 
 	// Configuration
-	bird.ClientConf = birdConf
 	bird.StatusConf = conf.Status
 	bird.RateLimitConf.Lock()
 	bird.RateLimitConf.Conf = conf.Ratelimit
@@ -199,11 +422,18 @@ func main() {
 	bird.ParserConf = conf.Parser
 	bird.CacheConf = conf.Cache
 	bird.InitializeCache()
+	bird.WarmupConf = conf.Warmup
+	for _, module := range conf.Warmup.Modules {
+		if !bird.IsWarmupModule(module) {
+			log.Println("Warmup of module not supported:", module)
+		}
+	}
 
-	endpoints.Conf = conf.Server
+	for _, instance := range append(instances, named...) {
+		instance.InitializeSocketPool()
+	}
 
-	// Make server
-	r := makeRouter(conf.Server)
+	endpoints.Conf = conf.Server
 
 	// Set up our own custom log.Logger without a prefix
 	myquerylog := log.New(os.Stdout, "", 0)
@@ -211,14 +441,34 @@ func main() {
 	myquerylog.SetFlags(myquerylog.Flags() &^ (log.Ldate | log.Ltime))
 	mylogger := &MyLogger{myquerylog}
 
-	go Housekeeping(conf.Housekeeping, !(bird.CacheConf.UseRedis)) // expire caches only for MemoryCache
+	// Make servers
+	listeners := makeListeners(conf.Server, instances, named, mylogger)
+
+	// expire caches only for MemoryCache and DiskCache
+	go Housekeeping(conf.Housekeeping, bird.CacheBackend() != "redis")
+	if conf.Warmup.Interval > 0 {
+		go Warmup(conf.Warmup, append(instances, named...))
+	}
+	if conf.Cache.InvalidateOnReconfig && conf.Cache.ReconfigCheckInterval > 0 {
+		interval := time.Duration(conf.Cache.ReconfigCheckInterval) * time.Second
+		go WatchReconfig(interval, append(instances, named...))
+	}
 
 	if conf.Server.EnableTLS {
 		if len(conf.Server.Crt) == 0 || len(conf.Server.Key) == 0 {
 			log.Fatalln("You have enabled TLS support but not specified both a .crt and a .key file in the config.")
 		}
-		log.Fatal(http.ListenAndServeTLS(birdConf.Listen, conf.Server.Crt, conf.Server.Key, handlers.LoggingHandler(mylogger, r)))
-	} else {
-		log.Fatal(http.ListenAndServe(birdConf.Listen, handlers.LoggingHandler(mylogger, r)))
 	}
+
+	errs := make(chan error)
+	for _, l := range listeners {
+		go func(l listener) {
+			if conf.Server.EnableTLS {
+				errs <- http.ListenAndServeTLS(l.addr, conf.Server.Crt, conf.Server.Key, l.handler)
+			} else {
+				errs <- http.ListenAndServe(l.addr, l.handler)
+			}
+		}(l)
+	}
+	log.Fatal(<-errs)
 }
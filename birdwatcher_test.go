@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alice-lg/birdwatcher/bird"
+	"github.com/alice-lg/birdwatcher/endpoints"
+)
+
+func getOpenAPI(t *testing.T, modules []string) map[string]interface{} {
+	r := makeRouter(endpoints.ServerConfig{ModulesEnabled: modules}, nil)
+
+	req := httptest.NewRequest("GET", "/openapi.json", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatal("Unexpected status:", rec.Code)
+	}
+
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestOpenAPIDocumentsRoutes(t *testing.T) {
+	modules := []string{}
+	for _, route := range moduleRoutes() {
+		modules = append(modules, route.Module)
+	}
+	r := makeRouter(endpoints.ServerConfig{ModulesEnabled: modules}, nil)
+	doc := getOpenAPI(t, modules)
+	paths := doc["paths"].(map[string]interface{})
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+
+	for _, route := range append(moduleRoutes(), healthRoutes()...) {
+		// The route is registered
+		if handle, _, _ := r.Lookup(route.HTTPMethod(), route.Path); handle == nil {
+			t.Error("Route not registered:", route.Path)
+		}
+
+		// and documented
+		path, ok := paths[endpoints.OpenAPIPath(route.Path)].(map[string]interface{})
+		if !ok {
+			t.Error("Route not documented:", route.Path)
+			continue
+		}
+		op, ok := path[strings.ToLower(route.HTTPMethod())].(map[string]interface{})
+		if !ok {
+			t.Error("Method not documented:", route.HTTPMethod(), route.Path)
+			continue
+		}
+
+		// with all path params
+		params := map[string]bool{}
+		for _, p := range op["parameters"].([]interface{}) {
+			param := p.(map[string]interface{})
+			params[param["name"].(string)] = true
+		}
+		for _, segment := range strings.Split(route.Path, "/") {
+			if strings.HasPrefix(segment, ":") && !params[segment[1:]] {
+				t.Error("Param not documented:", route.Path, segment)
+			}
+		}
+
+		if route.Response != "Version" && route.Response != "Metrics" {
+			if _, ok := schemas[route.Response]; !ok {
+				t.Error("Response schema missing:", route.Response)
+			}
+		}
+	}
+}
+
+func TestOpenAPIEnabledModules(t *testing.T) {
+	doc := getOpenAPI(t, []string{"status", "routes_protocol"})
+	paths := doc["paths"].(map[string]interface{})
+
+	for _, path := range []string{"/status", "/version", "/routes/protocol/{protocol}", "/healthz", "/readyz"} {
+		if _, ok := paths[path]; !ok {
+			t.Error("Expected path:", path)
+		}
+	}
+	if len(paths) != 5 {
+		t.Error("Unexpected paths:", paths)
+	}
+}
+
+func TestHealthChecksNotLogged(t *testing.T) {
+	r := makeRouter(endpoints.ServerConfig{}, nil)
+	log := &bytes.Buffer{}
+	handler := logRequests(log, r)
+
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Error("Unexpected status:", rec.Code)
+	}
+	res := endpoints.HealthResponse{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || res.Status != "ok" {
+		t.Error("Unexpected response:", rec.Body.String())
+	}
+	if log.Len() != 0 {
+		t.Error("Health check was logged:", log.String())
+	}
+
+	req = httptest.NewRequest("GET", "/openapi.json", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if !strings.Contains(log.String(), "/openapi.json") {
+		t.Error("Expected request to be logged:", log.String())
+	}
+}
+
+func TestMakeListeners(t *testing.T) {
+	v4 := bird.NewInstance("v4", bird.BirdConfig{Listen: ":29184"}, "4")
+	v6 := bird.NewInstance("v6", bird.BirdConfig{Listen: ":29186"}, "6")
+
+	listeners := makeListeners(endpoints.ServerConfig{}, []*bird.Instance{v4, v6}, nil, ioutil.Discard)
+	if len(listeners) != 2 || listeners[1].addr != ":29186" {
+		t.Fatal("Expected a listener per address:", listeners)
+	}
+
+	// Instances sharing an address are served under a prefix
+	v6.Config.Listen = ":29184"
+	listeners = makeListeners(endpoints.ServerConfig{}, []*bird.Instance{v4, v6}, nil, ioutil.Discard)
+	if len(listeners) != 1 {
+		t.Fatal("Expected a single listener:", listeners)
+	}
+	for path, status := range map[string]int{
+		"/v4/healthz":      http.StatusOK,
+		"/v6/healthz":      http.StatusOK,
+		"/healthz":         http.StatusOK,
+		"/v5/healthz":      http.StatusNotFound,
+		"/v6/openapi.json": http.StatusOK,
+	} {
+		rec := httptest.NewRecorder()
+		listeners[0].handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != status {
+			t.Error("Unexpected status for", path, rec.Code)
+		}
+	}
+}
+
+func TestMakeListenersSharedHealthChecks(t *testing.T) {
+	v4 := bird.NewInstance("v4", bird.BirdConfig{Listen: ":29184", Socket: "/nonexistent/bird.ctl"}, "4")
+	v6 := bird.NewInstance("v6", bird.BirdConfig{Listen: ":29184", Socket: "/nonexistent/bird6.ctl"}, "6")
+	listeners := makeListeners(endpoints.ServerConfig{}, []*bird.Instance{v4, v6}, nil, ioutil.Discard)
+	if len(listeners) != 1 {
+		t.Fatal("Expected a single listener:", listeners)
+	}
+
+	rec := httptest.NewRecorder()
+	listeners[0].handler.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Error("Unexpected status for /healthz:", rec.Code)
+	}
+
+	// The readiness covers every instance on the address
+	rec = httptest.NewRecorder()
+	listeners[0].handler.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Error("Unexpected status for /readyz:", rec.Code)
+	}
+	res := endpoints.HealthResponse{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"v4.bird", "v6.bird", "cache"} {
+		if _, ok := res.Checks[name]; !ok {
+			t.Error("Expected check:", name, res.Checks)
+		}
+	}
+	if res.Checks["v4.bird"].OK || res.Checks["v6.bird"].OK {
+		t.Error("Expected the checks of BIRD to fail:", res.Checks)
+	}
+}
+
+func TestNamedInstances(t *testing.T) {
+	blue, err := bird.NewNamedInstance("blue", bird.InstanceConfig{IPVersion: "6"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bird.GetInstance("blue"); !ok {
+		if err := bird.RegisterInstance(blue); err != nil {
+			t.Fatal(err)
+		}
+	}
+	v4 := bird.NewInstance("", bird.BirdConfig{Listen: ":29184"}, "4")
+
+	listeners := makeListeners(endpoints.ServerConfig{}, []*bird.Instance{v4}, []*bird.Instance{blue}, ioutil.Discard)
+	if len(listeners) != 1 {
+		t.Fatal("Expected a single listener:", listeners)
+	}
+	for path, status := range map[string]int{
+		"/healthz":                     http.StatusOK,
+		"/instances":                   http.StatusOK,
+		"/instances/blue/healthz":      http.StatusOK,
+		"/instances/blue/openapi.json": http.StatusOK,
+		"/instances/red/healthz":       http.StatusNotFound,
+		"/instances/blue":              http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		listeners[0].handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != status {
+			t.Error("Unexpected status for", path, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	listeners[0].handler.ServeHTTP(rec, httptest.NewRequest("GET", "/instances", nil))
+	res := struct {
+		Instances map[string]struct {
+			IPVersion string `json:"ip_version"`
+		} `json:"instances"`
+	}{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Instances["blue"].IPVersion != "6" {
+		t.Error("Unexpected instances:", rec.Body.String())
+	}
+
+	// The list and the prefix of the named instances
+	// are documented at the root.
+	for path, documented := range map[string]bool{
+		"/openapi.json":                true,
+		"/instances/blue/openapi.json": false,
+	} {
+		rec := httptest.NewRecorder()
+		listeners[0].handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		doc := struct {
+			Paths   map[string]interface{} `json:"paths"`
+			Servers []struct {
+				URL       string `json:"url"`
+				Variables map[string]struct {
+					Enum []string `json:"enum"`
+				} `json:"variables"`
+			} `json:"servers"`
+		}{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := doc.Paths["/instances"]; ok != documented {
+			t.Error(path, ": unexpected paths:", doc.Paths)
+		}
+		if !documented {
+			continue
+		}
+		if len(doc.Servers) != 2 || doc.Servers[1].URL != "/instances/{name}" ||
+			doc.Servers[1].Variables["name"].Enum[0] != "blue" {
+			t.Error("Unexpected servers:", doc.Servers)
+		}
+	}
+}
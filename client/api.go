@@ -0,0 +1,267 @@
+package client
+
+// The endpoints of the birdwatcher API
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/alice-lg/birdwatcher/bird"
+)
+
+// APIInfo is the envelope of every response
+type APIInfo struct {
+	Version         string      `json:"Version"`
+	ResultFromCache bool        `json:"result_from_cache"`
+	CacheStatus     CacheStatus `json:"cache_status"`
+	Pagination      *Pagination `json:"pagination,omitempty"`
+}
+
+// CacheStatus tells when the result was cached
+type CacheStatus struct {
+	CachedAt struct {
+		Date time.Time `json:"date"`
+	} `json:"cached_at"`
+	Stale bool `json:"stale"` // The result expired and is refreshed
+}
+
+// Pagination of a route listing
+type Pagination struct {
+	Page         int    `json:"page"`
+	PageSize     int    `json:"page_size"`
+	TotalPages   int    `json:"total_pages"`
+	TotalResults int    `json:"total_results"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+}
+
+// StatusResponse of /status
+type StatusResponse struct {
+	API    APIInfo          `json:"api"`
+	Status *bird.BirdStatus `json:"status"`
+}
+
+// ProtocolsResponse of /protocols and /protocols/bgp
+type ProtocolsResponse struct {
+	API       APIInfo                   `json:"api"`
+	Protocols map[string]*bird.Protocol `json:"protocols"`
+}
+
+// ProtocolSummary is a protocol as listed by
+// `show protocols`
+type ProtocolSummary struct {
+	Proto string `json:"proto"`
+	Table string `json:"table"`
+	State string `json:"state"`
+	Since string `json:"since"`
+	Info  string `json:"info"`
+}
+
+// ProtocolsShortResponse of /protocols/short
+type ProtocolsShortResponse struct {
+	API       APIInfo                     `json:"api"`
+	Protocols map[string]*ProtocolSummary `json:"protocols"`
+}
+
+// SymbolsResponse of /symbols, the symbol names by type
+type SymbolsResponse struct {
+	API     APIInfo             `json:"api"`
+	Symbols map[string][]string `json:"symbols"`
+}
+
+// SymbolNamesResponse of /symbols/tables and
+// /symbols/protocols
+type SymbolNamesResponse struct {
+	API     APIInfo  `json:"api"`
+	Symbols []string `json:"symbols"`
+}
+
+// RoutesResponse of the route listings
+type RoutesResponse struct {
+	API    APIInfo       `json:"api"`
+	Routes []*bird.Route `json:"routes"`
+}
+
+// RoutesCountResponse of the route counts
+type RoutesCountResponse struct {
+	API    APIInfo `json:"api"`
+	Routes int64   `json:"routes"`
+}
+
+// Version of the birdwatcher
+func (c *Client) Version(ctx context.Context) (string, error) {
+	version := ""
+	err := c.Get(ctx, "/version", nil, &version)
+	return version, err
+}
+
+// Status of the BIRD daemon
+func (c *Client) Status(ctx context.Context) (*StatusResponse, error) {
+	res := &StatusResponse{}
+	return res, c.Get(ctx, "/status", nil, res)
+}
+
+// Protocols with details
+func (c *Client) Protocols(ctx context.Context) (*ProtocolsResponse, error) {
+	res := &ProtocolsResponse{}
+	return res, c.Get(ctx, "/protocols", nil, res)
+}
+
+// ProtocolsBgp lists the BGP protocols
+func (c *Client) ProtocolsBgp(ctx context.Context) (*ProtocolsResponse, error) {
+	res := &ProtocolsResponse{}
+	return res, c.Get(ctx, "/protocols/bgp", nil, res)
+}
+
+// ProtocolsShort lists the protocols without details
+func (c *Client) ProtocolsShort(ctx context.Context) (*ProtocolsShortResponse, error) {
+	res := &ProtocolsShortResponse{}
+	return res, c.Get(ctx, "/protocols/short", nil, res)
+}
+
+// Symbols by type
+func (c *Client) Symbols(ctx context.Context) (*SymbolsResponse, error) {
+	res := &SymbolsResponse{}
+	return res, c.Get(ctx, "/symbols", nil, res)
+}
+
+// SymbolTables lists the routing tables
+func (c *Client) SymbolTables(ctx context.Context) (*SymbolNamesResponse, error) {
+	res := &SymbolNamesResponse{}
+	return res, c.Get(ctx, "/symbols/tables", nil, res)
+}
+
+// SymbolProtocols lists the protocols
+func (c *Client) SymbolProtocols(ctx context.Context) (*SymbolNamesResponse, error) {
+	res := &SymbolNamesResponse{}
+	return res, c.Get(ctx, "/symbols/protocols", nil, res)
+}
+
+// The route listings accept query parameters for
+// filtering, sorting and pagination, e.g. page=1.
+func (c *Client) routes(
+	ctx context.Context,
+	path string,
+	query url.Values,
+) (*RoutesResponse, error) {
+	res := &RoutesResponse{}
+	return res, c.Get(ctx, path, query, res)
+}
+
+func (c *Client) routesCount(ctx context.Context, path string, query url.Values) (*RoutesCountResponse, error) {
+	res := &RoutesCountResponse{}
+	return res, c.Get(ctx, path, query, res)
+}
+
+// RoutesProtocol lists the routes of a protocol
+func (c *Client) RoutesProtocol(ctx context.Context, protocol string, query url.Values) (*RoutesResponse, error) {
+	return c.routes(ctx, "/routes/protocol/"+url.PathEscape(protocol), query)
+}
+
+// RoutesPeer lists the routes learnt from a peer
+func (c *Client) RoutesPeer(ctx context.Context, peer string, query url.Values) (*RoutesResponse, error) {
+	return c.routes(ctx, "/routes/peer/"+url.PathEscape(peer), query)
+}
+
+// RoutesTable lists the routes of a table
+func (c *Client) RoutesTable(ctx context.Context, table string, query url.Values) (*RoutesResponse, error) {
+	return c.routes(ctx, "/routes/table/"+url.PathEscape(table), query)
+}
+
+// RoutesTableFiltered lists the filtered routes of a table
+func (c *Client) RoutesTableFiltered(ctx context.Context, table string, query url.Values) (*RoutesResponse, error) {
+	return c.routes(ctx, "/routes/table/"+url.PathEscape(table)+"/filtered", query)
+}
+
+// RoutesTablePeer lists the routes of a table learnt from a peer
+func (c *Client) RoutesTablePeer(ctx context.Context, table, peer string, query url.Values) (*RoutesResponse, error) {
+	return c.routes(ctx,
+		"/routes/table/"+url.PathEscape(table)+"/peer/"+url.PathEscape(peer), query)
+}
+
+// RoutesFiltered lists the routes filtered by a protocol
+func (c *Client) RoutesFiltered(ctx context.Context, protocol string, query url.Values) (*RoutesResponse, error) {
+	return c.routes(ctx, "/routes/filtered/"+url.PathEscape(protocol), query)
+}
+
+// RoutesExport lists the routes exported to a protocol
+func (c *Client) RoutesExport(ctx context.Context, protocol string, query url.Values) (*RoutesResponse, error) {
+	return c.routes(ctx, "/routes/export/"+url.PathEscape(protocol), query)
+}
+
+// RoutesNoExport lists the routes not exported to a protocol
+func (c *Client) RoutesNoExport(ctx context.Context, protocol string, query url.Values) (*RoutesResponse, error) {
+	return c.routes(ctx, "/routes/noexport/"+url.PathEscape(protocol), query)
+}
+
+// RoutesPrefixed lists the routes for a prefix
+func (c *Client) RoutesPrefixed(ctx context.Context, prefix string, query url.Values) (*RoutesResponse, error) {
+	query = cloneQuery(query)
+	query.Set("prefix", prefix)
+	return c.routes(ctx, "/routes/prefix", query)
+}
+
+// RouteNet looks up the routes for a network in the
+// master table
+func (c *Client) RouteNet(ctx context.Context, net string) (*RoutesResponse, error) {
+	return c.routes(ctx, "/route/net/"+url.PathEscape(net), nil)
+}
+
+// RouteNetTable looks up the routes for a network in a table
+func (c *Client) RouteNetTable(ctx context.Context, net, table string) (*RoutesResponse, error) {
+	return c.routes(ctx,
+		"/route/net/"+url.PathEscape(net)+"/table/"+url.PathEscape(table), nil)
+}
+
+// RouteNetMask looks up the routes for a network with
+// the mask, e.g. 24, in the master table
+func (c *Client) RouteNetMask(ctx context.Context, net, mask string) (*RoutesResponse, error) {
+	return c.routes(ctx,
+		"/route/net/"+url.PathEscape(net)+"/mask/"+url.PathEscape(mask), nil)
+}
+
+// RouteNetMaskTable looks up the routes for a network
+// with the mask in a table
+func (c *Client) RouteNetMaskTable(ctx context.Context, net, mask, table string) (*RoutesResponse, error) {
+	return c.routes(ctx,
+		"/route/net/"+url.PathEscape(net)+"/mask/"+url.PathEscape(mask)+
+			"/table/"+url.PathEscape(table), nil)
+}
+
+// PipeRoutesFiltered lists the routes of a table filtered
+// by a pipe. If a protocol is given, only the routes
+// from the protocol are listed.
+func (c *Client) PipeRoutesFiltered(ctx context.Context, pipe, table, protocol string, query url.Values) (*RoutesResponse, error) {
+	query = cloneQuery(query)
+	query.Set("pipe", pipe)
+	query.Set("table", table)
+	if protocol != "" {
+		query.Set("protocol", protocol)
+	}
+	return c.routes(ctx, "/routes/pipe/filtered", query)
+}
+
+// RoutesCountProtocol counts the routes of a protocol
+func (c *Client) RoutesCountProtocol(ctx context.Context, protocol string) (*RoutesCountResponse, error) {
+	return c.routesCount(ctx, "/routes/count/protocol/"+url.PathEscape(protocol), nil)
+}
+
+// RoutesCountTable counts the routes of a table
+func (c *Client) RoutesCountTable(ctx context.Context, table string) (*RoutesCountResponse, error) {
+	return c.routesCount(ctx, "/routes/count/table/"+url.PathEscape(table), nil)
+}
+
+// RoutesCountPrimary counts the primary routes of a protocol
+func (c *Client) RoutesCountPrimary(ctx context.Context, protocol string) (*RoutesCountResponse, error) {
+	return c.routesCount(ctx, "/routes/count/primary/"+url.PathEscape(protocol), nil)
+}
+
+// PipeRoutesFilteredCount counts the routes from a
+// neighbor address filtered by a pipe
+func (c *Client) PipeRoutesFilteredCount(ctx context.Context, pipe, table, address string) (*RoutesCountResponse, error) {
+	query := url.Values{}
+	query.Set("pipe", pipe)
+	query.Set("table", table)
+	query.Set("address", address)
+	return c.routesCount(ctx, "/routes/pipe/filtered/count", query)
+}
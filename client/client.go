@@ -0,0 +1,185 @@
+// Package client is a client for the birdwatcher API.
+package client
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/alice-lg/birdwatcher/bird"
+)
+
+// Config of a client for a birdwatcher instance
+type Config struct {
+	// URL of the birdwatcher, e.g. http://rs1.example.net:29184
+	URL string
+
+	// Timeout of a request, including retries. A timeout
+	// of 0 disables the timeout.
+	Timeout time.Duration
+
+	// Retries of failed requests and the delay between them.
+	// Requests are retried on connection errors and server
+	// errors, not if the request was invalid.
+	Retries    int
+	RetryDelay time.Duration
+
+	// Uncached requests bypass the cache of the birdwatcher.
+	// The birdwatcher must be configured with allow_uncached.
+	Uncached bool
+
+	// TLS configures the connection to a birdwatcher
+	// with enable_tls, e.g. a custom CA.
+	TLS *tls.Config
+
+	// HTTPClient overrides the http client. The TLS
+	// config is not used in this case.
+	HTTPClient *http.Client
+}
+
+// Client for the birdwatcher API
+type Client struct {
+	config Config
+	url    *url.URL
+	http   *http.Client
+}
+
+// New creates a client from the config
+func New(config Config) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(config.URL, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported url: %s", config.URL)
+	}
+
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = config.TLS
+		httpClient = &http.Client{Transport: transport}
+	}
+	if config.RetryDelay == 0 {
+		config.RetryDelay = 500 * time.Millisecond
+	}
+
+	return &Client{
+		config: config,
+		url:    u,
+		http:   httpClient,
+	}, nil
+}
+
+// Get requests the path and decodes the response into
+// res. A *string res is set to the plain text response.
+// Errors reported by the birdwatcher are returned
+// as *bird.Error.
+func (c *Client) Get(ctx context.Context, path string, query url.Values, res interface{}) error {
+	if c.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.Timeout)
+		defer cancel()
+	}
+
+	u := *c.url
+	u.Path += path
+	query = cloneQuery(query)
+	if c.config.Uncached {
+		query.Set("uncached", "true")
+	}
+	u.RawQuery = query.Encode()
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = c.get(ctx, u.String(), res)
+		if !retry || attempt >= c.config.Retries {
+			return err
+		}
+
+		select {
+		case <-time.After(c.config.RetryDelay):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// Request the url. The returned flag is true if
+// the request can be retried.
+func (c *Client) get(ctx context.Context, u string, res interface{}) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	body := io.Reader(resp.Body)
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return true, err
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return retryStatus(resp.StatusCode), decodeError(resp, body)
+	}
+
+	if text, ok := res.(*string); ok {
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			return true, err
+		}
+		*text = strings.TrimSpace(string(data))
+		return false, nil
+	}
+
+	if err := json.NewDecoder(body).Decode(res); err != nil {
+		return true, err
+	}
+	return false, nil
+}
+
+// Server errors and rate limited requests are retried
+func retryStatus(status int) bool {
+	return status >= 500 || status == http.StatusTooManyRequests
+}
+
+// Decode the error response of the birdwatcher
+func decodeError(resp *http.Response, body io.Reader) error {
+	res := struct {
+		Error *bird.Error `json:"error"`
+	}{}
+	if err := json.NewDecoder(body).Decode(&res); err != nil || res.Error == nil {
+		return bird.NewRequestError(resp.StatusCode,
+			fmt.Sprintf("unexpected response: %s", resp.Status))
+	}
+	return res.Error
+}
+
+func cloneQuery(query url.Values) url.Values {
+	res := url.Values{}
+	for k, v := range query {
+		res[k] = append([]string{}, v...)
+	}
+	return res
+}
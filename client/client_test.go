@@ -0,0 +1,280 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alice-lg/birdwatcher/bird"
+	"github.com/alice-lg/birdwatcher/endpoints"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Reply to a command like BIRD, with the sample
+// files in test/
+func fakeBirdReply(t *testing.T, cmd string) string {
+	sample := ""
+	switch {
+	case cmd == "show status":
+		sample = "status2.sample"
+	case cmd == "show protocols all":
+		sample = "protocols_bgp_pipe.sample"
+	case cmd == "show symbols":
+		return " master4\trouting table\n R1\tprotocol\n0000 \n"
+	case strings.Contains(cmd, "'R2'"):
+		return "8003 No protocols match\n"
+	case strings.HasPrefix(cmd, "show route") && strings.Contains(cmd, " count"):
+		return "0014 3 of 3 routes for 3 networks\n"
+	case strings.HasPrefix(cmd, "show route"):
+		sample = "routes_bird2_ipv4.sample"
+	default:
+		return "9001 syntax error, unexpected CF_SYM_UNDEFINED\n"
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join("..", "test", sample))
+	if err != nil {
+		t.Error(err)
+		return "9001 Unexpected error\n"
+	}
+	reply := strings.Builder{}
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		reply.WriteString(" " + line + "\n")
+	}
+	reply.WriteString("0000 \n")
+	return reply.String()
+}
+
+// Start a fake BIRD daemon serving the samples
+func startFakeBird(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "bird.ctl")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				fmt.Fprint(conn, "0001 BIRD 2.0.7 ready.\n")
+				r := bufio.NewReader(conn)
+				for {
+					cmd, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					cmd = strings.TrimSpace(cmd)
+					if cmd == "restrict" {
+						fmt.Fprint(conn, "0016 Access restricted\n")
+						continue
+					}
+					fmt.Fprint(conn, fakeBirdReply(t, cmd))
+				}
+			}()
+		}
+	}()
+
+	return path
+}
+
+// Serve the endpoints of the birdwatcher, querying
+// a fake BIRD daemon
+func newTestHandler(t *testing.T) http.Handler {
+	bird.Default = bird.NewInstance("", bird.BirdConfig{Socket: startFakeBird(t)}, "4")
+	bird.InitializeCache()
+	endpoints.Conf = endpoints.ServerConfig{AllowUncached: true}
+	endpoints.VERSION = "2.0.0"
+	t.Cleanup(func() {
+		bird.Default = bird.NewInstance("", bird.BirdConfig{}, "4")
+		bird.InitializeCache()
+		endpoints.Conf = endpoints.ServerConfig{}
+	})
+
+	r := httprouter.New()
+	r.GET("/version", endpoints.Version("2.0.0"))
+	r.GET("/status", endpoints.Endpoint("status", endpoints.Status))
+	r.GET("/protocols", endpoints.Endpoint("protocols", endpoints.Protocols))
+	r.GET("/protocols/bgp", endpoints.Endpoint("protocols_bgp", endpoints.Bgp))
+	r.GET("/symbols/tables", endpoints.Endpoint("symbols_tables", endpoints.SymbolTables))
+	r.GET("/routes/protocol/:protocol", endpoints.StreamingEndpoint("routes_protocol",
+		endpoints.ProtoRoutes, endpoints.ProtoRoutesStream))
+	r.GET("/routes/table/:table", endpoints.StreamingEndpoint("routes_table",
+		endpoints.TableRoutes, endpoints.TableRoutesStream))
+	r.GET("/routes/count/table/:table", endpoints.Endpoint("routes_count_table", endpoints.TableCount))
+	r.GET("/routes/prefix", endpoints.Endpoint("routes_prefixed", endpoints.RoutesPrefixed))
+	r.GET("/routes/pipe/filtered", endpoints.Endpoint("routes_pipe_filtered", endpoints.PipeRoutesFiltered))
+	return r
+}
+
+func newTestClient(t *testing.T, handler http.Handler, config Config) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	config.URL = server.URL
+	c, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestClientEndpoints(t *testing.T) {
+	c := newTestClient(t, newTestHandler(t), Config{})
+	ctx := context.Background()
+
+	version, err := c.Version(ctx)
+	if err != nil || version != "2.0.0" {
+		t.Error("Unexpected version:", version, err)
+	}
+
+	status, err := c.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status.Version != "2.0.7" || status.API.Version != "2.0.0" {
+		t.Error("Unexpected status:", status.Status, status.API)
+	}
+
+	protocols, err := c.Protocols(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bgp, err := c.ProtocolsBgp(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bgp.Protocols) == 0 || len(bgp.Protocols) >= len(protocols.Protocols) {
+		t.Error("Unexpected bgp protocols:", len(bgp.Protocols))
+	}
+
+	routes, err := c.RoutesProtocol(ctx, "R1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes.Routes) == 0 || routes.Routes[0].BGP == nil {
+		t.Error("Unexpected routes:", routes.Routes)
+	}
+
+	count, err := c.RoutesCountTable(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count.Routes != 3 {
+		t.Error("Unexpected count:", count.Routes)
+	}
+
+	prefixed, err := c.RoutesPrefixed(ctx, "1.2.3.0/24", nil)
+	if err != nil || len(prefixed.Routes) == 0 {
+		t.Error("Unexpected prefixed routes:", prefixed, err)
+	}
+
+	piped, err := c.PipeRoutesFiltered(ctx, "P1", "master4", "", nil)
+	if err != nil || len(piped.Routes) == 0 {
+		t.Error("Unexpected pipe filtered routes:", piped, err)
+	}
+
+	tables, err := c.SymbolTables(ctx)
+	if err != nil || len(tables.Symbols) != 1 {
+		t.Error("Unexpected tables:", tables, err)
+	}
+}
+
+func TestClientError(t *testing.T) {
+	c := newTestClient(t, newTestHandler(t), Config{Retries: 2})
+
+	_, err := c.RoutesProtocol(context.Background(), "R2", nil)
+	birdErr, ok := err.(*bird.Error)
+	if !ok {
+		t.Fatal("Expected a bird error, got:", err)
+	}
+	if birdErr.Code != 8003 || birdErr.HTTPStatus() != http.StatusNotFound {
+		t.Error("Unexpected error:", birdErr)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	api := newTestHandler(t)
+	requests := int32(0)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		api.ServeHTTP(w, r)
+	})
+
+	c := newTestClient(t, handler, Config{Retries: 1, RetryDelay: time.Millisecond})
+	if _, err := c.Status(context.Background()); err == nil {
+		t.Error("Expected an error after exceeding the retries")
+	}
+
+	c = newTestClient(t, handler, Config{Retries: 1, RetryDelay: time.Millisecond})
+	if _, err := c.Status(context.Background()); err != nil {
+		t.Error("Expected success after retry, got:", err)
+	}
+	if requests != 3 {
+		t.Error("Unexpected number of requests:", requests)
+	}
+}
+
+func TestClientUncached(t *testing.T) {
+	c := newTestClient(t, newTestHandler(t), Config{Uncached: true})
+
+	query := url.Values{"page": []string{"1"}}
+	res, err := c.RoutesTable(context.Background(), "master4", query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.API.ResultFromCache {
+		t.Error("Expected an uncached result")
+	}
+	if len(query) != 1 {
+		t.Error("The query was modified:", query)
+	}
+}
+
+func TestClientTLS(t *testing.T) {
+	server := httptest.NewTLSServer(newTestHandler(t))
+	defer server.Close()
+
+	c, err := New(Config{URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Status(context.Background()); err == nil {
+		t.Error("Expected the unknown certificate to be rejected")
+	}
+
+	c, err = New(Config{
+		URL: server.URL,
+		TLS: &tls.Config{RootCAs: server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Status(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewInvalidURL(t *testing.T) {
+	if _, err := New(Config{URL: "rs1.example.net"}); err == nil {
+		t.Error("Expected an error for an url without scheme")
+	}
+}
@@ -21,8 +21,10 @@ type Config struct {
 	Status       bird.StatusConfig
 	Bird         bird.BirdConfig
 	Bird6        bird.BirdConfig
+	Instances    map[string]bird.InstanceConfig
 	Parser       bird.ParserConfig
 	Cache        bird.CacheConfig
+	Warmup       bird.WarmupConfig
 	Housekeeping HousekeepingConfig
 }
 
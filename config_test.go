@@ -1,6 +1,8 @@
 package main
 
 import (
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 )
 
@@ -15,3 +17,35 @@ func TestLoadConfigs(t *testing.T) {
 	t.Log(res)
 	t.Log(err)
 }
+
+func TestLoadConfigsInstances(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "birdwatcher.conf")
+	err := ioutil.WriteFile(filename, []byte(`
+[instances.vrf_blue]
+socket = "/run/bird/blue.ctl"
+ip_version = "6"
+ttl = 2
+cache_namespace = "rs1_blue"
+
+[instances.vrf_red]
+birdc = "ip netns exec red birdc"
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf, err := LoadConfigs([]string{filename})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blue := conf.Instances["vrf_blue"]
+	if blue.Socket != "/run/bird/blue.ctl" || blue.IPVersion != "6" || blue.CacheTtl != 2 {
+		t.Error("Unexpected instance config:", blue)
+	}
+	if blue.CacheNamespace != "rs1_blue" {
+		t.Error("Unexpected cache namespace:", blue.CacheNamespace)
+	}
+	if conf.Instances["vrf_red"].BirdCmd != "ip netns exec red birdc" {
+		t.Error("Unexpected instance config:", conf.Instances["vrf_red"])
+	}
+}
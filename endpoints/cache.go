@@ -0,0 +1,97 @@
+package endpoints
+
+// Administration of the cached results
+
+import (
+	"net/http"
+
+	"github.com/alice-lg/birdwatcher/bird"
+	"github.com/julienschmidt/httprouter"
+)
+
+// The maximum length of a cache key or prefix
+const cacheKeyLength = 1024
+
+// AdminEndpoint is an Endpoint restricted to the
+// clients allowed by CheckAdminAccess.
+func AdminEndpoint(module string, wrapped endpoint) httprouter.Handle {
+	handle := Endpoint(module, wrapped)
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if err := CheckAdminAccess(r); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		handle(w, r, ps)
+	}
+}
+
+// Cache lists the cached results of the instance. The
+// keys are the BIRD commands, e.g. "route all protocol 'R1'",
+// which can be selected by a prefix.
+func Cache(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
+	prefix := r.URL.Query().Get("key_prefix")
+	if len(prefix) > cacheKeyLength {
+		return bird.Parsed{"error": bird.NewRequestError(
+			http.StatusBadRequest, "key_prefix too long")}, false
+	}
+
+	instance := bird.InstanceFromContext(r.Context())
+	entries, err := instance.CacheEntries(prefix)
+	if err != nil {
+		return bird.Parsed{"error": bird.NewRequestError(
+			http.StatusServiceUnavailable, "cache unavailable: "+err.Error())}, false
+	}
+
+	res := bird.Parsed{
+		"backend": bird.CacheBackend(),
+		"entries": entries,
+	}
+	if stats, ok := bird.MemoryCacheStatistics(); ok {
+		res["stats"] = stats
+	}
+	return bird.Parsed{"cache": res}, false
+}
+
+// CachePurge removes a cached result by its key, the
+// results with keys starting with a prefix or, with
+// all=true, all results of the instance.
+func CachePurge(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
+	qs := r.URL.Query()
+	key, hasKey := qs["key"]
+	prefix, hasPrefix := qs["key_prefix"]
+	all := qs.Get("all") == "true"
+
+	selectors := 0
+	for _, selected := range []bool{hasKey, hasPrefix, all} {
+		if selected {
+			selectors++
+		}
+	}
+	if selectors != 1 {
+		return bird.Parsed{"error": bird.NewRequestError(http.StatusBadRequest,
+			"exactly one of key, key_prefix or all=true is required")}, false
+	}
+	if hasPrefix && prefix[0] == "" {
+		return bird.Parsed{"error": bird.NewRequestError(http.StatusBadRequest,
+			"empty key_prefix, use all=true to purge all results")}, false
+	}
+	if (hasKey && len(key[0]) > cacheKeyLength) ||
+		(hasPrefix && len(prefix[0]) > cacheKeyLength) {
+		return bird.Parsed{"error": bird.NewRequestError(
+			http.StatusBadRequest, "key too long")}, false
+	}
+
+	instance := bird.InstanceFromContext(r.Context())
+	purged := 0
+	switch {
+	case hasKey:
+		if instance.DeleteCache(key[0]) {
+			purged = 1
+		}
+	case hasPrefix:
+		purged = instance.PurgeCache(prefix[0])
+	default:
+		purged = instance.PurgeCache("")
+	}
+	return bird.Parsed{"purged": purged}, false
+}
@@ -0,0 +1,72 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alice-lg/birdwatcher/bird"
+)
+
+func TestAdminEndpointAccess(t *testing.T) {
+	bird.InitializeCache()
+	defer func() { Conf = ServerConfig{} }()
+
+	handle := AdminEndpoint("cache", Cache)
+	for _, tc := range []struct {
+		admin  []string
+		remote string
+		status int
+	}{
+		{nil, "127.0.0.1:4242", http.StatusOK},
+		{nil, "[::1]:4242", http.StatusOK},
+		{nil, "192.0.2.1:4242", http.StatusForbidden},
+		{[]string{"192.0.2.0/24"}, "192.0.2.1:4242", http.StatusOK},
+		{[]string{"192.0.2.0/24"}, "127.0.0.1:4242", http.StatusForbidden},
+	} {
+		Conf = ServerConfig{AdminAllowFrom: tc.admin}
+		req := httptest.NewRequest("GET", "/cache", nil)
+		req.RemoteAddr = tc.remote
+		rec := httptest.NewRecorder()
+		handle(rec, req, nil)
+		if rec.Code != tc.status {
+			t.Error("Unexpected status for", tc.remote, tc.admin, rec.Code)
+		}
+	}
+}
+
+func TestCachePurgeSelector(t *testing.T) {
+	bird.InitializeCache()
+
+	for _, tc := range []struct {
+		query  string
+		status int
+	}{
+		{"", http.StatusBadRequest},
+		{"?key=status&all=true", http.StatusBadRequest},
+		{"?key_prefix=", http.StatusBadRequest},
+		{"?key=status", http.StatusOK},
+		{"?key_prefix=route+all", http.StatusOK},
+		{"?all=true", http.StatusOK},
+	} {
+		req := httptest.NewRequest("DELETE", "/cache"+tc.query, nil)
+		req.RemoteAddr = "127.0.0.1:4242"
+		rec := httptest.NewRecorder()
+		AdminEndpoint("cache", CachePurge)(rec, req, nil)
+		if rec.Code != tc.status {
+			t.Error("Unexpected status for", tc.query, rec.Code, rec.Body.String())
+			continue
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+		res := map[string]interface{}{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		if res["purged"] != 0.0 {
+			t.Error("Unexpected result:", res)
+		}
+	}
+}
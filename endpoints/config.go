@@ -2,10 +2,18 @@ package endpoints
 
 // Endpoints / Server configuration
 type ServerConfig struct {
-	AllowFrom      []string `toml:"allow_from"`
+	AllowFrom []string `toml:"allow_from"`
+	// Clients allowed to use the admin modules, like cache.
+	// Defaults to localhost.
+	AdminAllowFrom []string `toml:"admin_allow_from"`
 	ModulesEnabled []string `toml:"modules_enabled"`
 	AllowUncached  bool     `toml:"allow_uncached"`
 
+	// Timeouts (in seconds) for requests, the default
+	// and per module.
+	Timeout  int            `toml:"timeout"`
+	Timeouts map[string]int `toml:"timeouts"`
+
 	EnableTLS bool   `toml:"enable_tls"`
 	Crt       string `toml:"crt"`
 	Key       string `toml:"key"`
@@ -1,10 +1,13 @@
 package endpoints
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
 	"reflect"
 	"strings"
+	"time"
 
 	"compress/gzip"
 	"encoding/json"
@@ -23,7 +26,20 @@ func CheckAccess(req *http.Request) error {
 	if len(Conf.AllowFrom) == 0 {
 		return nil // AllowFrom ALL
 	}
+	return checkAllowFrom(req, Conf.AllowFrom)
+}
+
+// CheckAdminAccess restricts the admin modules to
+// the AdminAllowFrom clients, or else to localhost.
+func CheckAdminAccess(req *http.Request) error {
+	allowFrom := Conf.AdminAllowFrom
+	if len(allowFrom) == 0 {
+		allowFrom = []string{"127.0.0.1", "::1"}
+	}
+	return checkAllowFrom(req, allowFrom)
+}
 
+func checkAllowFrom(req *http.Request, allowFrom []string) error {
 	ipStr, _, err := net.SplitHostPort(req.RemoteAddr)
 	if err != nil {
 		log.Println("Error parsing IP address:", err)
@@ -34,7 +50,7 @@ func CheckAccess(req *http.Request) error {
 		log.Println("Invalid IP address format:", ipStr)
 		return fmt.Errorf("invalid source IP address format")
 	}
-	for _, allowed := range Conf.AllowFrom {
+	for _, allowed := range allowFrom {
 		if _, allowedNet, err := net.ParseCIDR(allowed); err == nil {
 			if allowedNet.Contains(clientIP) {
 				return nil
@@ -44,11 +60,11 @@ func CheckAccess(req *http.Request) error {
 				return nil
 			}
 		} else {
-			log.Printf("Invalid IP/CIDR format in configuration: %s\n", allowed);
+			log.Printf("Invalid IP/CIDR format in configuration: %s\n", allowed)
 		}
 	}
-	log.Println("Rejecting access from:", ipStr);
-	return fmt.Errorf("%s is not allowed to access this service", ipStr);
+	log.Println("Rejecting access from:", ipStr)
+	return fmt.Errorf("%s is not allowed to access this service", ipStr)
 }
 
 func CheckUseCache(req *http.Request) bool {
@@ -62,54 +78,142 @@ func CheckUseCache(req *http.Request) bool {
 	return true
 }
 
-func Endpoint(wrapped endpoint) httprouter.Handle {
+// Get the timeout for requests to a module. A timeout
+// of 0 disables the deadline.
+func moduleTimeout(module string) time.Duration {
+	timeout, ok := Conf.Timeouts[module]
+	if !ok {
+		timeout = Conf.Timeout
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+// Check access and apply the timeout of the module
+// to the request. The returned request must be used
+// for further processing.
+func beginRequest(
+	module string,
+	w http.ResponseWriter,
+	r *http.Request,
+) (*http.Request, context.CancelFunc, bool) {
+	// Access Control
+	if err := CheckAccess(r); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return r, func() {}, false
+	}
+
+	// The TTL of the module applies to cached results
+	r = r.WithContext(bird.WithModule(r.Context(), module))
+
+	// The request is cancelled when the client goes
+	// away or the timeout is exceeded.
+	timeout := moduleTimeout(module)
+	if timeout <= 0 {
+		return r, func() {}, true
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	return r.WithContext(ctx), cancel, true
+}
+
+func Endpoint(module string, wrapped endpoint) httprouter.Handle {
 	return func(w http.ResponseWriter,
 		r *http.Request,
 		ps httprouter.Params) {
 
-		// Access Control
-		if err := CheckAccess(r); err != nil {
-			http.Error(w, err.Error(), http.StatusForbidden)
+		r, cancel, ok := beginRequest(module, w, r)
+		if !ok {
 			return
 		}
+		defer cancel()
 
-		res := make(map[string]interface{})
+		// Sorted routes are cached by command
+		if CheckSort(r) {
+			r = r.WithContext(bird.WithCommandRecorder(r.Context()))
+		}
 
 		useCache := CheckUseCache(r)
 		ret, from_cache := wrapped(r, ps, useCache)
 
-		if reflect.DeepEqual(ret, bird.NilParse) {
-			w.WriteHeader(http.StatusTooManyRequests)
-			return
-		}
-		if reflect.DeepEqual(ret, bird.BirdError) {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Header().Set("Content-Type", "application/json")
-			js, _ := json.Marshal(ret)
-			w.Write(js)
-			return
-		}
-		res["api"] = GetApiInfo(&ret, from_cache)
+		writeResult(w, r, ret, from_cache)
+	}
+}
 
-		for k, v := range ret {
-			res[k] = v
-		}
+// Write the result or the error of a query
+func writeResult(
+	w http.ResponseWriter,
+	r *http.Request,
+	ret bird.Parsed,
+	from_cache bool,
+) {
+	if reflect.DeepEqual(ret, bird.NilParse) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+	if err, ok := bird.ParsedError(ret); ok {
+		writeError(w, err)
+		return
+	}
 
-		w.Header().Set("Content-Type", "application/json")
+	ret, pagination, err := applyRouteQuery(r, ret)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	ret, err = applyFields(r, ret)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 
-		// Check if compression is supported
-		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
-			// Compress response
-			w.Header().Set("Content-Encoding", "gzip")
-			gz := gzip.NewWriter(w)
-			defer gz.Close()
-			json := json.NewEncoder(gz)
-			json.Encode(res)
-		} else {
-			json := json.NewEncoder(w)
-			json.Encode(res) // Fall back to uncompressed response
+	api := GetApiInfo(&ret, from_cache)
+	api.Pagination = pagination
+
+	res := make(map[string]interface{})
+	res["api"] = api
+
+	for k, v := range ret {
+		if k == bird.StaleKey {
+			continue // Reported in the api envelope
 		}
+		res[k] = v
 	}
+
+	routes, isRouteList := ret["routes"]
+	if isRouteList && CheckNDJSON(r) {
+		w.Header().Set("Content-Type", NDJSONContentType)
+		out, done := responseWriter(w, r)
+		defer done()
+
+		writeNDJSON(out, res, routes)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	out, done := responseWriter(w, r)
+	defer done()
+
+	json := json.NewEncoder(out)
+	json.Encode(res)
+}
+
+func writeError(w http.ResponseWriter, err *bird.Error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(err.HTTPStatus())
+	js, _ := json.Marshal(bird.Parsed{"error": err})
+	w.Write(js)
+}
+
+// Compress the response if supported by the client.
+// The returned function must be called when done.
+func responseWriter(w http.ResponseWriter, r *http.Request) (io.Writer, func()) {
+	if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		return w, func() {} // Fall back to uncompressed response
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	gz := gzip.NewWriter(w)
+	return gz, func() { gz.Close() }
 }
 
 func Version(version string) httprouter.Handle {
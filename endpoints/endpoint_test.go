@@ -0,0 +1,46 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alice-lg/birdwatcher/bird"
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestEndpointModuleContext(t *testing.T) {
+	module := ""
+	wrapped := func(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
+		module = bird.ModuleFromContext(r.Context())
+		return bird.Parsed{}, false
+	}
+
+	handle := Endpoint("status", wrapped)
+	handle(httptest.NewRecorder(), httptest.NewRequest("GET", "/status", nil), nil)
+	if module != "status" {
+		t.Error("Expected the module in the context, got:", module)
+	}
+}
+
+func TestWriteResultStale(t *testing.T) {
+	ret := bird.Parsed{
+		"status":      bird.Parsed{"version": "2.0.7"},
+		bird.StaleKey: true,
+	}
+	rec := httptest.NewRecorder()
+	writeResult(rec, httptest.NewRequest("GET", "/status", nil), ret, true)
+
+	res := map[string]interface{}{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := res[bird.StaleKey]; ok {
+		t.Error("Unexpected stale marker in the result")
+	}
+	api := res["api"].(map[string]interface{})
+	if api["cache_status"].(map[string]interface{})["stale"] != true {
+		t.Error("Expected stale result:", api)
+	}
+}
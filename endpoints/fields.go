@@ -0,0 +1,125 @@
+package endpoints
+
+// Projection of response objects to requested fields
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/alice-lg/birdwatcher/bird"
+)
+
+// A fieldSet holds the requested keys of an object. The
+// nested set of a key selects from the value; if it is
+// nil, the value is included as a whole.
+type fieldSet map[string]fieldSet
+
+// CheckFields checks if the client requested
+// a projection of the objects in the response.
+func CheckFields(req *http.Request) bool {
+	return req.URL.Query().Get("fields") != ""
+}
+
+// Parse a list of fields like `network,bgp.as_path`
+func parseFields(value string) (fieldSet, error) {
+	fields := fieldSet{}
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if _, err := ValidateLengthAndCharset(field, 80,
+			"abcdefghijklmnopqrstuvwxyz_.0123456789"); err != nil {
+			return nil, fmt.Errorf("invalid field: %s", field)
+		}
+
+		keys := strings.Split(field, ".")
+		set := fields
+		for i, key := range keys {
+			if key == "" {
+				return nil, fmt.Errorf("invalid field: %s", field)
+			}
+			nested, ok := set[key]
+			if ok && nested == nil {
+				break // The value is already selected as a whole
+			}
+			if i == len(keys)-1 {
+				set[key] = nil
+				break
+			}
+			if !ok {
+				nested = fieldSet{}
+				set[key] = nested
+			}
+			set = nested
+		}
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no fields selected")
+	}
+
+	return fields, nil
+}
+
+// Project an object to the fields. Missing keys are
+// omitted. A new object is returned.
+func (fields fieldSet) project(obj bird.Parsed) bird.Parsed {
+	res := make(bird.Parsed, len(fields))
+	for key, nested := range fields {
+		value, ok := obj[key]
+		if !ok {
+			continue
+		}
+		if nested == nil {
+			res[key] = value
+			continue
+		}
+		if inner, ok := bird.AsParsed(value); ok {
+			res[key] = nested.project(inner)
+		}
+	}
+	return res
+}
+
+// Apply the fields to the routes, protocols or status
+// of the result. The result is not modified.
+func applyFields(r *http.Request, ret bird.Parsed) (bird.Parsed, *bird.Error) {
+	if !CheckFields(r) {
+		return ret, nil
+	}
+	fields, err := parseFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		return nil, bird.NewRequestError(http.StatusBadRequest, err.Error())
+	}
+
+	res := make(bird.Parsed, len(ret))
+	for k, v := range ret {
+		res[k] = v
+	}
+
+	if routes, ok := resultRoutes(ret); ok {
+		projected := make([]bird.Parsed, 0, len(routes))
+		for _, route := range routes {
+			projected = append(projected, fields.project(route))
+		}
+		res["routes"] = projected
+	}
+
+	// Protocols are keyed by name
+	if protocols, ok := bird.AsParsed(ret["protocols"]); ok {
+		projected := make(bird.Parsed, len(protocols))
+		for name, p := range protocols {
+			if protocol, ok := bird.AsParsed(p); ok {
+				projected[name] = fields.project(protocol)
+			}
+		}
+		res["protocols"] = projected
+	}
+
+	if status, ok := bird.AsParsed(ret["status"]); ok {
+		res["status"] = fields.project(status)
+	}
+
+	return res, nil
+}
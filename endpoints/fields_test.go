@@ -0,0 +1,104 @@
+package endpoints
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/alice-lg/birdwatcher/bird"
+)
+
+func TestParseFields(t *testing.T) {
+	fields, err := parseFields("network, bgp.as_path,bgp.communities")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := fieldSet{
+		"network": nil,
+		"bgp": fieldSet{
+			"as_path":     nil,
+			"communities": nil,
+		},
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Error("Unexpected fields:", fields)
+	}
+
+	// Selecting the whole value takes precedence
+	fields, _ = parseFields("bgp.as_path,bgp")
+	if !reflect.DeepEqual(fields, fieldSet{"bgp": nil}) {
+		t.Error("Unexpected fields:", fields)
+	}
+	fields, _ = parseFields("bgp,bgp.as_path")
+	if !reflect.DeepEqual(fields, fieldSet{"bgp": nil}) {
+		t.Error("Unexpected fields:", fields)
+	}
+
+	for _, invalid := range []string{",", "bgp..as_path", "net-work"} {
+		if _, err := parseFields(invalid); err == nil {
+			t.Error("Expected error for:", invalid)
+		}
+	}
+}
+
+func TestApplyFields(t *testing.T) {
+	route := bird.Parsed{
+		"network": "10.0.0.0/8",
+		"gateway": "172.25.3.10",
+		"bgp": bird.Parsed{
+			"as_path":    []string{"4242"},
+			"local_pref": "100",
+		},
+	}
+	ret := bird.Parsed{
+		"routes": []bird.Parsed{route},
+		"ttl":    "2021-03-30T02:28:25Z",
+	}
+
+	req := httptest.NewRequest("GET", "/routes/table/master?fields=network,bgp.as_path,metric", nil)
+	res, err := applyFields(req, ret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := bird.Parsed{
+		"network": "10.0.0.0/8",
+		"bgp": bird.Parsed{
+			"as_path": []string{"4242"},
+		},
+	}
+	if !reflect.DeepEqual(res["routes"].([]bird.Parsed)[0], expected) {
+		t.Error("Unexpected route:", res["routes"])
+	}
+	if res["ttl"] != ret["ttl"] {
+		t.Error("Expected other keys to be preserved")
+	}
+
+	// The result is not modified
+	if len(route) != 3 || len(route["bgp"].(bird.Parsed)) != 2 {
+		t.Error("Result was modified:", route)
+	}
+}
+
+func TestApplyFieldsProtocolsAndStatus(t *testing.T) {
+	ret := bird.Parsed{
+		"protocols": bird.Parsed{
+			"R1": bird.Parsed{"state": "up", "neighbor_as": 4242},
+		},
+		"status": bird.Parsed{"router_id": "172.25.3.2", "version": "2.0.7"},
+	}
+
+	req := httptest.NewRequest("GET", "/protocols?fields=state,router_id", nil)
+	res, err := applyFields(req, ret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	protocol := res["protocols"].(bird.Parsed)["R1"]
+	if !reflect.DeepEqual(protocol, bird.Parsed{"state": "up"}) {
+		t.Error("Unexpected protocol:", protocol)
+	}
+	if !reflect.DeepEqual(res["status"], bird.Parsed{"router_id": "172.25.3.2"}) {
+		t.Error("Unexpected status:", res["status"])
+	}
+}
@@ -46,14 +46,24 @@ func ValidateLengthAndCharset(value string, maxLength int, alphabet string) (str
 	return value, nil
 }
 
+// Allowed characters and lengths of params
+const (
+	protocolParamCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ_:.abcdefghijklmnopqrstuvwxyz1234567890"
+	protocolParamLength  = 80
+	prefixParamCharset   = "1234567890abcdef.:/"
+	prefixParamLength    = 80
+	netMaskParamCharset  = "1234567890"
+	netMaskParamLength   = 3
+)
+
 func ValidateProtocolParam(value string) (string, error) {
-	return ValidateLengthAndCharset(value, 80, "ABCDEFGHIJKLMNOPQRSTUVWXYZ_:.abcdefghijklmnopqrstuvwxyz1234567890")
+	return ValidateLengthAndCharset(value, protocolParamLength, protocolParamCharset)
 }
 
 func ValidatePrefixParam(value string) (string, error) {
-	return ValidateLengthAndCharset(value, 80, "1234567890abcdef.:/")
+	return ValidateLengthAndCharset(value, prefixParamLength, prefixParamCharset)
 }
 
 func ValidateNetMaskParam(value string) (string, error) {
-	return ValidateLengthAndCharset(value, 3, "1234567890")
+	return ValidateLengthAndCharset(value, netMaskParamLength, netMaskParamCharset)
 }
@@ -0,0 +1,72 @@
+package endpoints
+
+// Health and readiness checks for load balancers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/alice-lg/birdwatcher/bird"
+	"github.com/julienschmidt/httprouter"
+)
+
+// HealthPaths are not written to the access log
+var HealthPaths = []string{"/healthz", "/readyz"}
+
+// HealthResponse is the result of a health or
+// readiness check
+type HealthResponse struct {
+	Status string                      `json:"status"`
+	Checks map[string]bird.HealthCheck `json:"checks,omitempty"`
+}
+
+func writeHealth(w http.ResponseWriter, status int, res HealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
+
+// Healthz reports that the process is alive
+func Healthz(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	writeHealth(w, http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+// Readyz reports if BIRD is reachable, its version is
+// known and the cache is connected. The response is
+// 503 if a check fails.
+func Readyz(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	readyz(w, r, bird.Readiness)
+}
+
+// ReadyzInstances reports if all instances are ready,
+// e.g. the instances sharing a listen address. The
+// checks are named by instance, like v4.bird.
+func ReadyzInstances(instances []*bird.Instance) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		readyz(w, r, func(ctx context.Context) (map[string]bird.HealthCheck, bool) {
+			return bird.InstancesReadiness(ctx, instances)
+		})
+	}
+}
+
+func readyz(
+	w http.ResponseWriter,
+	r *http.Request,
+	readiness func(context.Context) (map[string]bird.HealthCheck, bool),
+) {
+	r, cancel, ok := beginRequest("readyz", w, r)
+	if !ok {
+		return
+	}
+	defer cancel()
+
+	checks, ready := readiness(r.Context())
+	if !ready {
+		writeHealth(w, http.StatusServiceUnavailable,
+			HealthResponse{Status: "unavailable", Checks: checks})
+		return
+	}
+	writeHealth(w, http.StatusOK, HealthResponse{Status: "ok", Checks: checks})
+}
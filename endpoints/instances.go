@@ -0,0 +1,21 @@
+package endpoints
+
+import (
+	"net/http"
+
+	"github.com/alice-lg/birdwatcher/bird"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Instances lists the named BIRD instances. The
+// API of an instance is served at /instances/:name.
+func Instances(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
+	instances := bird.Parsed{}
+	for _, instance := range bird.Instances() {
+		instances[instance.Name] = bird.Parsed{
+			"ip_version":   instance.IPVersion,
+			"bird_version": instance.BirdVersion(), // 0 if not yet known
+		}
+	}
+	return bird.Parsed{"instances": instances}, false
+}
@@ -0,0 +1,183 @@
+package endpoints
+
+// Prometheus metrics of the protocols and of birdwatcher
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alice-lg/birdwatcher/bird"
+	"github.com/julienschmidt/httprouter"
+)
+
+// MetricsContentType is the Prometheus text format
+const MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// The formats of timestamps like state_changed or the
+// age of routes, depending on the timeformat configured
+// in BIRD
+var birdTimeFormats = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// Get the time since a timestamp, e.g. since the state
+// of the protocol changed. Times without a date are
+// ignored.
+func birdTimeSince(timestamp string, now time.Time) (time.Duration, bool) {
+	for _, format := range birdTimeFormats {
+		since, err := time.ParseInLocation(format, timestamp, time.Local)
+		if err == nil {
+			return now.Sub(since), true
+		}
+	}
+	return 0, false
+}
+
+// Write the metrics of the protocols
+func writeProtocolMetrics(w io.Writer, protocols map[string]*bird.Protocol, now time.Time) {
+	names := make([]string, 0, len(protocols))
+	for name := range protocols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bird.WriteMetricHeader(w, "birdwatcher_protocol_up", "gauge",
+		"Protocol is up")
+	for _, name := range names {
+		p := protocols[name]
+		up := 0.0
+		if p.State == "up" {
+			up = 1
+		}
+		bird.WriteMetricSample(w, "birdwatcher_protocol_up", up,
+			"name", name, "proto", p.BirdProtocol, "table", p.Table)
+	}
+
+	bird.WriteMetricHeader(w, "birdwatcher_protocol_uptime_seconds", "gauge",
+		"Time since the protocol is up")
+	for _, name := range names {
+		p := protocols[name]
+		if p.State != "up" {
+			continue
+		}
+		uptime, ok := birdTimeSince(p.StateChanged, now)
+		if !ok {
+			continue
+		}
+		bird.WriteMetricSample(w, "birdwatcher_protocol_uptime_seconds",
+			uptime.Seconds(),
+			"name", name, "proto", p.BirdProtocol, "table", p.Table)
+	}
+
+	bird.WriteMetricHeader(w, "birdwatcher_protocol_routes", "gauge",
+		"Number of routes of the protocol")
+	for _, name := range names {
+		p := protocols[name]
+		if p.Routes == nil {
+			continue
+		}
+		counts := []struct {
+			typ   string
+			count *int64
+		}{
+			{"imported", p.Routes.Imported},
+			{"filtered", p.Routes.Filtered},
+			{"exported", p.Routes.Exported},
+			{"preferred", p.Routes.Preferred},
+		}
+		for _, c := range counts {
+			if c.count == nil {
+				continue
+			}
+			bird.WriteMetricSample(w, "birdwatcher_protocol_routes",
+				float64(*c.count),
+				"name", name, "proto", p.BirdProtocol, "table", p.Table,
+				"type", c.typ)
+		}
+	}
+
+	bird.WriteMetricHeader(w, "birdwatcher_protocol_route_changes_total", "counter",
+		"Route change statistics of the protocol")
+	for _, name := range names {
+		p := protocols[name]
+		keys := make([]string, 0, len(p.RouteChanges))
+		for key := range p.RouteChanges {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			// Keys are like import_updates
+			parts := strings.SplitN(key, "_", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			changes := p.RouteChanges[key]
+			counts := []struct {
+				result string
+				count  *int64
+			}{
+				{"received", changes.Received},
+				{"rejected", changes.Rejected},
+				{"filtered", changes.Filtered},
+				{"ignored", changes.Ignored},
+				{"accepted", changes.Accepted},
+			}
+			for _, c := range counts {
+				if c.count == nil {
+					continue
+				}
+				bird.WriteMetricSample(w, "birdwatcher_protocol_route_changes_total",
+					float64(*c.count),
+					"name", name, "proto", p.BirdProtocol,
+					"direction", parts[0], "kind", parts[1],
+					"result", c.result)
+			}
+		}
+	}
+}
+
+// Metrics serves the state of the protocols and the
+// metrics of birdwatcher in the Prometheus text format.
+// Scrapes do not count against the rate limit of the
+// API clients.
+func Metrics(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	r, cancel, ok := beginRequest("metrics", w, r)
+	if !ok {
+		return
+	}
+	defer cancel()
+
+	buf := &bytes.Buffer{}
+
+	ctx := bird.WithoutRateLimit(r.Context())
+	ret, _ := bird.Protocols(ctx, CheckUseCache(r))
+	protocols, err := bird.DecodeProtocols(ret)
+	if err != nil || bird.IsSpecial(ret) {
+		protocols = nil
+	}
+
+	up := 0.0
+	if protocols != nil {
+		up = 1
+	}
+	bird.WriteMetricHeader(buf, "birdwatcher_bird_up", "gauge",
+		"The protocols could be queried from BIRD")
+	bird.WriteMetricSample(buf, "birdwatcher_bird_up", up)
+
+	if protocols != nil {
+		writeProtocolMetrics(buf, protocols, time.Now())
+	}
+	bird.WriteMetrics(r.Context(), buf)
+
+	w.Header().Set("Content-Type", MetricsContentType)
+	out, done := responseWriter(w, r)
+	defer done()
+	out.Write(buf.Bytes())
+}
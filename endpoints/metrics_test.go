@@ -0,0 +1,85 @@
+package endpoints
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alice-lg/birdwatcher/bird"
+)
+
+func TestBirdTimeSince(t *testing.T) {
+	now := time.Date(2018, 5, 31, 16, 38, 58, 0, time.Local)
+	uptime, ok := birdTimeSince("2018-05-31 15:38:58", now)
+	if !ok || uptime != time.Hour {
+		t.Error("Unexpected uptime:", uptime, ok)
+	}
+	if _, ok := birdTimeSince("15:38:58", now); ok {
+		t.Error("Expected time without date to be ignored")
+	}
+}
+
+func TestWriteProtocolMetrics(t *testing.T) {
+	f, err := os.Open("../test/protocols_bgp_pipe.sample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	protocols, err := bird.ParseProtocols(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	now := time.Date(2018, 5, 31, 16, 38, 40, 0, time.Local)
+	writeProtocolMetrics(buf, protocols, now)
+	out := buf.String()
+
+	for _, line := range []string{
+		`birdwatcher_protocol_up{name="R194_42",proto="BGP",table="T65001_nada_co_ripe"} 1`,
+		`birdwatcher_protocol_up{name="C65003_nada2_co_ripe",proto="Pipe",table="Collector"} 0`,
+		`birdwatcher_protocol_uptime_seconds{name="R194_42",proto="BGP",table="T65001_nada_co_ripe"} 3600`,
+		`birdwatcher_protocol_route_changes_total{name="M65001_nada_co_ripe",proto="Pipe",direction="import",kind="updates",result="rejected"} 250085`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Error("Expected line:", line)
+		}
+	}
+
+	// Counters reported as --- are omitted
+	unexpected := `name="M65001_nada_co_ripe",proto="Pipe",direction="import",kind="withdraws",result="filtered"`
+	if strings.Contains(out, unexpected) {
+		t.Error("Unexpected sample:", unexpected)
+	}
+}
+
+func TestWriteProtocolRouteMetrics(t *testing.T) {
+	imported, preferred := int64(710), int64(376688)
+	protocols := map[string]*bird.Protocol{
+		"R1": {
+			BirdProtocol: "BGP",
+			Table:        "master4",
+			State:        "up",
+			Routes:       &bird.RouteCount{Imported: &imported, Preferred: &preferred},
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	writeProtocolMetrics(buf, protocols, time.Now())
+	out := buf.String()
+
+	for _, line := range []string{
+		`birdwatcher_protocol_routes{name="R1",proto="BGP",table="master4",type="imported"} 710`,
+		`birdwatcher_protocol_routes{name="R1",proto="BGP",table="master4",type="preferred"} 376688`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Error("Expected line:", line)
+		}
+	}
+	if strings.Contains(out, `type="exported"`) {
+		t.Error("Unexpected exported routes:", out)
+	}
+}
@@ -0,0 +1,63 @@
+package endpoints
+
+// Newline delimited JSON output of route listings
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/alice-lg/birdwatcher/bird"
+)
+
+const NDJSONContentType = "application/x-ndjson"
+
+// CheckNDJSON checks if the client requested the
+// response as newline delimited JSON, either with
+// `format=ndjson` or by the Accept header.
+func CheckNDJSON(req *http.Request) bool {
+	qs := req.URL.Query()
+	if len(qs["format"]) == 1 {
+		return qs["format"][0] == "ndjson"
+	}
+	return strings.Contains(req.Header.Get("Accept"), NDJSONContentType)
+}
+
+// Write the response with a header line, holding the
+// api info and all other keys, followed by one line
+// for every route.
+func writeNDJSON(out io.Writer, res map[string]interface{}, routes interface{}) error {
+	header := make(map[string]interface{}, len(res))
+	for k, v := range res {
+		if k != "routes" {
+			header[k] = v
+		}
+	}
+
+	enc := json.NewEncoder(out)
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+
+	return encodeList(enc, routes)
+}
+
+// Encode every element of a list as a line
+func encodeList(enc *json.Encoder, list interface{}) error {
+	switch l := list.(type) {
+	case []bird.Parsed:
+		for _, v := range l {
+			if err := enc.Encode(v); err != nil {
+				return err
+			}
+		}
+	case []interface{}: // Results from the redis cache
+		for _, v := range l {
+			if err := enc.Encode(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
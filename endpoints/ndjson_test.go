@@ -0,0 +1,105 @@
+package endpoints
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alice-lg/birdwatcher/bird"
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestCheckNDJSON(t *testing.T) {
+	req := httptest.NewRequest("GET", "/routes/protocol/R1?format=ndjson", nil)
+	if !CheckNDJSON(req) {
+		t.Error("Expected format=ndjson to be accepted")
+	}
+
+	req = httptest.NewRequest("GET", "/routes/protocol/R1", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	if !CheckNDJSON(req) {
+		t.Error("Expected the Accept header to be respected")
+	}
+
+	req = httptest.NewRequest("GET", "/routes/protocol/R1?format=json", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	if CheckNDJSON(req) {
+		t.Error("Expected the format parameter to take precedence")
+	}
+}
+
+// Read the lines of a ndjson response
+func readNDJSON(t *testing.T, body string) []map[string]interface{} {
+	lines := []map[string]interface{}{}
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := map[string]interface{}{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatal(err, scanner.Text())
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestEndpointNDJSON(t *testing.T) {
+	routes := func(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
+		return bird.Parsed{
+			"ttl": "2021-03-30T02:28:25Z",
+			"routes": []bird.Parsed{
+				{"network": "1.2.3.0/24"},
+				{"network": "1.2.4.0/24"},
+			},
+		}, true
+	}
+
+	req := httptest.NewRequest("GET", "/routes/protocol/R1?format=ndjson", nil)
+	rec := httptest.NewRecorder()
+	Endpoint("routes_protocol", routes)(rec, req, httprouter.Params{})
+
+	if ct := rec.Header().Get("Content-Type"); ct != NDJSONContentType {
+		t.Error("Unexpected content type:", ct)
+	}
+	lines := readNDJSON(t, rec.Body.String())
+	if len(lines) != 3 {
+		t.Fatal("Expected header and 2 routes, got:", lines)
+	}
+	if _, ok := lines[0]["api"]; !ok {
+		t.Error("Expected api info in header line:", lines[0])
+	}
+	if _, ok := lines[0]["routes"]; ok {
+		t.Error("Unexpected routes in header line:", lines[0])
+	}
+	if lines[2]["network"] != "1.2.4.0/24" {
+		t.Error("Unexpected route:", lines[2])
+	}
+}
+
+func TestStreamingEndpointNDJSON(t *testing.T) {
+	streaming := func(
+		r *http.Request,
+		ps httprouter.Params,
+		useCache bool,
+		emit func(bird.Parsed) error,
+	) (bird.Parsed, bool) {
+		emit(bird.Parsed{"network": "1.2.3.0/24"})
+		emit(bird.Parsed{"network": "1.2.4.0/24"})
+		return nil, false
+	}
+
+	req := httptest.NewRequest("GET", "/routes/table/master4?stream=true", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	rec := httptest.NewRecorder()
+	StreamingEndpoint("routes_table", nil, streaming)(rec, req, httprouter.Params{})
+
+	lines := readNDJSON(t, rec.Body.String())
+	if len(lines) != 3 {
+		t.Fatal("Expected header and 2 routes, got:", lines)
+	}
+	if lines[1]["network"] != "1.2.3.0/24" {
+		t.Error("Unexpected route:", lines[1])
+	}
+}
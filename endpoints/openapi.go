@@ -0,0 +1,507 @@
+package endpoints
+
+// OpenAPI description of the enabled endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Route is an endpoint of the API. It is served and
+// documented if its module is enabled.
+type Route struct {
+	Module   string
+	Method   string // Defaults to GET
+	Path     string // e.g. /routes/protocol/:protocol
+	Handle   httprouter.Handle
+	Summary  string
+	Response string // The name of the response schema
+	Query    []QueryParam
+	Stream   bool // The route supports stream=true
+}
+
+// HTTPMethod is the method of the route
+func (route Route) HTTPMethod() string {
+	if route.Method == "" {
+		return http.MethodGet
+	}
+	return route.Method
+}
+
+// QueryParam is a query parameter of a route
+type QueryParam struct {
+	Name     string
+	Required bool
+}
+
+type object map[string]interface{}
+
+// Make the schema of a param validated by its
+// charset and length
+func paramSchema(charset string, length int) object {
+	return object{
+		"type":      "string",
+		"maxLength": length,
+		"pattern":   "^[" + regexp.QuoteMeta(charset) + "]+$",
+	}
+}
+
+// The schemas of path and query params by name
+var paramSchemas = map[string]object{
+	"protocol": paramSchema(protocolParamCharset, protocolParamLength),
+	"table":    paramSchema(protocolParamCharset, protocolParamLength),
+	"pipe":     paramSchema(protocolParamCharset, protocolParamLength),
+	"peer":     paramSchema(prefixParamCharset, prefixParamLength),
+	"net":      paramSchema(prefixParamCharset, prefixParamLength),
+	"prefix":   paramSchema(prefixParamCharset, prefixParamLength),
+	"address":  paramSchema(prefixParamCharset, prefixParamLength),
+	"mask":     paramSchema(netMaskParamCharset, netMaskParamLength),
+	"all":      {"type": "boolean"},
+}
+
+// The parameters of route listings
+var routeListParams = []object{
+	queryParam("fields", "Comma separated fields of the routes, e.g. network,bgp.as_path", nil),
+	queryParam("sort", "Sort the routes", object{
+		"type": "string",
+		"enum": []string{"network", "age", "local_pref", "med", "as_path", "metric", "primary"},
+	}),
+	queryParam("order", "Order of the sorted routes, routes without the value are last", object{
+		"type": "string",
+		"enum": []string{"asc", "desc"},
+	}),
+	queryParam("page", "Page of the routes, starting at 0", object{"type": "integer", "minimum": 0}),
+	queryParam("page_size", "Number of routes per page", object{"type": "integer", "minimum": 1, "maximum": maxPageSize}),
+	queryParam("cursor", "Cursor of the next page", nil),
+	queryParam("network", "Select routes by network", nil),
+	queryParam("network_match", "Match of the network", object{
+		"type": "string",
+		"enum": []string{"exact", "longer", "shorter"},
+	}),
+	queryParam("community", "Select routes with the community, e.g. 65000:1", nil),
+	queryParam("large_community", "Select routes with the large community, e.g. 65000:1:2", nil),
+	queryParam("ext_community", "Select routes with the ext community, e.g. rt:65000:1", nil),
+	queryParam("as_path_contains", "Select routes with the AS in the path", nil),
+	queryParam("origin_as", "Select routes originated by the AS", nil),
+	queryParam("next_hop", "Select routes by next hop", nil),
+	queryParam("primary", "Select primary routes", object{"type": "boolean"}),
+	queryParam("from_protocol", "Select routes learnt from the protocol", nil),
+	queryParam("format", "Response format", object{
+		"type": "string",
+		"enum": []string{"json", "ndjson"},
+	}),
+}
+
+func queryParam(name, description string, schema object) object {
+	if schema == nil {
+		schema = object{"type": "string"}
+	}
+	return object{
+		"name":        name,
+		"in":          "query",
+		"description": description,
+		"schema":      schema,
+	}
+}
+
+var pathParamRx = regexp.MustCompile(`:(\w+)`)
+
+// OpenAPIPath converts a router path to an OpenAPI
+// path, e.g. /routes/protocol/{protocol}
+func OpenAPIPath(path string) string {
+	return pathParamRx.ReplaceAllString(path, "{$1}")
+}
+
+// The documented error responses
+var errorResponses = map[string]string{
+	"400": "Invalid request or BIRD syntax error",
+	"404": "Protocol, table or network not found",
+	"429": "Rate limit exceeded",
+	"500": "BIRD reported an error",
+	"503": "BIRD is unreachable",
+	"504": "Query timed out",
+}
+
+// Responses which are not JSON
+var textResponses = map[string]struct {
+	contentType string
+	description string
+}{
+	"Version": {"text/plain", "The version of birdwatcher"},
+	"Metrics": {MetricsContentType, "Metrics in the Prometheus text format"},
+}
+
+// Describe an operation of a route
+func routeOperation(route Route) object {
+	params := []object{}
+	for _, match := range pathParamRx.FindAllStringSubmatch(route.Path, -1) {
+		schema, ok := paramSchemas[match[1]]
+		if !ok {
+			schema = object{"type": "string"}
+		}
+		params = append(params, object{
+			"name":     match[1],
+			"in":       "path",
+			"required": true,
+			"schema":   schema,
+		})
+	}
+	for _, q := range route.Query {
+		schema, ok := paramSchemas[q.Name]
+		if !ok {
+			schema = object{"type": "string"}
+		}
+		params = append(params, object{
+			"name":     q.Name,
+			"in":       "query",
+			"required": q.Required,
+			"schema":   schema,
+		})
+	}
+
+	if text, ok := textResponses[route.Response]; ok {
+		return object{
+			"summary":    route.Summary,
+			"tags":       []string{route.Module},
+			"parameters": params,
+			"responses": object{
+				"200": object{
+					"description": text.description,
+					"content": object{
+						text.contentType: object{"schema": object{"type": "string"}},
+					},
+				},
+			},
+		}
+	}
+
+	if route.Response == "Health" {
+		return healthOperation(route, params)
+	}
+
+	if Conf.AllowUncached {
+		params = append(params, queryParam(
+			"uncached", "Bypass the cache", object{"type": "boolean"}))
+	}
+	if route.Response == "Routes" {
+		params = append(params, routeListParams...)
+	}
+	if route.Stream {
+		params = append(params, queryParam(
+			"stream", "Write the routes while they are parsed",
+			object{"type": "boolean"}))
+	}
+
+	content := object{
+		"application/json": object{
+			"schema": ref(route.Response),
+		},
+	}
+	if route.Response == "Routes" {
+		content[NDJSONContentType] = object{
+			"schema": object{"type": "string"},
+		}
+	}
+
+	responses := object{
+		"200": object{
+			"description": route.Summary,
+			"content":     content,
+		},
+		"403": object{"description": "Access denied"},
+	}
+	for status, description := range errorResponses {
+		responses[status] = object{
+			"description": description,
+			"content": object{
+				"application/json": object{
+					"schema": ref("Error"),
+				},
+			},
+		}
+	}
+
+	return object{
+		"summary":    route.Summary,
+		"tags":       []string{route.Module},
+		"parameters": params,
+		"responses":  responses,
+	}
+}
+
+// Describe a health check. The result is not wrapped
+// in the envelope, the readiness check fails with 503.
+func healthOperation(route Route, params []object) object {
+	health := object{
+		"application/json": object{"schema": ref("Health")},
+	}
+	responses := object{
+		"200": object{"description": route.Summary, "content": health},
+	}
+	if route.Module == "readyz" {
+		responses["403"] = object{"description": "Access denied"}
+		responses["503"] = object{"description": "A check failed", "content": health}
+	}
+	return object{
+		"summary":    route.Summary,
+		"tags":       []string{route.Module},
+		"parameters": params,
+		"responses":  responses,
+	}
+}
+
+// OpenAPIDocument describes the routes as OpenAPI 3 document.
+// The API of the named instances is served under the prefix
+// of the instance, which is described as server.
+func OpenAPIDocument(version string, routes []Route, instances []string) map[string]interface{} {
+	paths := object{}
+	for _, route := range routes {
+		path := OpenAPIPath(route.Path)
+		operations, ok := paths[path].(object)
+		if !ok {
+			operations = object{}
+			paths[path] = operations
+		}
+		operations[strings.ToLower(route.HTTPMethod())] = routeOperation(route)
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":   "birdwatcher",
+			"version": version,
+		},
+		"paths": paths,
+		"components": object{
+			"schemas": schemas,
+		},
+	}
+	if len(instances) == 0 {
+		return doc
+	}
+
+	root := []object{{"url": "/"}}
+	doc["servers"] = []object{
+		root[0],
+		{
+			"url":         "/instances/{name}",
+			"description": "A named BIRD instance",
+			"variables": object{
+				"name": object{"default": instances[0], "enum": instances},
+			},
+		},
+	}
+	// The instances are listed only at the root
+	if operations, ok := paths["/instances"].(object); ok {
+		operations["servers"] = root
+	}
+	return doc
+}
+
+// OpenAPI serves the document
+func OpenAPI(version string, routes []Route, instances []string) httprouter.Handle {
+	doc, err := json.Marshal(OpenAPIDocument(version, routes, instances))
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(doc)
+	}
+}
+
+func ref(name string) object {
+	return object{"$ref": "#/components/schemas/" + name}
+}
+
+func properties(props object, required ...string) object {
+	schema := object{
+		"type":       "object",
+		"properties": props,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func arrayOf(items object) object {
+	return object{"type": "array", "items": items}
+}
+
+func mapOf(values object) object {
+	return object{"type": "object", "additionalProperties": values}
+}
+
+var (
+	stringSchema  = object{"type": "string"}
+	integerSchema = object{"type": "integer"}
+	booleanSchema = object{"type": "boolean"}
+)
+
+// Wrap the schema of a result in the envelope
+func envelope(props object, required ...string) object {
+	props["api"] = ref("API")
+	return properties(props, append([]string{"api"}, required...)...)
+}
+
+// The schemas of the results, see docs/schema.md
+var schemas = object{
+	"API": properties(object{
+		"Version":           stringSchema,
+		"result_from_cache": booleanSchema,
+		"cache_status": properties(object{
+			"cached_at": properties(object{
+				"date":          object{"type": "string", "format": "date-time"},
+				"timezone_type": stringSchema,
+				"timezone":      stringSchema,
+			}),
+			"stale": booleanSchema,
+		}),
+		"pagination": properties(object{
+			"page":          integerSchema,
+			"page_size":     integerSchema,
+			"total_pages":   integerSchema,
+			"total_results": integerSchema,
+			"next_cursor":   stringSchema,
+		}),
+	}),
+	"Error": properties(object{
+		"error": properties(object{
+			"code":    integerSchema,
+			"message": stringSchema,
+			"command": stringSchema,
+		}, "message"),
+	}, "error"),
+	"Health": properties(object{
+		"status": object{"type": "string", "enum": []string{"ok", "unavailable"}},
+		"checks": mapOf(properties(object{
+			"ok":      booleanSchema,
+			"message": stringSchema,
+		}, "ok")),
+	}, "status"),
+	"Instances": envelope(object{
+		"instances": mapOf(properties(object{
+			"ip_version":   stringSchema,
+			"bird_version": integerSchema,
+		})),
+	}, "instances"),
+	"Status": envelope(object{
+		"status": properties(object{
+			"version":        stringSchema,
+			"router_id":      stringSchema,
+			"current_server": stringSchema,
+			"last_reboot":    stringSchema,
+			"last_reconfig":  stringSchema,
+			"message":        stringSchema,
+		}),
+	}, "status"),
+	"RouteCount": mapOf(integerSchema),
+	"Protocol": object{
+		"type": "object",
+		"properties": object{
+			"protocol":      stringSchema,
+			"bird_protocol": stringSchema,
+			"table":         stringSchema,
+			"state":         stringSchema,
+			"state_changed": stringSchema,
+			"connection":    stringSchema,
+			"channels":      mapOf(properties(object{"routes": ref("RouteCount")})),
+			"routes":        ref("RouteCount"),
+			"route_changes": mapOf(ref("RouteCount")),
+		},
+		"additionalProperties": true,
+	},
+	"Protocols": envelope(object{
+		"protocols": mapOf(ref("Protocol")),
+	}, "protocols"),
+	"ProtocolsShort": envelope(object{
+		"protocols": mapOf(properties(object{
+			"proto": stringSchema,
+			"table": stringSchema,
+			"state": stringSchema,
+			"since": stringSchema,
+			"info":  stringSchema,
+		})),
+	}, "protocols"),
+	"Symbols": envelope(object{
+		"symbols": mapOf(arrayOf(stringSchema)),
+	}, "symbols"),
+	"SymbolNames": envelope(object{
+		"symbols": arrayOf(stringSchema),
+	}, "symbols"),
+	"BGPAttributes": object{
+		"type": "object",
+		"properties": object{
+			"origin":            stringSchema,
+			"as_path":           arrayOf(stringSchema),
+			"next_hop":          stringSchema,
+			"local_pref":        stringSchema,
+			"med":               stringSchema,
+			"communities":       arrayOf(arrayOf(integerSchema)),
+			"large_communities": arrayOf(arrayOf(integerSchema)),
+			"ext_communities":   arrayOf(arrayOf(stringSchema)),
+		},
+		"additionalProperties": stringSchema,
+	},
+	"Route": properties(object{
+		"network":       stringSchema,
+		"gateway":       stringSchema,
+		"interface":     stringSchema,
+		"from_protocol": stringSchema,
+		"age":           stringSchema,
+		"learnt_from":   stringSchema,
+		"primary":       booleanSchema,
+		"metric":        integerSchema,
+		"type":          arrayOf(stringSchema),
+		"bgp":           ref("BGPAttributes"),
+	}),
+	"Routes": envelope(object{
+		"routes": arrayOf(ref("Route")),
+	}, "routes"),
+	"RoutesCount": envelope(object{
+		"routes": integerSchema,
+	}, "routes"),
+	"Cache": envelope(object{
+		"cache": properties(object{
+			"backend": object{"type": "string", "enum": []string{"memory", "redis", "disk"}},
+			"entries": arrayOf(properties(object{
+				"key":       stringSchema,
+				"size":      integerSchema,
+				"cached_at": object{"type": "string", "format": "date-time"},
+				"ttl":       object{"type": "string", "format": "date-time"},
+				"hits":      integerSchema,
+			})),
+			"stats": properties(object{
+				"keys":      integerSchema,
+				"bytes":     integerSchema,
+				"max_keys":  integerSchema,
+				"max_bytes": integerSchema,
+				"hits":      integerSchema,
+				"misses":    integerSchema,
+				"evictions": integerSchema,
+			}),
+		}, "backend", "entries"),
+	}, "cache"),
+	"CachePurge": envelope(object{
+		"purged": integerSchema,
+	}, "purged"),
+	"Warmup": envelope(object{
+		"warmup": arrayOf(properties(object{
+			"module":    stringSchema,
+			"protocol":  stringSchema,
+			"warmed_at": object{"type": "string", "format": "date-time"},
+			"expires":   object{"type": "string", "format": "date-time"},
+			"error": properties(object{
+				"code":    integerSchema,
+				"message": stringSchema,
+				"command": stringSchema,
+			}),
+		}, "module", "warmed_at", "expires")),
+	}, "warmup"),
+}
@@ -0,0 +1,141 @@
+package endpoints
+
+// Paging through route listings
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alice-lg/birdwatcher/bird"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 10000
+
+	// Offsets are limited, so they can not overflow
+	maxPageOffset = math.MaxInt32
+)
+
+// Pagination describes the requested page of a
+// route listing.
+type Pagination struct {
+	Page         int    `json:"page"`
+	PageSize     int    `json:"page_size"`
+	TotalPages   int    `json:"total_pages"`
+	TotalResults int    `json:"total_results"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+}
+
+// A page request, decoded from the `page`, `page_size`
+// and `cursor` query parameters.
+type pageRequest struct {
+	offset   int
+	size     int
+	cursor   bool
+	cachedAt string // The result the cursor refers to
+}
+
+// CheckPagination checks if the client requested
+// a page of the results.
+func CheckPagination(req *http.Request) bool {
+	qs := req.URL.Query()
+	return len(qs["page"]) > 0 ||
+		len(qs["page_size"]) > 0 ||
+		len(qs["cursor"]) > 0
+}
+
+func parsePageRequest(req *http.Request) (*pageRequest, error) {
+	qs := req.URL.Query()
+	page := &pageRequest{size: defaultPageSize}
+
+	if value := qs.Get("page_size"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size <= 0 || size > maxPageSize {
+			return nil, fmt.Errorf("invalid page_size: %s", value)
+		}
+		page.size = size
+	}
+
+	// A cursor takes precedence over the page
+	if value := qs.Get("cursor"); value != "" {
+		offset, cachedAt, err := decodeCursor(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		page.offset = offset
+		page.cursor = true
+		page.cachedAt = cachedAt
+		return page, nil
+	}
+
+	if value := qs.Get("page"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > maxPageOffset/page.size {
+			return nil, fmt.Errorf("invalid page: %s", value)
+		}
+		page.offset = n * page.size
+	}
+
+	return page, nil
+}
+
+// A cursor points to the offset of the next page in
+// the result cached at a given time.
+func encodeCursor(offset int, cachedAt string) string {
+	cursor := strconv.Itoa(offset) + "|" + cachedAt
+	return base64.RawURLEncoding.EncodeToString([]byte(cursor))
+}
+
+func decodeCursor(cursor string) (int, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", err
+	}
+	tokens := strings.SplitN(string(data), "|", 2)
+	if len(tokens) != 2 {
+		return 0, "", fmt.Errorf("malformed cursor")
+	}
+	offset, err := strconv.Atoi(tokens[0])
+	if err != nil || offset < 0 || offset > maxPageOffset {
+		return 0, "", fmt.Errorf("malformed cursor")
+	}
+	return offset, tokens[1], nil
+}
+
+// Select the requested page from the routes
+func paginate(
+	routes []bird.Parsed,
+	page *pageRequest,
+	cachedAt string,
+) ([]bird.Parsed, *Pagination, *bird.Error) {
+	if page.cursor && page.cachedAt != cachedAt {
+		return nil, nil, bird.NewRequestError(
+			http.StatusGone,
+			"cursor expired: the result has been refreshed")
+	}
+
+	total := len(routes)
+	pagination := &Pagination{
+		Page:         page.offset / page.size,
+		PageSize:     page.size,
+		TotalPages:   (total + page.size - 1) / page.size,
+		TotalResults: total,
+	}
+
+	start := page.offset
+	if start > total {
+		start = total
+	}
+	end := total
+	if page.size < total-start {
+		end = start + page.size
+		pagination.NextCursor = encodeCursor(end, cachedAt)
+	}
+
+	return routes[start:end], pagination, nil
+}
@@ -0,0 +1,142 @@
+package endpoints
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alice-lg/birdwatcher/bird"
+	"github.com/julienschmidt/httprouter"
+)
+
+type routesResponse struct {
+	API    APIInfo       `json:"api"`
+	Routes []bird.Parsed `json:"routes"`
+}
+
+// Make an endpoint serving a cached result with n routes
+func cachedRoutesEndpoint(n int, cachedAt time.Time) (endpoint, bird.Parsed) {
+	routes := []bird.Parsed{}
+	for i := 0; i < n; i++ {
+		routes = append(routes, bird.Parsed{
+			"network": fmt.Sprintf("10.0.%d.0/24", i),
+		})
+	}
+	result := bird.Parsed{
+		"routes":    routes,
+		"cached_at": cachedAt,
+	}
+	return func(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
+		return result, true
+	}, result
+}
+
+func getRoutes(t *testing.T, handle endpoint, url string) (int, routesResponse) {
+	req := httptest.NewRequest("GET", url, nil)
+	rec := httptest.NewRecorder()
+	Endpoint("routes_protocol", handle)(rec, req, httprouter.Params{})
+
+	res := routesResponse{}
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec.Code, res
+}
+
+func TestPaginationPage(t *testing.T) {
+	handle, result := cachedRoutesEndpoint(25, time.Now())
+
+	_, res := getRoutes(t, handle, "/routes/protocol/R1?page=2&page_size=10")
+	if len(res.Routes) != 5 || res.Routes[0]["network"] != "10.0.20.0/24" {
+		t.Error("Unexpected page:", res.Routes)
+	}
+	p := res.API.Pagination
+	if p == nil {
+		t.Fatal("Expected pagination info")
+	}
+	if p.Page != 2 || p.PageSize != 10 || p.TotalPages != 3 || p.TotalResults != 25 {
+		t.Error("Unexpected pagination:", p)
+	}
+	if p.NextCursor != "" {
+		t.Error("Unexpected cursor on last page:", p.NextCursor)
+	}
+
+	// The cached result must not be modified
+	if len(result["routes"].([]bird.Parsed)) != 25 {
+		t.Error("Cached result was modified")
+	}
+
+	// Without parameters the result is not paginated
+	_, res = getRoutes(t, handle, "/routes/protocol/R1")
+	if len(res.Routes) != 25 || res.API.Pagination != nil {
+		t.Error("Unexpected pagination of result")
+	}
+}
+
+func TestPaginationCursor(t *testing.T) {
+	handle, _ := cachedRoutesEndpoint(25, time.Now())
+
+	seen := 0
+	url := "/routes/protocol/R1?page_size=10"
+	for i := 0; i < 5; i++ {
+		_, res := getRoutes(t, handle, url)
+		if len(res.Routes) > 0 && res.Routes[0]["network"] != fmt.Sprintf("10.0.%d.0/24", seen) {
+			t.Error("Unexpected first route of page:", res.Routes[0])
+		}
+		seen += len(res.Routes)
+		if res.API.Pagination.NextCursor == "" {
+			break
+		}
+		url = "/routes/protocol/R1?page_size=10&cursor=" + res.API.Pagination.NextCursor
+	}
+	if seen != 25 {
+		t.Error("Expected to page through 25 routes, got:", seen)
+	}
+
+	// The cursor expires when the result is refreshed
+	_, res := getRoutes(t, handle, "/routes/protocol/R1?page_size=10")
+	refreshed, _ := cachedRoutesEndpoint(25, time.Now().Add(time.Minute))
+	status, _ := getRoutes(t, refreshed,
+		"/routes/protocol/R1?cursor="+res.API.Pagination.NextCursor)
+	if status != http.StatusGone {
+		t.Error("Expected expired cursor, got:", status)
+	}
+}
+
+func TestPaginationInvalid(t *testing.T) {
+	handle, _ := cachedRoutesEndpoint(5, time.Now())
+	for _, query := range []string{
+		"page=-1", "page=x", "page_size=0", "page_size=10001", "cursor=foo",
+		"page=4611686018427387904&page_size=2",
+		"cursor=" + base64.RawURLEncoding.EncodeToString([]byte("4611686018427387904|x")),
+	} {
+		status, _ := getRoutes(t, handle, "/routes/protocol/R1?"+query)
+		if status != http.StatusBadRequest {
+			t.Error(query, ": expected bad request, got:", status)
+		}
+	}
+}
+
+func TestPaginationRedisResult(t *testing.T) {
+	result := bird.Parsed{
+		"routes": []interface{}{
+			map[string]interface{}{"network": "10.0.0.0/24"},
+			map[string]interface{}{"network": "10.0.1.0/24"},
+		},
+		"cached_at": "2021-03-30T02:28:25Z",
+	}
+	handle := func(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
+		return result, true
+	}
+
+	_, res := getRoutes(t, handle, "/routes/protocol/R1?page=1&page_size=1")
+	if len(res.Routes) != 1 || res.Routes[0]["network"] != "10.0.1.0/24" {
+		t.Error("Unexpected page:", res.Routes)
+	}
+}
@@ -8,13 +8,13 @@ import (
 )
 
 func Protocols(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
-	return bird.Protocols(useCache)
+	return bird.Protocols(r.Context(), useCache)
 }
 
 func Bgp(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
-	return bird.ProtocolsBgp(useCache)
+	return bird.ProtocolsBgp(r.Context(), useCache)
 }
 
 func ProtocolsShort(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
-	return bird.ProtocolsShort(useCache)
+	return bird.ProtocolsShort(r.Context(), useCache)
 }
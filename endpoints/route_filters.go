@@ -0,0 +1,289 @@
+package endpoints
+
+// Filtering route listings by query parameters
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alice-lg/birdwatcher/bird"
+)
+
+// A routeFilter matches a route
+type routeFilter func(route bird.Parsed) bool
+
+// The query parameters selecting routes
+var routeFilterParams = []string{
+	"network",
+	"community",
+	"large_community",
+	"ext_community",
+	"as_path_contains",
+	"origin_as",
+	"next_hop",
+	"primary",
+	"from_protocol",
+}
+
+// CheckRouteFilters checks if the client requested
+// to filter the routes.
+func CheckRouteFilters(req *http.Request) bool {
+	qs := req.URL.Query()
+	for _, param := range routeFilterParams {
+		if len(qs[param]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Make the filters from the query parameters. Repeated
+// parameters must all match.
+func parseRouteFilters(req *http.Request) ([]routeFilter, error) {
+	qs := req.URL.Query()
+	filters := []routeFilter{}
+
+	if value := qs.Get("network"); value != "" {
+		filter, err := makeNetworkFilter(value, qs.Get("network_match"))
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+
+	for _, value := range qs["community"] {
+		community, err := parseCommunityParam(value, 2)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, makeCommunityFilter("communities", community))
+	}
+	for _, value := range qs["large_community"] {
+		community, err := parseCommunityParam(value, 3)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, makeCommunityFilter("large_communities", community))
+	}
+	for _, value := range qs["ext_community"] {
+		if len(strings.Split(value, ":")) != 3 {
+			return nil, fmt.Errorf("invalid ext_community: %s", value)
+		}
+		filters = append(filters, makeCommunityFilter("ext_communities", value))
+	}
+
+	for _, value := range qs["as_path_contains"] {
+		asn, err := parseASNParam(value)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, func(route bird.Parsed) bool {
+			for _, hop := range stringList(routeBgp(route)["as_path"]) {
+				if hop == asn {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	if value := qs.Get("origin_as"); value != "" {
+		asn, err := parseASNParam(value)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, func(route bird.Parsed) bool {
+			path := stringList(routeBgp(route)["as_path"])
+			return len(path) > 0 && path[len(path)-1] == asn
+		})
+	}
+
+	if value := qs.Get("next_hop"); value != "" {
+		nextHop := net.ParseIP(value)
+		if nextHop == nil {
+			return nil, fmt.Errorf("invalid next_hop: %s", value)
+		}
+		filters = append(filters, func(route bird.Parsed) bool {
+			hop, ok := routeBgp(route)["next_hop"].(string)
+			if !ok {
+				hop, _ = route["gateway"].(string)
+			}
+			return nextHop.Equal(net.ParseIP(hop))
+		})
+	}
+
+	if value := qs.Get("primary"); value != "" {
+		primary, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid primary: %s", value)
+		}
+		filters = append(filters, func(route bird.Parsed) bool {
+			return route["primary"] == primary
+		})
+	}
+
+	if value := qs.Get("from_protocol"); value != "" {
+		protocol, err := ValidateProtocolParam(value)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, func(route bird.Parsed) bool {
+			return route["from_protocol"] == protocol
+		})
+	}
+
+	return filters, nil
+}
+
+// Select the routes matching all filters
+func filterRoutes(routes []bird.Parsed, filters []routeFilter) []bird.Parsed {
+	res := []bird.Parsed{}
+	for _, route := range routes {
+		if matchRoute(route, filters) {
+			res = append(res, route)
+		}
+	}
+	return res
+}
+
+func matchRoute(route bird.Parsed, filters []routeFilter) bool {
+	for _, filter := range filters {
+		if !filter(route) {
+			return false
+		}
+	}
+	return true
+}
+
+// Match the network of the route against the prefix:
+// exact, longer (more specific) or shorter (less specific)
+func makeNetworkFilter(value, match string) (routeFilter, error) {
+	_, prefix, err := net.ParseCIDR(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid network: %s", value)
+	}
+	prefixLen, _ := prefix.Mask.Size()
+
+	var contains func(network *net.IPNet) bool
+	switch match {
+	case "", "exact":
+		contains = func(network *net.IPNet) bool {
+			networkLen, _ := network.Mask.Size()
+			return networkLen == prefixLen && prefix.IP.Equal(network.IP)
+		}
+	case "longer":
+		contains = func(network *net.IPNet) bool {
+			networkLen, _ := network.Mask.Size()
+			return networkLen >= prefixLen && prefix.Contains(network.IP)
+		}
+	case "shorter":
+		contains = func(network *net.IPNet) bool {
+			networkLen, _ := network.Mask.Size()
+			return networkLen <= prefixLen && network.Contains(prefix.IP)
+		}
+	default:
+		return nil, fmt.Errorf("invalid network_match: %s", match)
+	}
+
+	return func(route bird.Parsed) bool {
+		value, _ := route["network"].(string)
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return false
+		}
+		return len(network.IP) == len(prefix.IP) && contains(network)
+	}, nil
+}
+
+func makeCommunityFilter(key string, community string) routeFilter {
+	return func(route bird.Parsed) bool {
+		for _, c := range communityList(routeBgp(route)[key]) {
+			if c == community {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Parse a community like 65000:1 and format it as
+// the communities of the routes.
+func parseCommunityParam(value string, parts int) (string, error) {
+	tokens := strings.Split(value, ":")
+	if len(tokens) != parts {
+		return "", fmt.Errorf("invalid community: %s", value)
+	}
+	for i, token := range tokens {
+		n, err := strconv.ParseUint(token, 10, 32)
+		if err != nil {
+			return "", fmt.Errorf("invalid community: %s", value)
+		}
+		tokens[i] = strconv.FormatUint(n, 10)
+	}
+	return strings.Join(tokens, ":"), nil
+}
+
+// Parse an AS number, with or without AS prefix
+func parseASNParam(value string) (string, error) {
+	asn, err := strconv.ParseUint(strings.TrimPrefix(value, "AS"), 10, 32)
+	if err != nil {
+		return "", fmt.Errorf("invalid AS number: %s", value)
+	}
+	return strconv.FormatUint(asn, 10), nil
+}
+
+// Get the bgp attributes of a route
+func routeBgp(route bird.Parsed) bird.Parsed {
+	if bgp, ok := bird.AsParsed(route["bgp"]); ok {
+		return bgp
+	}
+	return bird.Parsed{}
+}
+
+func stringList(value interface{}) []string {
+	switch list := value.(type) {
+	case []string:
+		return list
+	case []interface{}:
+		res := make([]string, 0, len(list))
+		for _, v := range list {
+			res = append(res, formatValue(v))
+		}
+		return res
+	}
+	return nil
+}
+
+// Get the communities formatted like 65000:1
+func communityList(value interface{}) []string {
+	res := []string{}
+	switch list := value.(type) {
+	case [][]int64:
+		for _, c := range list {
+			tokens := make([]string, 0, len(c))
+			for _, v := range c {
+				tokens = append(tokens, strconv.FormatInt(v, 10))
+			}
+			res = append(res, strings.Join(tokens, ":"))
+		}
+	case []interface{}:
+		for _, c := range list {
+			res = append(res, strings.Join(stringList(c), ":"))
+		}
+	}
+	return res
+}
+
+// Format a value as string. Numbers decoded from
+// JSON are float64 values.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
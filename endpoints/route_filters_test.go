@@ -0,0 +1,133 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alice-lg/birdwatcher/bird"
+)
+
+func testFilterRoutes() []bird.Parsed {
+	return []bird.Parsed{
+		{
+			"network":       "10.0.0.0/8",
+			"from_protocol": "R1",
+			"primary":       true,
+			"gateway":       "172.25.3.10",
+			"bgp": bird.Parsed{
+				"as_path":           []string{"4242", "65001"},
+				"next_hop":          "172.25.3.10",
+				"communities":       [][]int64{{65000, 1}, {65000, 2}},
+				"large_communities": [][]int64{{65000, 1, 2}},
+				"ext_communities":   []interface{}{[]interface{}{"rt", "65000", "1"}},
+			},
+		},
+		{
+			"network":       "10.1.0.0/16",
+			"from_protocol": "R2",
+			"primary":       false,
+			"gateway":       "172.25.3.11",
+			"bgp": bird.Parsed{
+				"as_path":     []string{"4242"},
+				"next_hop":    "172.25.3.11",
+				"communities": [][]int64{{65000, 2}},
+			},
+		},
+		{
+			"network":       "2001:db8::/32",
+			"from_protocol": "R3",
+			"primary":       true,
+			"gateway":       "2001:db8::1",
+		},
+	}
+}
+
+func filterNetworks(t *testing.T, query string, routes []bird.Parsed) []string {
+	req := httptest.NewRequest("GET", "/routes/table/master?"+query, nil)
+	if !CheckRouteFilters(req) {
+		t.Fatal("Expected route filters in:", query)
+	}
+	filters, err := parseRouteFilters(req)
+	if err != nil {
+		t.Fatal(query, err)
+	}
+	networks := []string{}
+	for _, route := range filterRoutes(routes, filters) {
+		networks = append(networks, route["network"].(string))
+	}
+	return networks
+}
+
+func TestRouteFilters(t *testing.T) {
+	tests := []struct {
+		query    string
+		networks []string
+	}{
+		{"network=10.0.0.0/8", []string{"10.0.0.0/8"}},
+		{"network=10.0.0.0/8&network_match=longer", []string{"10.0.0.0/8", "10.1.0.0/16"}},
+		{"network=10.1.2.0/24&network_match=shorter", []string{"10.0.0.0/8", "10.1.0.0/16"}},
+		{"network=2001:db8::/16&network_match=longer", []string{"2001:db8::/32"}},
+		{"community=65000:2", []string{"10.0.0.0/8", "10.1.0.0/16"}},
+		{"community=65000:1&community=65000:2", []string{"10.0.0.0/8"}},
+		{"large_community=65000:1:2", []string{"10.0.0.0/8"}},
+		{"ext_community=rt:65000:1", []string{"10.0.0.0/8"}},
+		{"as_path_contains=4242", []string{"10.0.0.0/8", "10.1.0.0/16"}},
+		{"origin_as=AS4242", []string{"10.1.0.0/16"}},
+		{"next_hop=172.25.3.11", []string{"10.1.0.0/16"}},
+		{"next_hop=2001:db8:0::1", []string{"2001:db8::/32"}},
+		{"primary=true", []string{"10.0.0.0/8", "2001:db8::/32"}},
+		{"from_protocol=R2", []string{"10.1.0.0/16"}},
+		{"primary=true&from_protocol=R2", []string{}},
+	}
+
+	for _, test := range tests {
+		networks := filterNetworks(t, test.query, testFilterRoutes())
+		if len(networks) != len(test.networks) {
+			t.Error(test.query, ": expected", test.networks, "got:", networks)
+			continue
+		}
+		for i, network := range networks {
+			if network != test.networks[i] {
+				t.Error(test.query, ": expected", test.networks, "got:", networks)
+			}
+		}
+	}
+}
+
+func TestRouteFiltersRedisResult(t *testing.T) {
+	// Routes decoded from the redis cache
+	data, _ := json.Marshal(testFilterRoutes())
+	decoded := []interface{}{}
+	json.Unmarshal(data, &decoded)
+	routes, ok := resultRoutes(bird.Parsed{"routes": decoded})
+	if !ok {
+		t.Fatal("Expected routes")
+	}
+
+	networks := filterNetworks(t, "community=65000:1&origin_as=65001", routes)
+	if len(networks) != 1 || networks[0] != "10.0.0.0/8" {
+		t.Error("Unexpected routes:", networks)
+	}
+}
+
+func TestRouteFiltersInvalid(t *testing.T) {
+	invalid := []string{
+		"network=10.0.0.0",
+		"network=10.0.0.0/8&network_match=any",
+		"community=65000",
+		"community=65000:x",
+		"large_community=1:2",
+		"ext_community=rt",
+		"origin_as=ASx",
+		"next_hop=foo",
+		"primary=maybe",
+		"from_protocol=R1%20",
+	}
+	for _, query := range invalid {
+		req := httptest.NewRequest("GET", "/routes/table/master?"+query, nil)
+		if _, err := parseRouteFilters(req); err == nil {
+			t.Error("Expected error for:", query)
+		}
+	}
+}
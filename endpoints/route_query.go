@@ -0,0 +1,96 @@
+package endpoints
+
+// Post processing of cached route results
+
+import (
+	"net/http"
+
+	"github.com/alice-lg/birdwatcher/bird"
+)
+
+// CheckRouteQuery checks if the route listing needs
+// to be processed for the request.
+func CheckRouteQuery(req *http.Request) bool {
+	return CheckSort(req) ||
+		CheckRouteFilters(req) ||
+		CheckPagination(req)
+}
+
+// Get the routes of a result. Results from the redis
+// cache hold generic maps instead of Parsed values.
+func resultRoutes(ret bird.Parsed) ([]bird.Parsed, bool) {
+	switch routes := ret["routes"].(type) {
+	case []bird.Parsed:
+		return routes, true
+	case []interface{}:
+		res := make([]bird.Parsed, 0, len(routes))
+		for _, r := range routes {
+			route, ok := r.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			res = append(res, bird.Parsed(route))
+		}
+		return res, true
+	}
+	return nil, false
+}
+
+// Apply the query parameters of the request to the
+// routes of the result. The result may be shared through
+// the cache and is not modified; a copy is returned.
+func applyRouteQuery(
+	r *http.Request,
+	ret bird.Parsed,
+) (bird.Parsed, *Pagination, *bird.Error) {
+	if !CheckRouteQuery(r) {
+		return ret, nil, nil
+	}
+	routes, ok := resultRoutes(ret)
+	if !ok {
+		return ret, nil, nil // Not a route listing
+	}
+
+	// Sorting is done on the complete result, so the
+	// sorted routes can be reused with other filters.
+	if CheckSort(r) {
+		sorted, err := sortResultRoutes(r, ret, routes)
+		if err != nil {
+			return nil, nil, bird.NewRequestError(
+				http.StatusBadRequest, err.Error())
+		}
+		routes = sorted
+	}
+
+	if CheckRouteFilters(r) {
+		filters, err := parseRouteFilters(r)
+		if err != nil {
+			return nil, nil, bird.NewRequestError(
+				http.StatusBadRequest, err.Error())
+		}
+		routes = filterRoutes(routes, filters)
+	}
+
+	var pagination *Pagination
+	if CheckPagination(r) {
+		page, err := parsePageRequest(r)
+		if err != nil {
+			return nil, nil, bird.NewRequestError(
+				http.StatusBadRequest, err.Error())
+		}
+		var pageErr *bird.Error
+		routes, pagination, pageErr = paginate(
+			routes, page, bird.ResultCachedAt(ret))
+		if pageErr != nil {
+			return nil, nil, pageErr
+		}
+	}
+
+	res := make(bird.Parsed, len(ret))
+	for k, v := range ret {
+		res[k] = v
+	}
+	res["routes"] = routes
+
+	return res, pagination, nil
+}
@@ -1,243 +1,275 @@
 package endpoints
 
 import (
-	"fmt"
 	"net/http"
 
 	"github.com/alice-lg/birdwatcher/bird"
 	"github.com/julienschmidt/httprouter"
 )
 
+// The response to invalid parameters
+func badRequest(message string) bird.Parsed {
+	return bird.Parsed{"error": bird.NewRequestError(http.StatusBadRequest, message)}
+}
+
 func ProtoRoutes(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
 	protocol, err := ValidateProtocolParam(ps.ByName("protocol"))
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
+	}
+
+	return bird.RoutesProto(r.Context(), useCache, protocol)
+}
+
+func ProtoRoutesStream(
+	r *http.Request,
+	ps httprouter.Params,
+	useCache bool,
+	emit func(bird.Parsed) error,
+) (bird.Parsed, bool) {
+	protocol, err := ValidateProtocolParam(ps.ByName("protocol"))
+	if err != nil {
+		return badRequest(err.Error()), false
 	}
 
-	return bird.RoutesProto(useCache, protocol)
+	return bird.RoutesProtoStream(r.Context(), useCache, protocol, emit)
 }
 
 func RoutesFiltered(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
 	protocol, err := ValidateProtocolParam(ps.ByName("protocol"))
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
 	}
 
-	return bird.RoutesFiltered(useCache, protocol)
+	return bird.RoutesFiltered(r.Context(), useCache, protocol)
 }
 
 func RoutesExport(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
 	protocol, err := ValidateProtocolParam(ps.ByName("protocol"))
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
 	}
 
-	return bird.RoutesExport(useCache, protocol)
+	return bird.RoutesExport(r.Context(), useCache, protocol)
 }
 
 func RoutesNoExport(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
 	protocol, err := ValidateProtocolParam(ps.ByName("protocol"))
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
 	}
 
-	return bird.RoutesNoExport(useCache, protocol)
+	return bird.RoutesNoExport(r.Context(), useCache, protocol)
 }
 
 func RoutesPrefixed(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
 	qs := r.URL.Query()
 	prefixl := qs["prefix"]
 	if len(prefixl) != 1 {
-		return bird.Parsed{"error": "need a prefix as single query parameter"}, false
+		return badRequest("need a prefix as single query parameter"), false
 	}
 
 	prefix, err := ValidatePrefixParam(prefixl[0])
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
 	}
 
-	return bird.RoutesPrefixed(useCache, prefix)
+	return bird.RoutesPrefixed(r.Context(), useCache, prefix)
 }
 
 func TableRoutes(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
 	table, err := ValidateProtocolParam(ps.ByName("table"))
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
+	}
+
+	return bird.RoutesTable(r.Context(), useCache, table)
+}
+
+func TableRoutesStream(
+	r *http.Request,
+	ps httprouter.Params,
+	useCache bool,
+	emit func(bird.Parsed) error,
+) (bird.Parsed, bool) {
+	table, err := ValidateProtocolParam(ps.ByName("table"))
+	if err != nil {
+		return badRequest(err.Error()), false
 	}
 
-	return bird.RoutesTable(useCache, table)
+	return bird.RoutesTableStream(r.Context(), useCache, table, emit)
 }
 
 func TableRoutesFiltered(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
 	table, err := ValidateProtocolParam(ps.ByName("table"))
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
 	}
 
-	return bird.RoutesTableFiltered(useCache, table)
+	return bird.RoutesTableFiltered(r.Context(), useCache, table)
 }
 
 func TableAndPeerRoutes(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
 	table, err := ValidateProtocolParam(ps.ByName("table"))
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
 	}
 
 	peer, err := ValidatePrefixParam(ps.ByName("peer"))
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
 	}
 
-	return bird.RoutesTableAndPeer(useCache, table, peer)
+	return bird.RoutesTableAndPeer(r.Context(), useCache, table, peer)
 }
 
 func ProtoCount(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
 	protocol, err := ValidateProtocolParam(ps.ByName("protocol"))
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
 	}
 
-	return bird.RoutesProtoCount(useCache, protocol)
+	return bird.RoutesProtoCount(r.Context(), useCache, protocol)
 }
 
 func ProtoPrimaryCount(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
 	protocol, err := ValidateProtocolParam(ps.ByName("protocol"))
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
 	}
-	return bird.RoutesProtoPrimaryCount(useCache, protocol)
+	return bird.RoutesProtoPrimaryCount(r.Context(), useCache, protocol)
 }
 
 func TableCount(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
 	table, err := ValidateProtocolParam(ps.ByName("table"))
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
 	}
 
-	return bird.RoutesTableCount(useCache, table)
+	return bird.RoutesTableCount(r.Context(), useCache, table)
 }
 
 func RouteNet(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
 	net, err := ValidatePrefixParam(ps.ByName("net"))
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
 	}
 
-	return bird.RoutesLookupTable(useCache, net, "master")
+	return bird.RoutesLookupTable(r.Context(), useCache, net, "master")
 }
 
 func RouteNetMask(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
 	net, err := ValidatePrefixParam(ps.ByName("net"))
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
 	}
 
 	mask, err := ValidateNetMaskParam(ps.ByName("mask"))
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
 	}
 
-	return bird.RoutesLookupTable(useCache, net+"/"+mask, "master")
+	return bird.RoutesLookupTable(r.Context(), useCache, net+"/"+mask, "master")
 }
 
 func RouteNetTable(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
 	net, err := ValidatePrefixParam(ps.ByName("net"))
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
 	}
 
 	table, err := ValidateProtocolParam(ps.ByName("table"))
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
 	}
 
-	return bird.RoutesLookupTable(useCache, net, table)
+	return bird.RoutesLookupTable(r.Context(), useCache, net, table)
 }
 
 func RouteNetMaskTable(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
 	net, err := ValidatePrefixParam(ps.ByName("net"))
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
 	}
 
 	mask, err := ValidateNetMaskParam(ps.ByName("mask"))
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
 	}
 
 	table, err := ValidateProtocolParam(ps.ByName("table"))
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
 	}
 
-	return bird.RoutesLookupTable(useCache, net+"/"+mask, table)
+	return bird.RoutesLookupTable(r.Context(), useCache, net+"/"+mask, table)
 }
 
 func PipeRoutesFiltered(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
 	qs := r.URL.Query()
 
 	if len(qs["table"]) != 1 {
-		return bird.Parsed{"error": "need a table as single query parameter"}, false
+		return badRequest("need a table as single query parameter"), false
 	}
 	table, err := ValidateProtocolParam(qs["table"][0])
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
 	}
 
 	if len(qs["pipe"]) != 1 {
-		return bird.Parsed{"error": "need a pipe as single query parameter"}, false
+		return badRequest("need a pipe as single query parameter"), false
 	}
 	pipe, err := ValidateProtocolParam(qs["pipe"][0])
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
 	}
 
 	if len(qs["protocol"]) > 0 {
 		protocol, err := ValidateProtocolParam(qs["protocol"][0])
 		if err != nil {
-			return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+			return badRequest(err.Error()), false
 		}
-		return bird.PipeRoutesFilteredProtocol(useCache, pipe, table, protocol)
+		return bird.PipeRoutesFilteredProtocol(r.Context(), useCache, pipe, table, protocol)
 	}
 
-	return bird.PipeRoutesFiltered(useCache, pipe, table)
+	return bird.PipeRoutesFiltered(r.Context(), useCache, pipe, table)
 }
 
 func PipeRoutesFilteredCount(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
 	qs := r.URL.Query()
 
 	if len(qs["table"]) != 1 {
-		return bird.Parsed{"error": "need a table as single query parameter"}, false
+		return badRequest("need a table as single query parameter"), false
 	}
 	table, err := ValidateProtocolParam(qs["table"][0])
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
 	}
 
 	if len(qs["pipe"]) != 1 {
-		return bird.Parsed{"error": "need a pipe as single query parameter"}, false
+		return badRequest("need a pipe as single query parameter"), false
 	}
 	pipe, err := ValidateProtocolParam(qs["pipe"][0])
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
 	}
 
 	if len(qs["address"]) != 1 {
-		return bird.Parsed{"error": "need a address as single query parameter"}, false
+		return badRequest("need a address as single query parameter"), false
 	}
 	address, err := ValidatePrefixParam(qs["address"][0])
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
 	}
 
-	return bird.PipeRoutesFilteredCount(useCache, pipe, table, address)
+	return bird.PipeRoutesFilteredCount(r.Context(), useCache, pipe, table, address)
 }
 
 func PeerRoutes(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
 	peer, err := ValidatePrefixParam(ps.ByName("peer"))
 	if err != nil {
-		return bird.Parsed{"error": fmt.Sprintf("%s", err)}, false
+		return badRequest(err.Error()), false
 	}
 
-	return bird.RoutesPeer(useCache, peer)
+	return bird.RoutesPeer(r.Context(), useCache, peer)
 }
@@ -0,0 +1,42 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestRoutesInvalidParams(t *testing.T) {
+	for _, tc := range []struct {
+		handle endpoint
+		url    string
+		params httprouter.Params
+	}{
+		{ProtoRoutes, "/routes/protocol/R1ö", httprouter.Params{{Key: "protocol", Value: "R1ö"}}},
+		{RoutesPrefixed, "/routes/prefix", nil},
+		{RoutesPrefixed, "/routes/prefix?prefix=10.0.0.0/8&prefix=10.1.0.0/16", nil},
+		{RouteNetMask, "/route/net/10.0.0.0/x", httprouter.Params{
+			{Key: "net", Value: "10.0.0.0"}, {Key: "mask", Value: "x"}}},
+		{PipeRoutesFiltered, "/routes/pipe/filtered?table=master", nil},
+		{PipeRoutesFilteredCount, "/routes/pipe/filtered/count?table=master&pipe=P1", nil},
+	} {
+		handle := Endpoint("routes", tc.handle)
+		rec := httptest.NewRecorder()
+		handle(rec, httptest.NewRequest("GET", tc.url, nil), tc.params)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Error(tc.url, ": expected bad request, got:", rec.Code)
+		}
+		res := struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || res.Error.Message == "" {
+			t.Error(tc.url, ": unexpected response:", rec.Body.String())
+		}
+	}
+}
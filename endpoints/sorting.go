@@ -0,0 +1,257 @@
+package endpoints
+
+// Sorting of route listings
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/alice-lg/birdwatcher/bird"
+)
+
+// A routeLess orders two routes
+type routeLess func(a, b bird.Parsed) bool
+
+var routeSortKeys = map[string]routeLess{
+	"network": func(a, b bird.Parsed) bool {
+		return compareNetworks(a["network"], b["network"]) < 0
+	},
+	"local_pref": func(a, b bird.Parsed) bool {
+		return lessNumber(routeBgp(a)["local_pref"], routeBgp(b)["local_pref"])
+	},
+	"med": func(a, b bird.Parsed) bool {
+		return lessNumber(routeBgp(a)["med"], routeBgp(b)["med"])
+	},
+	"as_path": func(a, b bird.Parsed) bool {
+		return len(stringList(routeBgp(a)["as_path"])) <
+			len(stringList(routeBgp(b)["as_path"]))
+	},
+	"metric": func(a, b bird.Parsed) bool {
+		return lessNumber(a["metric"], b["metric"])
+	},
+	"primary": func(a, b bird.Parsed) bool { // Primary routes first
+		return a["primary"] == true && b["primary"] != true
+	},
+}
+
+// Routes with a value for the sort key. Routes without
+// are ordered last, also in descending order.
+var routeSortHasValue = map[string]func(route bird.Parsed) bool{
+	"network": func(route bird.Parsed) bool {
+		network, _ := route["network"].(string)
+		_, _, err := net.ParseCIDR(network)
+		return err == nil
+	},
+	"local_pref": func(route bird.Parsed) bool {
+		_, ok := numberValue(routeBgp(route)["local_pref"])
+		return ok
+	},
+	"med": func(route bird.Parsed) bool {
+		_, ok := numberValue(routeBgp(route)["med"])
+		return ok
+	},
+	"metric": func(route bird.Parsed) bool {
+		_, ok := numberValue(route["metric"])
+		return ok
+	},
+}
+
+// CheckSort checks if the client requested
+// sorted routes.
+func CheckSort(req *http.Request) bool {
+	return req.URL.Query().Get("sort") != ""
+}
+
+// Get the ordering of the routes from the `sort`
+// and `order` parameters.
+func parseSort(req *http.Request) (routeLess, error) {
+	qs := req.URL.Query()
+	less, ok := routeSortKeys[qs.Get("sort")]
+	hasValue := routeSortHasValue[qs.Get("sort")]
+	if qs.Get("sort") == "age" {
+		less, hasValue = routeAgeSort(time.Now())
+		ok = true
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid sort: %s", qs.Get("sort"))
+	}
+
+	switch qs.Get("order") {
+	case "", "asc":
+		return less, nil
+	case "desc":
+		return func(a, b bird.Parsed) bool {
+			if hasValue != nil {
+				okA, okB := hasValue(a), hasValue(b)
+				if !okA || !okB {
+					return okA && !okB
+				}
+			}
+			return less(b, a)
+		}, nil
+	}
+	return nil, fmt.Errorf("invalid order: %s", qs.Get("order"))
+}
+
+// Sort a copy of the routes. The order of equal
+// routes is preserved.
+func sortRoutes(routes []bird.Parsed, less routeLess) []bird.Parsed {
+	sorted := make([]bird.Parsed, len(routes))
+	copy(sorted, routes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return less(sorted[i], sorted[j])
+	})
+	return sorted
+}
+
+// Sort the routes of the result. The sorted routes are
+// kept in the cache with the result, identified by the
+// instance and the command, so paging through a sorted
+// listing does not sort the routes for every page.
+func sortResultRoutes(
+	r *http.Request,
+	ret bird.Parsed,
+	routes []bird.Parsed,
+) ([]bird.Parsed, error) {
+	less, err := parseSort(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := bird.RecordedCommand(r.Context())
+	if cmd == "" {
+		return sortRoutes(routes, less), nil // Not a cached result
+	}
+
+	qs := r.URL.Query()
+	order := qs.Get("order")
+	if order == "" {
+		order = "asc"
+	}
+	order = qs.Get("sort") + "," + order
+
+	instance := bird.InstanceFromContext(r.Context())
+	if sorted, ok := instance.CachedSortedRoutes(cmd, order, ret); ok {
+		return sorted, nil
+	}
+	sorted := sortRoutes(routes, less)
+	instance.CacheSortedRoutes(cmd, order, ret, sorted)
+	return sorted, nil
+}
+
+// Order networks by address family, address
+// and prefix length.
+func compareNetworks(a, b interface{}) int {
+	netA, _ := a.(string)
+	netB, _ := b.(string)
+	ipA, prefixA, errA := net.ParseCIDR(netA)
+	ipB, prefixB, errB := net.ParseCIDR(netB)
+	if errA != nil || errB != nil {
+		switch {
+		case errA == nil: // Invalid networks last
+			return -1
+		case errB == nil:
+			return 1
+		}
+		return bytes.Compare([]byte(netA), []byte(netB))
+	}
+
+	if ip4A, ip4B := ipA.To4(), ipB.To4(); (ip4A == nil) != (ip4B == nil) {
+		if ip4A != nil {
+			return -1 // IPv4 first
+		}
+		return 1
+	}
+	if c := bytes.Compare(prefixA.IP.To16(), prefixB.IP.To16()); c != 0 {
+		return c
+	}
+	lenA, _ := prefixA.Mask.Size()
+	lenB, _ := prefixB.Mask.Size()
+	return lenA - lenB
+}
+
+// Compare numeric values. Routes without the
+// value are ordered last.
+func lessNumber(a, b interface{}) bool {
+	nA, okA := numberValue(a)
+	nB, okB := numberValue(b)
+	if !okA || !okB {
+		return okA && !okB
+	}
+	return nA < nB
+}
+
+// Get a number from a parsed value. The bgp attributes
+// are parsed as strings, numbers decoded from JSON
+// are float64 values.
+func numberValue(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// Order routes by age, youngest first. The ages are
+// parsed once per sort.
+func routeAgeSort(now time.Time) (routeLess, func(bird.Parsed) bool) {
+	type age struct {
+		since time.Duration
+		ok    bool
+	}
+	ages := map[string]age{}
+	routeAge := func(route bird.Parsed) age {
+		value, _ := route["age"].(string)
+		a, ok := ages[value]
+		if !ok {
+			a.since, a.ok = parseRouteAge(value, now)
+			ages[value] = a
+		}
+		return a
+	}
+	less := func(a, b bird.Parsed) bool {
+		ageA, ageB := routeAge(a), routeAge(b)
+		if !ageA.ok || !ageB.ok {
+			return ageA.ok && !ageB.ok // Unknown age last
+		}
+		return ageA.since < ageB.since
+	}
+	hasValue := func(route bird.Parsed) bool {
+		return routeAge(route).ok
+	}
+	return less, hasValue
+}
+
+// Get the time since the route was learned. BIRD
+// prints the time without date for recent routes.
+func parseRouteAge(age string, now time.Time) (time.Duration, bool) {
+	if since, ok := birdTimeSince(age, now); ok {
+		return since, true
+	}
+	for _, format := range []string{"15:04:05.999999999", "15:04:05"} {
+		t, err := time.ParseInLocation(format, age, time.Local)
+		if err != nil {
+			continue
+		}
+		y, m, d := now.Date()
+		learned := time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(),
+			t.Nanosecond(), time.Local)
+		if learned.After(now) { // Before midnight
+			learned = learned.AddDate(0, 0, -1)
+		}
+		return now.Sub(learned), true
+	}
+	return 0, false
+}
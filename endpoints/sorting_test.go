@@ -0,0 +1,167 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alice-lg/birdwatcher/bird"
+	"github.com/julienschmidt/httprouter"
+)
+
+func sortNetworks(t *testing.T, query string, routes []bird.Parsed) []string {
+	req := httptest.NewRequest("GET", "/routes/table/master?"+query, nil)
+	less, err := parseSort(req)
+	if err != nil {
+		t.Fatal(query, err)
+	}
+	networks := []string{}
+	for _, route := range sortRoutes(routes, less) {
+		networks = append(networks, route["network"].(string))
+	}
+	return networks
+}
+
+func TestSortRoutes(t *testing.T) {
+	routes := []bird.Parsed{
+		{"network": "2001:db8::/32", "metric": int64(100), "primary": false},
+		{"network": "10.1.0.0/16", "metric": int64(200), "primary": true,
+			"bgp": bird.Parsed{"local_pref": "200", "as_path": []string{"1", "2"}}},
+		{"network": "9.0.0.0/8", "metric": int64(300), "primary": false,
+			"bgp": bird.Parsed{"local_pref": "100", "med": "10", "as_path": []string{"1"}}},
+		{"network": "10.0.0.0/8", "metric": int64(100), "primary": true,
+			"bgp": bird.Parsed{"local_pref": "100", "med": "5", "as_path": []string{"1", "2", "3"}}},
+	}
+
+	tests := []struct {
+		query    string
+		networks []string
+	}{
+		{"sort=network", []string{"9.0.0.0/8", "10.0.0.0/8", "10.1.0.0/16", "2001:db8::/32"}},
+		{"sort=network&order=desc", []string{"2001:db8::/32", "10.1.0.0/16", "10.0.0.0/8", "9.0.0.0/8"}},
+		{"sort=local_pref", []string{"9.0.0.0/8", "10.0.0.0/8", "10.1.0.0/16", "2001:db8::/32"}},
+		{"sort=med", []string{"10.0.0.0/8", "9.0.0.0/8", "2001:db8::/32", "10.1.0.0/16"}},
+		{"sort=med&order=desc", []string{"9.0.0.0/8", "10.0.0.0/8", "2001:db8::/32", "10.1.0.0/16"}},
+		{"sort=local_pref&order=desc", []string{"10.1.0.0/16", "9.0.0.0/8", "10.0.0.0/8", "2001:db8::/32"}},
+		{"sort=as_path", []string{"2001:db8::/32", "9.0.0.0/8", "10.1.0.0/16", "10.0.0.0/8"}},
+		{"sort=metric&order=desc", []string{"9.0.0.0/8", "10.1.0.0/16", "2001:db8::/32", "10.0.0.0/8"}},
+		{"sort=primary", []string{"10.1.0.0/16", "10.0.0.0/8", "2001:db8::/32", "9.0.0.0/8"}},
+	}
+
+	for _, test := range tests {
+		networks := sortNetworks(t, test.query, routes)
+		for i, network := range networks {
+			if network != test.networks[i] {
+				t.Error(test.query, ": expected", test.networks, "got:", networks)
+				break
+			}
+		}
+	}
+
+	// The routes are not modified
+	if routes[0]["network"] != "2001:db8::/32" {
+		t.Error("Routes were modified")
+	}
+}
+
+func TestSortInvalid(t *testing.T) {
+	for _, query := range []string{"sort=foo", "sort=network&order=up"} {
+		req := httptest.NewRequest("GET", "/routes/table/master?"+query, nil)
+		if _, err := parseSort(req); err == nil {
+			t.Error("Expected error for:", query)
+		}
+	}
+}
+
+func TestSortWithPagination(t *testing.T) {
+	handle, _ := cachedRoutesEndpoint(25, time.Now())
+
+	_, res := getRoutes(t, handle, "/routes/protocol/R1?sort=network&order=desc&page=0&page_size=2")
+	if len(res.Routes) != 2 || res.Routes[0]["network"] != "10.0.24.0/24" {
+		t.Error("Unexpected routes:", res.Routes)
+	}
+
+	// The sorted routes are reused for the next page
+	_, res = getRoutes(t, handle, "/routes/protocol/R1?sort=network&order=desc&page=1&page_size=2")
+	if len(res.Routes) != 2 || res.Routes[0]["network"] != "10.0.22.0/24" {
+		t.Error("Unexpected routes:", res.Routes)
+	}
+}
+
+func TestSortAge(t *testing.T) {
+	now := time.Now()
+	routes := []bird.Parsed{
+		{"network": "10.0.0.0/8", "age": now.Add(-2 * time.Hour).Format("2006-01-02 15:04:05")},
+		{"network": "10.1.0.0/16", "age": "invalid"},
+		{"network": "10.2.0.0/16", "age": now.Add(-time.Minute).Format("15:04:05")},
+		{"network": "10.3.0.0/16", "age": now.AddDate(0, 0, -3).Format("2006-01-02")},
+	}
+	networks := sortNetworks(t, "sort=age", routes)
+	expected := []string{"10.2.0.0/16", "10.0.0.0/8", "10.3.0.0/16", "10.1.0.0/16"}
+	for i, network := range networks {
+		if network != expected[i] {
+			t.Error("Expected", expected, "got:", networks)
+			break
+		}
+	}
+
+	// The unknown age is last in descending order too
+	networks = sortNetworks(t, "sort=age&order=desc", routes)
+	expected = []string{"10.3.0.0/16", "10.0.0.0/8", "10.2.0.0/16", "10.1.0.0/16"}
+	for i, network := range networks {
+		if network != expected[i] {
+			t.Error("Expected", expected, "got:", networks)
+			break
+		}
+	}
+}
+
+func TestSortCachedByCommand(t *testing.T) {
+	bird.CacheConf = bird.CacheConfig{UseDisk: true, DiskPath: t.TempDir()}
+	bird.InitializeCache()
+	defer func() {
+		bird.CacheConf = bird.CacheConfig{}
+		bird.InitializeCache()
+	}()
+
+	disk, err := bird.NewDiskCache(bird.CacheConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := map[string][]bird.Parsed{
+		"route all protocol 'R1'": {{"network": "10.1.0.0/16"}, {"network": "10.0.0.0/16"}},
+		"route all protocol 'R2'": {{"network": "10.3.0.0/16"}, {"network": "10.2.0.0/16"}},
+	}
+	for cmd, routes := range results {
+		disk.Set(bird.Default.Namespace+":"+cmd, bird.Parsed{"routes": routes}, 5*time.Minute)
+	}
+
+	// The endpoints are served at the same path, the
+	// query selects the protocol.
+	for cmd, routes := range results {
+		cmd := cmd
+		handle := Endpoint("routes_protocol", func(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
+			return bird.RunAndParse(r.Context(), useCache, "", cmd, nil, nil)
+		})
+		rec := httptest.NewRecorder()
+		handle(rec, httptest.NewRequest("GET", "/routes?sort=network", nil), nil)
+
+		res := routesResponse{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Routes) != 2 || res.Routes[0]["network"] != routes[1]["network"] {
+			t.Error(cmd, ": unexpected routes:", res.Routes)
+		}
+	}
+
+	entries, err := bird.Default.CacheEntries("route all protocol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 || entries[1].Key != "route all protocol 'R1' | sort network,asc" {
+		t.Error("Expected the sorted routes to be cached by command:", entries)
+	}
+}
@@ -8,5 +8,22 @@ import (
 )
 
 func Status(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
-	return bird.Status(useCache)
+	status, fromCache := bird.Status(r.Context(), useCache)
+	if bird.IsSpecial(status) {
+		return status, fromCache
+	}
+
+	stats, ok := bird.SocketPoolStats(r.Context())
+	if !ok {
+		return status, fromCache
+	}
+
+	// Do not modify the cached result
+	res := bird.Parsed{}
+	for k, v := range status {
+		res[k] = v
+	}
+	res["socket_pool"] = stats
+
+	return res, fromCache
 }
@@ -0,0 +1,178 @@
+package endpoints
+
+// Streaming route responses
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/alice-lg/birdwatcher/bird"
+	"github.com/julienschmidt/httprouter"
+)
+
+// A streaming endpoint passes routes to emit while they are
+// parsed. If a cached result is available it is returned
+// instead. On success nil is returned.
+type streamingEndpoint func(
+	*http.Request,
+	httprouter.Params,
+	bool,
+	func(bird.Parsed) error,
+) (bird.Parsed, bool)
+
+// CheckStream checks if the client requested a
+// streamed response.
+func CheckStream(req *http.Request) bool {
+	qs := req.URL.Query()
+	return len(qs["stream"]) == 1 && qs["stream"][0] == "true"
+}
+
+// StreamingEndpoint serves the wrapped endpoint. If the client
+// requests a streamed response with `stream=true`, the routes
+// are written while they are parsed. Streamed results are not
+// cached, but a cached result is used if available.
+func StreamingEndpoint(
+	module string,
+	wrapped endpoint,
+	streaming streamingEndpoint,
+) httprouter.Handle {
+	handle := Endpoint(module, wrapped)
+	return func(w http.ResponseWriter,
+		r *http.Request,
+		ps httprouter.Params) {
+
+		// Processing the routes requires the complete result
+		if !CheckStream(r) || CheckRouteQuery(r) {
+			handle(w, r, ps)
+			return
+		}
+
+		r, cancel, ok := beginRequest(module, w, r)
+		if !ok {
+			return
+		}
+		defer cancel()
+
+		stream := &routeStream{w: w, r: r, ndjson: CheckNDJSON(r)}
+		if CheckFields(r) {
+			fields, err := parseFields(r.URL.Query().Get("fields"))
+			if err != nil {
+				writeError(w, bird.NewRequestError(
+					http.StatusBadRequest, err.Error()))
+				return
+			}
+			stream.fields = fields
+		}
+
+		useCache := CheckUseCache(r)
+		ret, fromCache := streaming(r, ps, useCache, stream.emit)
+
+		err, failed := bird.ParsedError(ret)
+		if !failed && ret != nil {
+			writeResult(w, r, ret, fromCache) // Not streamed
+			return
+		}
+		if failed && !stream.started {
+			writeError(w, err)
+			return
+		}
+		if failed {
+			// The response is incomplete and the status
+			// was already sent: Abort the connection.
+			log.Println("Aborting streamed response:", err)
+			panic(http.ErrAbortHandler)
+		}
+
+		stream.finish()
+		stream.close()
+	}
+}
+
+// The routeStream writes the envelope with the
+// first route. With ndjson the envelope is written
+// as a header line and every route on its own line.
+type routeStream struct {
+	w      http.ResponseWriter
+	r      *http.Request
+	ndjson bool
+	fields fieldSet
+
+	out     io.Writer
+	done    func()
+	started bool
+	count   int
+}
+
+func (s *routeStream) begin() error {
+	s.started = true
+	if s.ndjson {
+		s.w.Header().Set("Content-Type", NDJSONContentType)
+	} else {
+		s.w.Header().Set("Content-Type", "application/json")
+	}
+	s.out, s.done = responseWriter(s.w, s.r)
+
+	api, err := json.Marshal(GetApiInfo(&bird.Parsed{}, false))
+	if err != nil {
+		return err
+	}
+
+	if s.ndjson {
+		_, err = io.WriteString(s.out, `{"api":`+string(api)+"}\n")
+	} else {
+		_, err = io.WriteString(s.out, `{"api":`+string(api)+`,"routes":[`)
+	}
+	return err
+}
+
+func (s *routeStream) emit(route bird.Parsed) error {
+	if !s.started {
+		if err := s.begin(); err != nil {
+			return err
+		}
+	}
+
+	if s.fields != nil {
+		route = s.fields.project(route)
+	}
+
+	js, err := json.Marshal(route)
+	if err != nil {
+		return err
+	}
+	if s.ndjson {
+		_, err = s.out.Write(append(js, '\n'))
+		return err
+	}
+	if s.count > 0 {
+		if _, err := io.WriteString(s.out, ","); err != nil {
+			return err
+		}
+	}
+	s.count++
+
+	_, err = s.out.Write(js)
+	return err
+}
+
+func (s *routeStream) finish() error {
+	if !s.started {
+		if err := s.begin(); err != nil {
+			return err
+		}
+	}
+	if s.ndjson {
+		return nil
+	}
+	_, err := io.WriteString(s.out, "]}\n")
+	return err
+}
+
+// Flush the compressed response
+func (s *routeStream) close() {
+	if s.done != nil {
+		s.done()
+	}
+}
@@ -0,0 +1,67 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alice-lg/birdwatcher/bird"
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestStreamingEndpoint(t *testing.T) {
+	wrapped := func(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
+		t.Error("Unexpected call of the non streaming endpoint")
+		return nil, false
+	}
+	streaming := func(
+		r *http.Request,
+		ps httprouter.Params,
+		useCache bool,
+		emit func(bird.Parsed) error,
+	) (bird.Parsed, bool) {
+		for _, net := range []string{"1.2.3.0/24", "1.2.4.0/24", "1.2.5.0/24"} {
+			if err := emit(bird.Parsed{"network": net}); err != nil {
+				return nil, false
+			}
+		}
+		return nil, false
+	}
+
+	handle := StreamingEndpoint("routes_protocol", wrapped, streaming)
+	req := httptest.NewRequest("GET", "/routes/protocol/R1?stream=true", nil)
+	rec := httptest.NewRecorder()
+	handle(rec, req, httprouter.Params{})
+
+	res := struct {
+		API    APIInfo       `json:"api"`
+		Routes []bird.Parsed `json:"routes"`
+	}{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err, rec.Body.String())
+	}
+	if len(res.Routes) != 3 || res.Routes[2]["network"] != "1.2.5.0/24" {
+		t.Error("Unexpected routes:", res.Routes)
+	}
+}
+
+func TestStreamingEndpointError(t *testing.T) {
+	streaming := func(
+		r *http.Request,
+		ps httprouter.Params,
+		useCache bool,
+		emit func(bird.Parsed) error,
+	) (bird.Parsed, bool) {
+		return bird.Parsed{"error": &bird.Error{Code: 8003, Message: "No protocols match"}}, false
+	}
+
+	handle := StreamingEndpoint("routes_protocol", nil, streaming)
+	req := httptest.NewRequest("GET", "/routes/protocol/R1?stream=true", nil)
+	rec := httptest.NewRecorder()
+	handle(rec, req, httprouter.Params{})
+
+	if rec.Code != http.StatusNotFound {
+		t.Error("Unexpected status:", rec.Code)
+	}
+}
@@ -8,11 +8,11 @@ import (
 )
 
 func Symbols(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
-	return bird.Symbols(useCache)
+	return bird.Symbols(r.Context(), useCache)
 }
 
 func SymbolTables(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
-	val, from_cache := bird.Symbols(useCache)
+	val, from_cache := bird.Symbols(r.Context(), useCache)
 	if bird.IsSpecial(val) {
 		return val, from_cache
 	}
@@ -20,7 +20,7 @@ func SymbolTables(r *http.Request, ps httprouter.Params, useCache bool) (bird.Pa
 }
 
 func SymbolProtocols(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
-	val, from_cache := bird.Symbols(useCache)
+	val, from_cache := bird.Symbols(r.Context(), useCache)
 	if bird.IsSpecial(val) {
 		return val, from_cache
 	}
@@ -0,0 +1,63 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alice-lg/birdwatcher/bird"
+)
+
+func TestSymbolsDiskCache(t *testing.T) {
+	bird.CacheConf = bird.CacheConfig{UseDisk: true, DiskPath: t.TempDir()}
+	bird.InitializeCache()
+	defer func() {
+		bird.CacheConf = bird.CacheConfig{}
+		bird.InitializeCache()
+	}()
+
+	// Written by another process, e.g. before a restart
+	disk, err := bird.NewDiskCache(bird.CacheConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = disk.Set(bird.Default.Namespace+":symbols", bird.Parsed{
+		"symbols": bird.Parsed{
+			"routing table": []string{"master4"},
+			"protocol":      []string{"R1", "R2"},
+		},
+	}, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		handle  endpoint
+		symbols int
+	}{
+		{SymbolTables, 1},
+		{SymbolProtocols, 2},
+	} {
+		ret, fromCache := tc.handle(httptest.NewRequest("GET", "/symbols", nil), nil, true)
+		if !fromCache {
+			t.Fatal("Expected a cached result")
+		}
+		symbols, err := json.Marshal(ret["symbols"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := []string{}
+		json.Unmarshal(symbols, &decoded)
+		if len(decoded) != tc.symbols {
+			t.Error("Unexpected symbols:", ret)
+		}
+	}
+
+	ret, _ := Symbols(httptest.NewRequest("GET", "/symbols", nil), nil, true)
+	info := GetApiInfo(&ret, true)
+	cachedAt := info.CacheStatus.CachedAt.Date
+	if cachedAt.IsZero() || time.Since(cachedAt) > time.Minute {
+		t.Error("Unexpected cached_at:", cachedAt)
+	}
+}
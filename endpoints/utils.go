@@ -14,12 +14,14 @@ type TimeInfo struct {
 
 type CacheStatus struct {
 	CachedAt TimeInfo `json:"cached_at"`
+	Stale    bool     `json:"stale,omitempty"` // Expired, but served while refreshed
 }
 
 type APIInfo struct {
 	Version         string
 	ResultFromCache bool        `json:"result_from_cache"`
 	CacheStatus     CacheStatus `json:"cache_status"`
+	Pagination      *Pagination `json:"pagination,omitempty"`
 }
 
 // go generate does not work in subdirectories. Beautious.
@@ -57,6 +59,8 @@ func GetApiInfo(res *bird.Parsed, from_cache bool) *APIInfo {
 		},
 	}
 
+	cacheInfo.Stale = api[bird.StaleKey] == true
+
 	ai.CacheStatus = cacheInfo
 
 	return ai
@@ -0,0 +1,15 @@
+package endpoints
+
+import (
+	"net/http"
+
+	"github.com/alice-lg/birdwatcher/bird"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Warmup lists when the results of the instance
+// were last refreshed in the background.
+func Warmup(r *http.Request, ps httprouter.Params, useCache bool) (bird.Parsed, bool) {
+	instance := bird.InstanceFromContext(r.Context())
+	return bird.Parsed{"warmup": instance.WarmupStatus()}, false
+}
@@ -25,12 +25,17 @@ func Housekeeping(config HousekeepingConfig, expireCaches bool) {
 
 		log.Println("Housekeeping started")
 
-		if (bird.ClientConf.CacheTtl > 0) && expireCaches {
+		if expireCaches {
 			// Expire the caches
-			log.Println("Expiring MemoryCache")
+			log.Println("Expiring cache")
 
 			count := bird.ExpireCache()
-			log.Println("Expired", count, "entries (MemoryCache)")
+			log.Println("Expired", count, "entries")
+
+			if stats, ok := bird.MemoryCacheStatistics(); ok {
+				log.Println("MemoryCache:", stats.Keys, "entries,", stats.Bytes, "bytes,",
+					stats.Hits, "hits,", stats.Misses, "misses,", stats.Evictions, "evictions")
+			}
 		}
 
 		if config.ForceReleaseMemory {
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/alice-lg/birdwatcher/bird"
+)
+
+// WatchReconfig queries the status of the instances
+// regularly, so a reconfiguration of BIRD is detected
+// and the outdated results are removed from the cache
+// even if the status is not requested.
+func WatchReconfig(interval time.Duration, instances []*bird.Instance) {
+	for {
+		for _, instance := range instances {
+			ctx := bird.WithInstance(context.Background(), instance)
+			bird.Status(ctx, false)
+		}
+		time.Sleep(interval)
+	}
+}
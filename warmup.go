@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/alice-lg/birdwatcher/bird"
+)
+
+// Warmup refreshes the configured results of the instances
+// before they expire, see bird.Instance.Warm. It runs next
+// to the Housekeeping.
+func Warmup(config bird.WarmupConfig, instances []*bird.Instance) {
+	for {
+		for _, instance := range instances {
+			count := instance.Warm(context.Background())
+			if count > 0 {
+				log.Println("Warmed", count, "results", instance.Name)
+			}
+		}
+		time.Sleep(config.Period())
+	}
+}